@@ -0,0 +1,218 @@
+// Command flashsaleload checks that flash sales cannot oversell. It starts a
+// flash sale on one product and runs many concurrent checkouts of it, each
+// putting the product in a customer's cart and then, in one transaction,
+// locking the cart's flash sale items, pricing the cart and claiming the
+// priced units, the sequence Checkout and UseWalletForPurchase follow. It
+// then verifies that no more units were claimed than the sale had, that every
+// unit priced at the sale price was claimed and that no customer went over
+// their cap. Stock, payment and the order's items are left out.
+//
+// It is a manual tool rather than a test since it needs a real database. It
+// creates and cleans up its own sale, cart lines and placeholder orders for
+// existing customers, so run it against a disposable database:
+//
+//	go run ./cmd/flashsaleload -product 1 -units 50 -limit 2 -workers 200
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"horizon/config"
+	"horizon/models"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	productID := flag.Int("product", 0, "product to put on flash sale")
+	units := flag.Int("units", 50, "units on sale")
+	limit := flag.Int("limit", 2, "units each customer may buy")
+	customers := flag.Int("customers", 40, "distinct customers checking out")
+	workers := flag.Int("workers", 200, "concurrent checkouts")
+	attempts := flag.Int("attempts", 2000, "checkouts to attempt in total")
+	flag.Parse()
+	if *productID == 0 {
+		log.Fatal("-product is required")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+	config.InitDB()
+	config.DB.SetMaxOpenConns(*workers)
+
+	var userIDs []int
+	if err := config.DB.Select(&userIDs, `SELECT id FROM users ORDER BY id LIMIT $1`, *customers); err != nil {
+		log.Fatalf("Failed to pick customers: %v", err)
+	}
+	if len(userIDs) == 0 {
+		log.Fatal("No customers to check out with")
+	}
+
+	var saleID, itemID int
+	err := config.DB.QueryRow(`
+		INSERT INTO flash_sales (name, start_time, end_time)
+		VALUES ('Load test', NOW() - INTERVAL '1 minute', NOW() + INTERVAL '1 hour')
+		RETURNING id`).Scan(&saleID)
+	if err != nil {
+		log.Fatalf("Failed to create flash sale: %v", err)
+	}
+	defer cleanup(saleID)
+	err = config.DB.QueryRow(`
+		INSERT INTO flash_sale_items (flash_sale_id, product_id, discount_percentage, quantity, per_customer_limit)
+		VALUES ($1, $2, 50, $3, $4)
+		RETURNING id`, saleID, *productID, *units, *limit).Scan(&itemID)
+	if err != nil {
+		log.Printf("Failed to add flash sale item: %v", err)
+		return
+	}
+
+	var claimedUnits, succeeded, fullPrice, soldOut, overLimit, failed int64
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < *workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				userID := userIDs[rand.Intn(len(userIDs))]
+				quantity := 1 + rand.Intn(*limit+1)
+				units, err := checkout(n, userID, *productID, quantity)
+				switch err {
+				case nil:
+					atomic.AddInt64(&succeeded, 1)
+					atomic.AddInt64(&claimedUnits, int64(units))
+					if units == 0 {
+						atomic.AddInt64(&fullPrice, 1)
+					}
+				case models.ErrFlashSaleUnavailable:
+					atomic.AddInt64(&soldOut, 1)
+				case models.ErrFlashSaleCustomerLimit:
+					atomic.AddInt64(&overLimit, 1)
+				default:
+					atomic.AddInt64(&failed, 1)
+					log.Printf("Checkout %d failed: %v", n, err)
+				}
+			}
+		}()
+	}
+	for n := 0; n < *attempts; n++ {
+		jobs <- n
+	}
+	close(jobs)
+	wg.Wait()
+
+	var claimed, recorded int
+	if err := config.DB.QueryRow(`SELECT claimed FROM flash_sale_items WHERE id = $1`, itemID).Scan(&claimed); err != nil {
+		log.Printf("Failed to read claimed units: %v", err)
+		return
+	}
+	if err := config.DB.QueryRow(`SELECT COALESCE(SUM(quantity), 0) FROM flash_sale_claims WHERE flash_sale_item_id = $1`, itemID).Scan(&recorded); err != nil {
+		log.Printf("Failed to read claims: %v", err)
+		return
+	}
+	var overCap int
+	capQuery := `
+		SELECT COUNT(*) FROM (
+			SELECT user_id FROM flash_sale_claims WHERE flash_sale_item_id = $1
+			GROUP BY user_id HAVING SUM(quantity) > $2
+		) over_cap`
+	if err := config.DB.QueryRow(capQuery, itemID, *limit).Scan(&overCap); err != nil {
+		log.Printf("Failed to check customer caps: %v", err)
+		return
+	}
+
+	fmt.Printf("%d checkouts in %s with %d workers\n", *attempts, time.Since(start).Round(time.Millisecond), *workers)
+	fmt.Printf("  succeeded %d (%d without sale units), claims refused: sold out %d, over customer limit %d, errors %d\n",
+		succeeded, fullPrice, soldOut, overLimit, failed)
+	fmt.Printf("  units on sale %d, claimed %d, claims recorded %d, claimed by successful checkouts %d\n",
+		*units, claimed, recorded, claimedUnits)
+	fmt.Printf("  customers over their cap %d\n", overCap)
+
+	// Units are claimed under the lock they were priced under, so a claim
+	// should never be refused once priced.
+	if claimed > *units || claimed != recorded || int64(claimed) != claimedUnits || overCap > 0 || soldOut > 0 || overLimit > 0 {
+		fmt.Println("FAIL: flash sale oversold")
+		cleanup(saleID)
+		os.Exit(1)
+	}
+	fmt.Println("OK: no oversell")
+}
+
+// checkout puts quantity units of the product in the customer's cart and
+// places a placeholder order for it the way Checkout does: lock, price and
+// claim in one transaction. It returns the units claimed at the sale price.
+func checkout(n, userID, productID, quantity int) (int, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO cart (user_id, product_id, quantity) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, product_id) DO UPDATE SET quantity = $3`, userID, productID, quantity)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := models.LockCartFlashSales(tx, userID); err != nil {
+		return 0, err
+	}
+	pricing, err := models.PriceUserCart(tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	var lines []models.PricedLine
+	units := 0
+	for _, line := range pricing.Lines {
+		if line.ProductID == productID {
+			lines = append(lines, line)
+			units = line.FlashSaleUnits
+		}
+	}
+
+	var orderID int
+	err = tx.QueryRow(`
+		INSERT INTO orders (order_id, user_id, total_amount, payment_method, status)
+		VALUES ($1, $2, $3, 'load-test', 'Cancelled')
+		RETURNING id`, fmt.Sprintf("LOADTEST-%d-%d", time.Now().UnixNano(), n), userID, pricing.Total).Scan(&orderID)
+	if err != nil {
+		return 0, err
+	}
+	if err := models.ClaimFlashSaleUnits(tx, userID, orderID, lines); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM cart WHERE user_id = $1 AND product_id = $2`, userID, productID); err != nil {
+		return 0, err
+	}
+	return units, tx.Commit()
+}
+
+var cleanupOnce sync.Once
+
+func cleanup(saleID int) {
+	cleanupOnce.Do(func() {
+		statements := []string{
+			`DELETE FROM flash_sale_claims WHERE flash_sale_item_id IN (SELECT id FROM flash_sale_items WHERE flash_sale_id = $1)`,
+			`DELETE FROM flash_sales WHERE id = $1`,
+		}
+		for _, statement := range statements {
+			if _, err := config.DB.Exec(statement, saleID); err != nil {
+				log.Printf("Cleanup failed: %v", err)
+			}
+		}
+		if _, err := config.DB.Exec(`DELETE FROM orders WHERE order_id LIKE 'LOADTEST-%' AND payment_method = 'load-test'`); err != nil {
+			log.Printf("Cleanup failed: %v", err)
+		}
+	})
+}
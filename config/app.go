@@ -0,0 +1,15 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// AppBaseURL is the public URL of the storefront, used when building links
+// that are emailed to customers.
+func AppBaseURL() string {
+	if url := os.Getenv("APP_BASE_URL"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	return "https://horizonweb.me"
+}
@@ -36,12 +36,36 @@ func AutoMigrate() {
 	if err := executeSQLFile("sql/users.sql"); err != nil {
 		log.Fatalf("Failed to create users table: %v", err)
 	}
+	if err := executeSQLFile("sql/otp.sql"); err != nil {
+		log.Fatalf("Failed to create otp tables: %v", err)
+	}
+	if err := executeSQLFile("sql/user_identities.sql"); err != nil {
+		log.Fatalf("Failed to create user_identities table: %v", err)
+	}
+	if err := executeSQLFile("sql/login_lockouts.sql"); err != nil {
+		log.Fatalf("Failed to create login_lockouts table: %v", err)
+	}
 	if err := executeSQLFile("sql/categories.sql"); err != nil {
 		log.Fatalf("Failed to create categories table: %v", err)
 	}
 	if err := executeSQLFile("sql/product.sql"); err != nil {
 		log.Fatalf("Failed to create product table: %v", err)
 	}
+	if err := executeSQLFile("sql/product_images.sql"); err != nil {
+		log.Fatalf("Failed to create product_images table: %v", err)
+	}
+	if err := executeSQLFile("sql/stock_alerts.sql"); err != nil {
+		log.Fatalf("Failed to create stock alert tables: %v", err)
+	}
+	if err := executeSQLFile("sql/price_history.sql"); err != nil {
+		log.Fatalf("Failed to create price history table: %v", err)
+	}
+	if err := executeSQLFile("sql/attributes.sql"); err != nil {
+		log.Fatalf("Failed to create attributes table: %v", err)
+	}
+	if err := executeSQLFile("sql/product_imports.sql"); err != nil {
+		log.Fatalf("Failed to create product_import_jobs table: %v", err)
+	}
 	if err := executeSQLFile("sql/address.sql"); err != nil {
 		log.Fatalf("Failed to create address table: %v", err)
 	}
@@ -51,21 +75,63 @@ func AutoMigrate() {
 	if err := executeSQLFile("sql/cart.sql"); err != nil {
 		log.Fatalf("Failed to create cart table: %v", err)
 	}
+	if err := executeSQLFile("sql/guest_carts.sql"); err != nil {
+		log.Fatalf("Failed to create guest cart table: %v", err)
+	}
 	if err := executeSQLFile("sql/order.sql"); err != nil {
 		log.Fatalf("Failed to create order table: %v", err)
 	}
 	if err := executeSQLFile("sql/order_items.sql"); err != nil {
 		log.Fatalf("Failed to create order_items table: %v", err)
 	}
+	if err := executeSQLFile("sql/warehouses.sql"); err != nil {
+		log.Fatalf("Failed to create warehouse tables: %v", err)
+	}
+	if err := executeSQLFile("sql/purchasing.sql"); err != nil {
+		log.Fatalf("Failed to create purchasing tables: %v", err)
+	}
 	if err := executeSQLFile("sql/offer.sql"); err != nil {
 		log.Fatalf("Failed to create offers table: %v", err)
 	}
+	if err := executeSQLFile("sql/brands.sql"); err != nil {
+		log.Fatalf("Failed to create brands table: %v", err)
+	}
+	if err := executeSQLFile("sql/offer_scopes.sql"); err != nil {
+		log.Fatalf("Failed to create offer scopes: %v", err)
+	}
+	if err := executeSQLFile("sql/promotions.sql"); err != nil {
+		log.Fatalf("Failed to create promotions table: %v", err)
+	}
+	if err := executeSQLFile("sql/flash_sales.sql"); err != nil {
+		log.Fatalf("Failed to create flash sale tables: %v", err)
+	}
 	if err := executeSQLFile("sql/coupons.sql"); err != nil {
 		log.Fatalf("Failed to create coupons table: %v", err)
 	}
+	if err := executeSQLFile("sql/coupon_redemptions.sql"); err != nil {
+		log.Fatalf("Failed to create coupon_redemptions table: %v", err)
+	}
+	if err := executeSQLFile("sql/abandoned_carts.sql"); err != nil {
+		log.Fatalf("Failed to create abandoned cart tables: %v", err)
+	}
 	if err := executeSQLFile("sql/wallet.sql"); err != nil {
 		log.Fatalf("Failed to create wallet table: %v", err)
 	}
+	if err := executeSQLFile("sql/referrals.sql"); err != nil {
+		log.Fatalf("Failed to create referrals table: %v", err)
+	}
+	if err := executeSQLFile("sql/recommendations.sql"); err != nil {
+		log.Fatalf("Failed to create recommendations table: %v", err)
+	}
+	if err := executeSQLFile("sql/reviews.sql"); err != nil {
+		log.Fatalf("Failed to create reviews table: %v", err)
+	}
+	if err := executeSQLFile("sql/loyalty.sql"); err != nil {
+		log.Fatalf("Failed to create loyalty tables: %v", err)
+	}
+	if err := executeSQLFile("sql/account_deletion.sql"); err != nil {
+		log.Fatalf("Failed to create account_deletion_requests table: %v", err)
+	}
 
 }
 func executeSQLFile(filePath string) error {
@@ -14,10 +14,19 @@ func InitGoogleOAuth() {
 	GoogleOAuthConfig = &oauth2.Config{
 		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
 		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		RedirectURL:  "https://horizonweb.me/auth/google/callback",
+		RedirectURL:  googleRedirectURL(),
 		Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email", "https://www.googleapis.com/auth/userinfo.profile"},
 		Endpoint:     google.Endpoint,
 	}
 
 	log.Println("Google OAuth initialized")
 }
+
+// googleRedirectURL lets each environment register its own callback, falling
+// back to the storefront's base URL.
+func googleRedirectURL() string {
+	if url := os.Getenv("GOOGLE_REDIRECT_URL"); url != "" {
+		return url
+	}
+	return AppBaseURL() + "/auth/google/callback"
+}
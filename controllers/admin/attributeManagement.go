@@ -0,0 +1,244 @@
+package admin
+
+import (
+	"database/sql"
+	"horizon/config"
+	"horizon/models"
+	queries "horizon/sql"
+	"horizon/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// validateAttribute normalises an attribute definition and returns the first
+// rule it breaks, or "" if it is valid.
+func validateAttribute(attribute *models.AttributeDefinition) string {
+	attribute.Name = strings.TrimSpace(attribute.Name)
+	if len(attribute.Name) < 2 {
+		return "Attribute name must be at least 2 characters long"
+	}
+	attribute.Code = strings.ReplaceAll(utils.Slugify(attribute.Code), "-", "_")
+	if attribute.Code == "" {
+		attribute.Code = strings.ReplaceAll(utils.Slugify(attribute.Name), "-", "_")
+	}
+	attribute.Unit = strings.TrimSpace(attribute.Unit)
+
+	switch attribute.DataType {
+	case models.AttributeText, models.AttributeNumber, models.AttributeBoolean:
+		attribute.AllowedValues = pq.StringArray{}
+	case models.AttributeEnum:
+		var values pq.StringArray
+		for _, value := range attribute.AllowedValues {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			return "Enum attributes need at least one allowed value"
+		}
+		attribute.AllowedValues = values
+	default:
+		return "data_type must be text, number, boolean or enum"
+	}
+	return ""
+}
+
+func AddAttribute(c *fiber.Ctx) error {
+	categoryID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category ID"})
+	}
+
+	attribute := new(models.AttributeDefinition)
+	if err := c.BodyParser(attribute); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	attribute.CategoryID = categoryID
+	if msg := validateAttribute(attribute); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	var exists bool
+	if err := config.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM categories WHERE id=$1 AND deleted=false)`, categoryID).Scan(&exists); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check category"})
+	}
+	if !exists {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Category not found or deleted"})
+	}
+
+	query := `
+		INSERT INTO attribute_definitions (category_id, name, code, data_type, unit, allowed_values, filterable, sort_order)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8)
+		RETURNING id`
+	err = config.DB.QueryRow(query, categoryID, attribute.Name, attribute.Code, attribute.DataType, attribute.Unit,
+		attribute.AllowedValues, attribute.Filterable, attribute.SortOrder).Scan(&attribute.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Attribute code already exists in this category"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add attribute"})
+	}
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Attribute added successfully", "attribute": attribute})
+}
+
+// EditAttribute updates a definition. Its data type is fixed once created so
+// stored product values stay valid.
+func EditAttribute(c *fiber.Ctx) error {
+	attributeID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid attribute ID"})
+	}
+
+	var current models.AttributeDefinition
+	err = config.DB.Get(&current, `SELECT id, category_id, name, code, data_type, COALESCE(unit, '') AS unit, allowed_values, filterable, sort_order FROM attribute_definitions WHERE id=$1`, attributeID)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Attribute not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch attribute"})
+	}
+
+	attribute := new(models.AttributeDefinition)
+	if err := c.BodyParser(attribute); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	attribute.ID = current.ID
+	attribute.CategoryID = current.CategoryID
+	attribute.DataType = current.DataType
+	if msg := validateAttribute(attribute); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	query := `
+		UPDATE attribute_definitions
+		SET name=$1, code=$2, unit=NULLIF($3, ''), allowed_values=$4, filterable=$5, sort_order=$6
+		WHERE id=$7`
+	_, err = config.DB.Exec(query, attribute.Name, attribute.Code, attribute.Unit, attribute.AllowedValues, attribute.Filterable, attribute.SortOrder, attributeID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Attribute code already exists in this category"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update attribute"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Attribute updated successfully", "attribute": attribute})
+}
+
+// DeleteAttribute removes a definition together with every product value
+// stored for it.
+func DeleteAttribute(c *fiber.Ctx) error {
+	attributeID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid attribute ID"})
+	}
+
+	result, err := config.DB.Exec(`DELETE FROM attribute_definitions WHERE id=$1`, attributeID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete attribute"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Attribute not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Attribute deleted successfully"})
+}
+
+func ViewCategoryAttributes(c *fiber.Ctx) error {
+	categoryID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category ID"})
+	}
+
+	attributes := []models.AttributeDefinition{}
+	if err := config.DB.Select(&attributes, queries.CategoryAttributesQuery, categoryID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch attributes"})
+	}
+
+	return c.JSON(fiber.Map{"attributes": attributes})
+}
+
+// SetProductAttributes stores attribute values for a product, keyed by
+// attribute code. Only attributes of the product's category or its ancestors
+// are accepted; a null value removes the stored value.
+func SetProductAttributes(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var req struct {
+		Values map[string]interface{} `json:"values"`
+	}
+	if err := c.BodyParser(&req); err != nil || len(req.Values) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "values must map attribute codes to values"})
+	}
+
+	var categoryID int
+	err = config.DB.QueryRow(`SELECT category_id FROM products WHERE id=$1 AND deleted=false`, productID).Scan(&categoryID)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found or unavailable"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch product"})
+	}
+
+	var attributes []models.AttributeDefinition
+	if err := config.DB.Select(&attributes, queries.CategoryAttributesQuery, categoryID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch attributes"})
+	}
+	byCode := map[string]models.AttributeDefinition{}
+	for _, attribute := range attributes {
+		// A subcategory's own definition overrides an inherited one with the same code.
+		if _, ok := byCode[attribute.Code]; !ok || attribute.CategoryID == categoryID {
+			byCode[attribute.Code] = attribute
+		}
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save attributes"})
+	}
+	defer tx.Rollback()
+
+	errors := fiber.Map{}
+	for code, raw := range req.Values {
+		attribute, ok := byCode[code]
+		if !ok {
+			errors[code] = "Unknown attribute for this product's category"
+			continue
+		}
+
+		if raw == nil {
+			if _, err := tx.Exec(`DELETE FROM product_attribute_values WHERE product_id=$1 AND attribute_id=$2`, productID, attribute.ID); err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save attributes"})
+			}
+			continue
+		}
+
+		value, number, err := attribute.NormalizeValue(raw)
+		if err != nil {
+			errors[code] = err.Error()
+			continue
+		}
+		query := `
+			INSERT INTO product_attribute_values (product_id, attribute_id, value, value_number)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (product_id, attribute_id) DO UPDATE SET value = $3, value_number = $4`
+		if _, err := tx.Exec(query, productID, attribute.ID, value, number); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save attributes"})
+		}
+	}
+
+	if len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Some attribute values are invalid", "details": errors})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save attributes"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Product attributes updated successfully"})
+}
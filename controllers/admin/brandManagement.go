@@ -0,0 +1,213 @@
+package admin
+
+import (
+	"database/sql"
+	"fmt"
+	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// saveBrandLogo stores an optional "logo" upload and returns its key, or ""
+// when none was sent.
+func saveBrandLogo(c *fiber.Ctx) (string, error) {
+	header, err := c.FormFile("logo")
+	if err != nil {
+		return "", nil
+	}
+	if header.Size > utils.MaxImageSize {
+		return "", utils.ErrImageTooLarge
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, utils.MaxImageSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	renditions, err := utils.ProcessImage(data)
+	if err != nil {
+		return "", err
+	}
+	name, err := utils.RandomToken(12)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("brands/%s%s", name, renditions.RenditionExt)
+	if err := utils.Storage().Save(key, renditions.Medium); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func parseBrand(c *fiber.Ctx) (*models.Brand, string) {
+	brand := new(models.Brand)
+	if err := c.BodyParser(brand); err != nil {
+		return nil, "Invalid input"
+	}
+	brand.Name = strings.TrimSpace(brand.Name)
+	if len(brand.Name) < 2 {
+		return nil, "Brand name must be at least 2 characters long"
+	}
+	brand.Description = strings.TrimSpace(brand.Description)
+	brand.Slug = utils.Slugify(brand.Slug)
+	if brand.Slug == "" {
+		brand.Slug = utils.Slugify(brand.Name)
+	}
+	return brand, ""
+}
+
+func AddBrand(c *fiber.Ctx) error {
+	brand, msg := parseBrand(c)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	logoKey, err := saveBrandLogo(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	brand.LogoKey = logoKey
+
+	query := `
+		INSERT INTO brands (name, slug, description, logo_key)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
+		RETURNING id`
+	err = config.DB.QueryRow(query, brand.Name, brand.Slug, brand.Description, brand.LogoKey).Scan(&brand.ID)
+	if err != nil {
+		if logoKey != "" {
+			utils.Storage().Delete(logoKey)
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Brand name or slug already exists"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add brand"})
+	}
+
+	brand.ResolveLogo()
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Brand added successfully", "brand": brand})
+}
+
+// EditBrand updates a brand. A new logo upload replaces the old one, whose
+// file is queued for cleanup.
+func EditBrand(c *fiber.Ctx) error {
+	brandID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid brand ID"})
+	}
+	brand, msg := parseBrand(c)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	brand.ID = brandID
+
+	var oldLogo string
+	err = config.DB.QueryRow(`SELECT COALESCE(logo_key, '') FROM brands WHERE id=$1 AND deleted=false`, brandID).Scan(&oldLogo)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Brand not found or deleted"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch brand"})
+	}
+
+	logoKey, err := saveBrandLogo(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	brand.LogoKey = oldLogo
+	if logoKey != "" {
+		brand.LogoKey = logoKey
+	}
+
+	query := `
+		UPDATE brands
+		SET name=$1, slug=$2, description=NULLIF($3, ''), logo_key=NULLIF($4, ''), updated_at=NOW()
+		WHERE id=$5`
+	if _, err := config.DB.Exec(query, brand.Name, brand.Slug, brand.Description, brand.LogoKey, brandID); err != nil {
+		if logoKey != "" {
+			utils.Storage().Delete(logoKey)
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Brand name or slug already exists"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update brand"})
+	}
+
+	if logoKey != "" && oldLogo != "" {
+		config.DB.Exec(`INSERT INTO file_deletions (file_key) VALUES ($1)`, oldLogo)
+	}
+
+	brand.ResolveLogo()
+	return c.JSON(fiber.Map{"message": "Brand updated successfully", "brand": brand})
+}
+
+// SoftDeleteBrand hides a brand from the storefront. Its products stay
+// listed, just without a brand.
+func SoftDeleteBrand(c *fiber.Ctx) error {
+	brandID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid brand ID"})
+	}
+
+	result, err := config.DB.Exec(`UPDATE brands SET deleted=true, updated_at=NOW() WHERE id=$1 AND deleted=false`, brandID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete brand"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Brand not found or already deleted"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Brand deleted successfully"})
+}
+
+func RecoverBrand(c *fiber.Ctx) error {
+	brandID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid brand ID"})
+	}
+
+	result, err := config.DB.Exec(`UPDATE brands SET deleted=false, updated_at=NOW() WHERE id=$1 AND deleted=true`, brandID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to recover brand"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Brand not found or not deleted"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Brand recovered successfully"})
+}
+
+func AdminViewBrands(c *fiber.Ctx) error {
+	brands := []models.Brand{}
+	query := `SELECT id, name, slug, COALESCE(description, '') AS description, COALESCE(logo_key, '') AS logo_key, deleted FROM brands ORDER BY name`
+	if err := config.DB.Select(&brands, query); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch brands"})
+	}
+	for i := range brands {
+		brands[i].ResolveLogo()
+	}
+
+	return c.JSON(fiber.Map{"brands": brands})
+}
+
+// validateProductBrand checks that brandID, when set, names a live brand.
+func validateProductBrand(brandID *int) string {
+	if brandID == nil {
+		return ""
+	}
+	var exists bool
+	if err := config.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM brands WHERE id=$1 AND deleted=false)`, *brandID).Scan(&exists); err != nil || !exists {
+		return "Brand not found or deleted"
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UpdateCartRecoverySettings sets when carts count as abandoned, how many
+// reminders they get and whether the first one carries a coupon.
+func UpdateCartRecoverySettings(c *fiber.Ctx) error {
+	var req models.CartRecoverySettings
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	switch {
+	case req.IdleHours <= 0 || req.ReminderIntervalHours <= 0 || req.AttributionDays <= 0:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "idle_hours, reminder_interval_hours and attribution_days must be positive"})
+	case req.MaxReminders < 0:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "max_reminders cannot be negative"})
+	case req.CouponPercentage <= 0 || req.CouponPercentage > 100:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "coupon_percentage must be between 0 and 100"})
+	case req.CouponMaxDiscount <= 0 || req.CouponValidityHours <= 0:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "coupon_max_discount and coupon_validity_hours must be positive"})
+	}
+
+	query := `
+		UPDATE cart_recovery_settings
+		SET active = $1, idle_hours = $2, max_reminders = $3, reminder_interval_hours = $4, attribution_days = $5,
+		    coupon_enabled = $6, coupon_percentage = $7, coupon_max_discount = $8, coupon_validity_hours = $9
+		RETURNING ` + models.CartRecoverySettingsColumns
+	settings, err := models.ScanCartRecoverySettings(config.DB.QueryRow(query, req.Active, req.IdleHours, req.MaxReminders,
+		req.ReminderIntervalHours, req.AttributionDays, req.CouponEnabled, req.CouponPercentage, req.CouponMaxDiscount,
+		req.CouponValidityHours))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update cart recovery settings"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Cart recovery settings updated successfully", "settings": settings})
+}
+
+// AbandonedCartReport summarises carts abandoned between start and end: how
+// many were reminded and recovered, the revenue recovered and how the
+// recovery coupons did. value_at_risk and open_carts cover every cart still
+// open, whenever it was abandoned. Both dates default to the current month.
+func AbandonedCartReport(c *fiber.Ctx) error {
+	now := time.Now()
+	startDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	endDate := now
+
+	var err error
+	if start := c.Query("start"); start != "" {
+		if startDate, err = time.Parse("2006-01-02", start); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid start date"})
+		}
+	}
+	if end := c.Query("end"); end != "" {
+		if endDate, err = time.Parse("2006-01-02", end); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid end date"})
+		}
+		endDate = endDate.AddDate(0, 0, 1)
+	}
+
+	var summary struct {
+		Abandoned       int     `json:"abandoned" db:"abandoned"`
+		AbandonedValue  float64 `json:"abandoned_value" db:"abandoned_value"`
+		Reminded        int     `json:"reminded" db:"reminded"`
+		RemindersSent   int     `json:"reminders_sent" db:"reminders_sent"`
+		Open            int     `json:"open" db:"open"`
+		Recovered       int     `json:"recovered" db:"recovered"`
+		RecoveredValue  float64 `json:"recovered_value" db:"recovered_value"`
+		Lost            int     `json:"lost" db:"lost"`
+		RecoveryRate    float64 `json:"recovery_rate" db:"recovery_rate"`
+		CouponsIssued   int     `json:"coupons_issued" db:"coupons_issued"`
+		CouponsRedeemed int     `json:"coupons_redeemed" db:"coupons_redeemed"`
+	}
+	summaryQuery := `
+		SELECT COUNT(*) AS abandoned,
+		       COALESCE(SUM(cart_value), 0) AS abandoned_value,
+		       COUNT(*) FILTER (WHERE reminders_sent > 0) AS reminded,
+		       COALESCE(SUM(reminders_sent), 0) AS reminders_sent,
+		       COUNT(*) FILTER (WHERE status = 'Open') AS open,
+		       COUNT(*) FILTER (WHERE status = 'Recovered') AS recovered,
+		       COALESCE(SUM(recovered_value), 0) AS recovered_value,
+		       COUNT(*) FILTER (WHERE status = 'Lost') AS lost,
+		       ROUND(COALESCE(100.0 * COUNT(*) FILTER (WHERE status = 'Recovered') / NULLIF(COUNT(*), 0), 0), 2) AS recovery_rate,
+		       COUNT(coupon_id) AS coupons_issued,
+		       COUNT(*) FILTER (WHERE EXISTS (
+		           SELECT 1 FROM coupon_redemptions cr
+		           WHERE cr.coupon_id = a.coupon_id AND cr.order_id = a.recovered_order_id AND cr.status = 'Redeemed'
+		       )) AS coupons_redeemed
+		FROM abandoned_carts a
+		WHERE detected_at >= $1 AND detected_at < $2`
+	if err := config.DB.Get(&summary, summaryQuery, startDate, endDate); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to compute abandoned cart summary"})
+	}
+
+	var valueAtRisk float64
+	if err := config.DB.Get(&valueAtRisk, `SELECT COALESCE(SUM(cart_value), 0) FROM abandoned_carts WHERE status = 'Open'`); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to compute value at risk"})
+	}
+
+	openCarts := []models.AbandonedCart{}
+	openQuery := `
+		SELECT a.id, a.user_id, u.name, u.email, a.status, a.item_count, a.cart_value, a.reminders_sent,
+		       a.last_activity_at, a.last_reminded_at, cp.code AS coupon_code, a.detected_at
+		FROM abandoned_carts a
+		JOIN users u ON u.id = a.user_id
+		LEFT JOIN coupons cp ON cp.id = a.coupon_id
+		WHERE a.status = 'Open'
+		ORDER BY a.cart_value DESC
+		LIMIT 50`
+	if err := config.DB.Select(&openCarts, openQuery); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch open carts"})
+	}
+
+	settings, err := models.LoadCartRecoverySettings(config.DB)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch cart recovery settings"})
+	}
+
+	return c.JSON(fiber.Map{
+		"start":         startDate.Format("2006-01-02"),
+		"end":           endDate.AddDate(0, 0, -1).Format("2006-01-02"),
+		"settings":      settings,
+		"summary":       summary,
+		"value_at_risk": valueAtRisk,
+		"open_carts":    openCarts,
+	})
+}
@@ -1,15 +1,51 @@
 package admin
 
 import (
+	"database/sql"
 	"fmt"
 	"horizon/config"
 	"horizon/models"
+	queries "horizon/sql"
+	"horizon/utils"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
 )
 
+// validateCategoryParent checks that parentID names a live category that is
+// not categoryID itself or one of its descendants.
+func validateCategoryParent(categoryID int, parentID *int) (int, string) {
+	if parentID == nil {
+		return 0, ""
+	}
+
+	var deleted bool
+	err := config.DB.QueryRow(`SELECT deleted FROM categories WHERE id=$1`, *parentID).Scan(&deleted)
+	if err == sql.ErrNoRows || (err == nil && deleted) {
+		return http.StatusBadRequest, "Parent category not found or deleted"
+	}
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to check parent category"
+	}
+
+	if categoryID == 0 {
+		return 0, ""
+	}
+	var subtree []int
+	if err := config.DB.Select(&subtree, queries.CategorySubtreeQuery, categoryID); err != nil {
+		return http.StatusInternalServerError, "Failed to check category hierarchy"
+	}
+	for _, id := range subtree {
+		if id == *parentID {
+			return http.StatusBadRequest, "A category cannot be moved under itself or one of its subcategories"
+		}
+	}
+	return 0, ""
+}
+
 func AddCategory(c *fiber.Ctx) error {
 	category := new(models.Category)
 
@@ -22,9 +58,24 @@ func AddCategory(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Category name must be at least 3 characters long"})
 	}
 
-	query := `INSERT INTO categories (name, description) VALUES ($1, $2) RETURNING id`
-	err := config.DB.QueryRow(query, category.Name, category.Description).Scan(&category.ID)
+	category.Slug = utils.Slugify(category.Slug)
+	if category.Slug == "" {
+		category.Slug = utils.Slugify(category.Name)
+	}
+
+	if status, msg := validateCategoryParent(0, category.ParentID); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	query := `
+		INSERT INTO categories (name, description, parent_id, slug, sort_order, image_url)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		RETURNING id`
+	err := config.DB.QueryRow(query, category.Name, category.Description, category.ParentID, category.Slug, category.SortOrder, category.ImageURL).Scan(&category.ID)
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Category name or slug already exists"})
+		}
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add category"})
 	}
 
@@ -43,9 +94,24 @@ func EditCategory(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Category name must be at least 3 characters long and cannot be just spaces"})
 	}
 
-	query := `UPDATE categories SET name=$1, description=$2 WHERE id=$3 AND deleted=false`
-	result, err := config.DB.Exec(query, category.Name, category.Description, category.ID)
+	category.Slug = utils.Slugify(category.Slug)
+	if category.Slug == "" {
+		category.Slug = utils.Slugify(category.Name)
+	}
+
+	if status, msg := validateCategoryParent(category.ID, category.ParentID); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	query := `
+		UPDATE categories
+		SET name=$1, description=$2, parent_id=$3, slug=$4, sort_order=$5, image_url=NULLIF($6, ''), updated_at=NOW()
+		WHERE id=$7 AND deleted=false`
+	result, err := config.DB.Exec(query, category.Name, category.Description, category.ParentID, category.Slug, category.SortOrder, category.ImageURL, category.ID)
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Category name or slug already exists"})
+		}
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update category"})
 	}
 
@@ -57,28 +123,111 @@ func EditCategory(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Category updated successfully"})
 }
 
+// SoftDeleteCategory deletes a category together with its subcategories and
+// their products. Items removed this way are flagged deleted_by_cascade so
+// RecoverCategory can bring back exactly what it took down.
 func SoftDeleteCategory(c *fiber.Ctx) error {
-	categoryID := c.Params("id")
-	query := `UPDATE categories SET deleted=true WHERE id=$1`
-	_, err := config.DB.Exec(query, categoryID)
+	categoryID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category ID"})
+	}
+
+	var subtree []int
+	if err := config.DB.Select(&subtree, queries.CategorySubtreeQuery, categoryID); err != nil || len(subtree) == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+	}
+
+	tx, err := config.DB.Begin()
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete category"})
 	}
+	defer tx.Rollback()
 
-	return c.JSON(fiber.Map{"message": "Category deleted successfully"})
+	if _, err := tx.Exec(`UPDATE categories SET deleted=true, deleted_by_cascade=false WHERE id=$1`, categoryID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete category"})
+	}
+
+	childQuery := `UPDATE categories SET deleted=true, deleted_by_cascade=true WHERE id = ANY($1) AND id <> $2 AND deleted=false`
+	if _, err := tx.Exec(childQuery, pq.Array(subtree), categoryID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete subcategories"})
+	}
+
+	productQuery := `UPDATE products SET deleted=true, deleted_by_cascade=true, deleted_at=NOW() WHERE category_id = ANY($1) AND deleted=false`
+	result, err := tx.Exec(productQuery, pq.Array(subtree))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete category products"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete category"})
+	}
+
+	productsDeleted, _ := result.RowsAffected()
+	return c.JSON(fiber.Map{
+		"message":              "Category deleted successfully",
+		"subcategories":        len(subtree) - 1,
+		"products_deactivated": productsDeleted,
+	})
 }
 func RecoverCategory(c *fiber.Ctx) error {
-	categoryID := c.Params("id")
-	query := `UPDATE categories SET deleted=false WHERE id=$1`
-	_, err := config.DB.Exec(query, categoryID)
+	categoryID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category ID"})
+	}
+
+	var parentDeleted bool
+	parentQuery := `
+		SELECT COALESCE(p.deleted, false)
+		FROM categories c
+		LEFT JOIN categories p ON c.parent_id = p.id
+		WHERE c.id = $1`
+	err = config.DB.QueryRow(parentQuery, categoryID).Scan(&parentDeleted)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to recover category"})
+	}
+	if parentDeleted {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Recover the parent category first"})
+	}
+
+	// Walk down only through categories that were deleted along with this
+	// one; a subcategory deleted on its own stays deleted with its subtree.
+	var restore []int
+	restoreQuery := `
+		WITH RECURSIVE restore AS (
+			SELECT id FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id FROM categories c JOIN restore r ON c.parent_id = r.id WHERE c.deleted_by_cascade
+		)
+		SELECT id FROM restore`
+	if err := config.DB.Select(&restore, restoreQuery, categoryID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to recover category"})
+	}
+
+	tx, err := config.DB.Begin()
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to recover category"})
 	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE categories SET deleted=false, deleted_by_cascade=false WHERE id = ANY($1)`, pq.Array(restore)); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to recover category"})
+	}
+	productQuery := `UPDATE products SET deleted=false, deleted_by_cascade=false, deleted_at=NULL WHERE category_id = ANY($1) AND deleted_by_cascade`
+	if _, err := tx.Exec(productQuery, pq.Array(restore)); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to recover category products"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to recover category"})
+	}
 	return c.JSON(fiber.Map{"message": "Category retreived successfully!"})
 }
 
 func AdminViewCategories(c *fiber.Ctx) error {
-	query := `SELECT id, name, description,deleted FROM categories `
+	query := `SELECT id, name, COALESCE(description, ''), parent_id, COALESCE(slug, ''), sort_order, COALESCE(image_url, ''), deleted FROM categories ORDER BY sort_order, name`
 	rows, err := config.DB.Query(query)
 	if err != nil {
 		fmt.Println(err)
@@ -89,7 +238,8 @@ func AdminViewCategories(c *fiber.Ctx) error {
 	var categories []models.Category
 	for rows.Next() {
 		var category models.Category
-		if err := rows.Scan(&category.ID, &category.Name, &category.Description, &category.Deleted); err != nil {
+		if err := rows.Scan(&category.ID, &category.Name, &category.Description, &category.ParentID, &category.Slug, &category.SortOrder, &category.ImageURL, &category.Deleted); err != nil {
+			log.Println(err)
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse categories"})
 		}
 
@@ -1,69 +1,139 @@
 package admin
 
 import (
+	"database/sql"
+	"fmt"
 	"horizon/config"
 	"horizon/models"
+	"horizon/utils"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
 )
 
-func CreateCoupon(c *fiber.Ctx) error {
-	var coupon models.Coupon
-	if err := c.BodyParser(&coupon); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
-	}
-
-	if coupon.Code == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Coupon code is required"})
-	}
-
+// validateCouponRules checks the fields a coupon and a batch of codes share
+// and returns the coupon's running dates.
+func validateCouponRules(coupon *models.Coupon) (time.Time, time.Time, string) {
+	var startDate, endDate time.Time
 	if coupon.DiscountPercentage <= 0 || coupon.DiscountPercentage > 100 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Discount percentage must be between 1 and 100"})
+		return startDate, endDate, "Discount percentage must be between 1 and 100"
 	}
 
 	if coupon.MaxDiscountAmount < 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Max discount amount must be non-negative"})
+		return startDate, endDate, "Max discount amount must be non-negative"
 	}
 
 	if coupon.MinOrderAmount < 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Min order amount must be non-negative"})
+		return startDate, endDate, "Min order amount must be non-negative"
 	}
 
 	startDate, err := time.Parse(time.RFC3339, coupon.StartDate)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid start date format"})
+		return startDate, endDate, "Invalid start date format"
 	}
-	endDate, err := time.Parse(time.RFC3339, coupon.EndDate)
+	endDate, err = time.Parse(time.RFC3339, coupon.EndDate)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid end date format"})
+		return startDate, endDate, "Invalid end date format"
 	}
 	if endDate.Before(startDate) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "End date must be after start date"})
+		return startDate, endDate, "End date must be after start date"
 	}
 
-	if coupon.UsageLimit < 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Usage limit must be non-negative"})
+	if coupon.PerUserLimit != nil && *coupon.PerUserLimit <= 0 {
+		return startDate, endDate, "Per-user limit must be positive"
 	}
-
-	var existingCouponCount int
-	checkCouponQuery := `SELECT COUNT(*) FROM coupons WHERE code = $1`
-	err = config.DB.QueryRow(checkCouponQuery, coupon.Code).Scan(&existingCouponCount)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check coupon code uniqueness"})
+	for _, segment := range coupon.Segments {
+		if segment != models.SegmentNew && segment != models.SegmentReturning && segment != models.SegmentVIP {
+			return startDate, endDate, "Unknown customer segment: " + segment
+		}
 	}
-	if existingCouponCount > 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Coupon code already exists"})
+	if len(coupon.CategoryIDs) > 0 {
+		var found int
+		query := `SELECT COUNT(*) FROM categories WHERE id = ANY($1) AND deleted = false`
+		if err := config.DB.QueryRow(query, pq.Array(coupon.CategoryIDs)).Scan(&found); err != nil || found != len(coupon.CategoryIDs) {
+			return startDate, endDate, "Some categories were not found or are deleted"
+		}
+	}
+	if len(coupon.UserIDs) > 0 {
+		var found int
+		query := `SELECT COUNT(*) FROM users WHERE id = ANY($1)`
+		if err := config.DB.QueryRow(query, pq.Array(coupon.UserIDs)).Scan(&found); err != nil || found != len(coupon.UserIDs) {
+			return startDate, endDate, "Some users were not found"
+		}
 	}
+	return startDate, endDate, ""
+}
 
+// insertCoupon stores a coupon with its targeted users, skipping it if the
+// code is taken. It returns 0 in that case.
+func insertCoupon(tx *sql.Tx, coupon models.Coupon, startDate, endDate time.Time) (int, error) {
+	if coupon.Segments == nil {
+		coupon.Segments = []string{}
+	}
+	if coupon.CategoryIDs == nil {
+		coupon.CategoryIDs = []int64{}
+	}
 	query := `
-        INSERT INTO coupons (code, discount_percentage, max_discount_amount, min_order_amount, start_date, end_date, usage_limit) 
-        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        INSERT INTO coupons (code, discount_percentage, max_discount_amount, min_order_amount, start_date, end_date, usage_limit,
+                             per_user_limit, first_order_only, segments, category_ids, batch_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+        ON CONFLICT (code) DO NOTHING
         RETURNING id
     `
 	var couponID int
-	err = config.DB.QueryRow(query, coupon.Code, coupon.DiscountPercentage, coupon.MaxDiscountAmount, coupon.MinOrderAmount, startDate, endDate, coupon.UsageLimit).Scan(&couponID)
+	err := tx.QueryRow(query, coupon.Code, coupon.DiscountPercentage, coupon.MaxDiscountAmount, coupon.MinOrderAmount, startDate, endDate,
+		coupon.UsageLimit, coupon.PerUserLimit, coupon.FirstOrderOnly, pq.Array(coupon.Segments), pq.Array(coupon.CategoryIDs), coupon.BatchID).Scan(&couponID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
 	if err != nil {
+		return 0, err
+	}
+
+	for _, userID := range coupon.UserIDs {
+		if _, err := tx.Exec(`INSERT INTO coupon_users (coupon_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, couponID, userID); err != nil {
+			return 0, err
+		}
+	}
+	return couponID, nil
+}
+
+func CreateCoupon(c *fiber.Ctx) error {
+	var coupon models.Coupon
+	if err := c.BodyParser(&coupon); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	if coupon.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Coupon code is required"})
+	}
+
+	startDate, endDate, msg := validateCouponRules(&coupon)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if coupon.UsageLimit <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Usage limit must be positive"})
+	}
+	coupon.BatchID = nil
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	couponID, err := insertCoupon(tx, coupon, startDate, endDate)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create coupon"})
+	}
+	if couponID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Coupon code already exists"})
+	}
+	if err := tx.Commit(); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create coupon"})
 	}
 
@@ -72,12 +142,144 @@ func CreateCoupon(c *fiber.Ctx) error {
 		"couponID": couponID,
 	})
 }
+
+const maxCouponBatch = 5000
+
+// GenerateCouponBatch creates a campaign's worth of single-use codes: each
+// can be redeemed once, by one customer. The codes are returned so they can
+// be handed out, and can be fetched again with ViewCouponBatch.
+func GenerateCouponBatch(c *fiber.Ctx) error {
+	var req struct {
+		models.Coupon
+		Campaign string `json:"campaign"`
+		Prefix   string `json:"prefix"`
+		Quantity int    `json:"quantity"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	req.Campaign = strings.TrimSpace(req.Campaign)
+	req.Prefix = strings.ToUpper(strings.TrimSpace(req.Prefix))
+	if req.Campaign == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Campaign name is required"})
+	}
+	if len(req.Prefix) > 20 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Prefix must be at most 20 characters"})
+	}
+	if req.Quantity <= 0 || req.Quantity > maxCouponBatch {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Quantity must be between 1 and %d", maxCouponBatch)})
+	}
+
+	coupon := req.Coupon
+	startDate, endDate, msg := validateCouponRules(&coupon)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	single := 1
+	coupon.UsageLimit = 1
+	coupon.PerUserLimit = &single
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	var batchID int
+	err = tx.QueryRow(`INSERT INTO coupon_batches (campaign, prefix, quantity) VALUES ($1, $2, $3) RETURNING id`,
+		req.Campaign, req.Prefix, req.Quantity).Scan(&batchID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create coupon batch"})
+	}
+	coupon.BatchID = &batchID
+
+	// Codes that collide with an existing one are simply drawn again.
+	codes := make([]string, 0, req.Quantity)
+	for attempts := 0; len(codes) < req.Quantity; attempts++ {
+		if attempts > 2*req.Quantity+10 {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate unique codes"})
+		}
+		code, err := utils.GenerateCouponCode(req.Prefix, 8)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate codes"})
+		}
+		coupon.Code = code
+		couponID, err := insertCoupon(tx, coupon, startDate, endDate)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create coupons"})
+		}
+		if couponID != 0 {
+			codes = append(codes, code)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create coupon batch"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "Coupon batch generated successfully",
+		"batch_id": batchID,
+		"codes":    codes,
+	})
+}
+
+func AdminViewCouponBatches(c *fiber.Ctx) error {
+	var batches []struct {
+		ID        int    `json:"id" db:"id"`
+		Campaign  string `json:"campaign" db:"campaign"`
+		Prefix    string `json:"prefix" db:"prefix"`
+		Quantity  int    `json:"quantity" db:"quantity"`
+		Redeemed  int    `json:"redeemed" db:"redeemed"`
+		CreatedAt string `json:"created_at" db:"created_at"`
+	}
+	query := `
+		SELECT b.id, b.campaign, b.prefix, b.quantity, b.created_at,
+		       (SELECT COUNT(*) FROM coupons c WHERE c.batch_id = b.id AND c.used_count > 0) AS redeemed
+		FROM coupon_batches b
+		ORDER BY b.created_at DESC`
+	if err := config.DB.Select(&batches, query); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch coupon batches"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Coupon batches fetched successfully",
+		"batches": batches,
+	})
+}
+
+func ViewCouponBatch(c *fiber.Ctx) error {
+	batchID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid batch ID"})
+	}
+
+	var codes []struct {
+		Code     string `json:"code" db:"code"`
+		Redeemed bool   `json:"redeemed" db:"redeemed"`
+	}
+	query := `SELECT code, used_count > 0 AS redeemed FROM coupons WHERE batch_id = $1 ORDER BY id`
+	if err := config.DB.Select(&codes, query, batchID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch coupon codes"})
+	}
+	if len(codes) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Coupon batch not found"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Coupon codes fetched successfully",
+		"codes":   codes,
+	})
+}
+
+// ViewCouponsAdmin lists running coupons; batch codes and cart recovery
+// coupons are listed with their batch or cart instead.
 func ViewCouponsAdmin(c *fiber.Ctx) error {
 	query := `
-        SELECT id, code, discount_percentage, max_discount_amount, min_order_amount, start_date, end_date, usage_limit, used_count, created_at, updated_at
-        FROM coupons
-        WHERE end_date >= NOW()
-    `
+		SELECT ` + models.CouponColumns + ` FROM coupons
+		WHERE end_date >= NOW() AND batch_id IS NULL
+		  AND id NOT IN (SELECT coupon_id FROM abandoned_carts WHERE coupon_id IS NOT NULL)`
 	rows, err := config.DB.Query(query)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch coupons"})
@@ -86,8 +288,8 @@ func ViewCouponsAdmin(c *fiber.Ctx) error {
 
 	var coupons []models.Coupon
 	for rows.Next() {
-		var coupon models.Coupon
-		if err := rows.Scan(&coupon.ID, &coupon.Code, &coupon.DiscountPercentage, &coupon.MaxDiscountAmount, &coupon.MinOrderAmount, &coupon.StartDate, &coupon.EndDate, &coupon.UsageLimit, &coupon.UsedCount, &coupon.CreatedAt, &coupon.UpdatedAt); err != nil {
+		coupon, err := models.ScanCoupon(rows)
+		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse coupons"})
 		}
 		coupons = append(coupons, coupon)
@@ -145,6 +145,12 @@ func FetchDashboardData(period string) (models.DashboardData, error) {
 		return data, err
 	}
 
+	queryLowStock := `SELECT COUNT(id) FROM stock_alerts WHERE resolved_at IS NULL`
+	err = config.DB.QueryRow(queryLowStock).Scan(&data.LowStockProducts)
+	if err != nil {
+		return data, err
+	}
+
 	return data, nil
 }
 
@@ -213,6 +219,8 @@ func GenerateDashboardPDF(data models.DashboardData, period string) error {
 
 	createSection(pdf, "Total Revenue:", fmt.Sprintf("%.2f", data.Revenue))
 
+	createSection(pdf, "Products Below Reorder Threshold:", fmt.Sprintf("%d", data.LowStockProducts))
+
 	err := pdf.OutputFileAndClose("dashboard_report.pdf")
 	if err != nil {
 		return fmt.Errorf("error generating PDF: %v", err)
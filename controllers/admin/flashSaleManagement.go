@@ -0,0 +1,156 @@
+package admin
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// CreateFlashSale schedules a flash sale. Each item offers a fixed number of
+// units of a product at a discount, with a cap on how many one customer may
+// buy. A product cannot be in two flash sales that overlap.
+func CreateFlashSale(c *fiber.Ctx) error {
+	var req struct {
+		Name      string    `json:"name"`
+		StartTime time.Time `json:"start_time"`
+		EndTime   time.Time `json:"end_time"`
+		Items     []struct {
+			ProductID          int     `json:"product_id"`
+			DiscountPercentage float64 `json:"discount_percentage"`
+			Quantity           int     `json:"quantity"`
+			PerCustomerLimit   int     `json:"per_customer_limit"`
+		} `json:"items"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Flash sale name is required"})
+	}
+	if !req.EndTime.After(req.StartTime) || !req.EndTime.After(time.Now()) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "end_time must be after start_time and in the future"})
+	}
+	if len(req.Items) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "A flash sale needs at least one item"})
+	}
+
+	productIDs := make([]int, 0, len(req.Items))
+	seen := map[int]bool{}
+	for i, item := range req.Items {
+		if item.DiscountPercentage <= 0 || item.DiscountPercentage > 100 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "discount_percentage must be between 0 and 100"})
+		}
+		if item.Quantity <= 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "quantity must be positive"})
+		}
+		if item.PerCustomerLimit == 0 {
+			req.Items[i].PerCustomerLimit = 1
+		} else if item.PerCustomerLimit < 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "per_customer_limit must be positive"})
+		}
+		if seen[item.ProductID] {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Each product can appear only once in a flash sale"})
+		}
+		seen[item.ProductID] = true
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	var found int
+	if err := config.DB.Get(&found, `SELECT COUNT(*) FROM products WHERE id = ANY($1) AND deleted = false`, pq.Array(productIDs)); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check products"})
+	}
+	if found != len(productIDs) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "One or more products do not exist"})
+	}
+
+	tx, err := config.DB.Beginx()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	// Serialise sale creation so two overlapping sales cannot both pass the
+	// overlap check.
+	if _, err := tx.Exec(`LOCK TABLE flash_sales IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create flash sale"})
+	}
+	var clashing []int64
+	overlapQuery := `
+		SELECT DISTINCT i.product_id
+		FROM flash_sale_items i
+		JOIN flash_sales s ON s.id = i.flash_sale_id
+		WHERE s.active AND i.product_id = ANY($1) AND s.start_time < $3 AND s.end_time > $2`
+	if err := tx.Select(&clashing, overlapQuery, pq.Array(productIDs), req.StartTime, req.EndTime); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check overlapping flash sales"})
+	}
+	if len(clashing) > 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"error":       "Some products are already in a flash sale at that time",
+			"product_ids": clashing,
+		})
+	}
+
+	sale := models.FlashSale{Name: req.Name, StartTime: req.StartTime, EndTime: req.EndTime, Active: true}
+	err = tx.QueryRow(`INSERT INTO flash_sales (name, start_time, end_time) VALUES ($1, $2, $3) RETURNING id`,
+		sale.Name, sale.StartTime, sale.EndTime).Scan(&sale.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create flash sale"})
+	}
+	for _, item := range req.Items {
+		_, err := tx.Exec(`
+			INSERT INTO flash_sale_items (flash_sale_id, product_id, discount_percentage, quantity, per_customer_limit)
+			VALUES ($1, $2, $3, $4, $5)`, sale.ID, item.ProductID, item.DiscountPercentage, item.Quantity, item.PerCustomerLimit)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add flash sale items"})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create flash sale"})
+	}
+
+	sales := []models.FlashSale{sale}
+	if err := models.AttachFlashSaleItems(sales); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch flash sale items"})
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Flash sale created successfully", "flash_sale": sales[0]})
+}
+
+// AdminViewFlashSales lists every flash sale, newest first, with how many
+// units of each item have been claimed.
+func AdminViewFlashSales(c *fiber.Ctx) error {
+	sales := []models.FlashSale{}
+	query := `SELECT id, name, start_time, end_time, active FROM flash_sales ORDER BY start_time DESC`
+	if err := config.DB.Select(&sales, query); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch flash sales"})
+	}
+	if err := models.AttachFlashSaleItems(sales); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch flash sale items"})
+	}
+
+	return c.JSON(fiber.Map{"flash_sales": sales})
+}
+
+// EndFlashSale stops a flash sale early. Sales are kept since claims point
+// at them; orders already placed keep their price.
+func EndFlashSale(c *fiber.Ctx) error {
+	saleID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid flash sale ID"})
+	}
+
+	result, err := config.DB.Exec(`UPDATE flash_sales SET active = false WHERE id = $1`, saleID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to end flash sale"})
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Flash sale not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Flash sale ended successfully"})
+}
@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// InventoryValuationReport values current stock at each product's weighted
+// average landed cost from goods receipts, and prices the units sold between
+// start and end (net of cancellations and returns) at that cost to give cost
+// of goods sold. Cancellations and returns only count against orders whose
+// sale was recorded. Both dates default to the current month.
+func InventoryValuationReport(c *fiber.Ctx) error {
+	now := time.Now()
+	startDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	endDate := now
+	// reportEnd is the last day covered, while endDate is the exclusive
+	// bound the query uses.
+	reportEnd := now
+
+	var err error
+	if start := c.Query("start"); start != "" {
+		if startDate, err = time.Parse("2006-01-02", start); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid start date"})
+		}
+	}
+	if end := c.Query("end"); end != "" {
+		if reportEnd, err = time.Parse("2006-01-02", end); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid end date"})
+		}
+		endDate = reportEnd.AddDate(0, 0, 1)
+	}
+
+	rows := []models.InventoryValuation{}
+	query := `
+		WITH costs AS (
+			SELECT product_id, SUM(landed_unit_cost * quantity) / SUM(quantity) AS average_cost
+			FROM goods_receipt_items
+			GROUP BY product_id
+		), sold AS (
+			SELECT sa.product_id, -SUM(sa.delta) AS units_sold
+			FROM stock_adjustments sa
+			WHERE sa.reason IN ('sale', 'cancellation', 'return') AND sa.created_at >= $1 AND sa.created_at < $2
+			  AND (sa.reason = 'sale' OR EXISTS (
+				SELECT 1 FROM stock_adjustments s WHERE s.order_id = sa.order_id AND s.reason = 'sale'
+			  ))
+			GROUP BY sa.product_id
+		)
+		SELECT p.id AS product_id, p.name AS product_name, p.stock AS on_hand,
+		       ROUND(COALESCE(c.average_cost, 0), 2) AS average_cost,
+		       ROUND(COALESCE(c.average_cost, 0) * p.stock, 2) AS inventory_value,
+		       COALESCE(s.units_sold, 0) AS units_sold,
+		       ROUND(COALESCE(c.average_cost, 0) * COALESCE(s.units_sold, 0), 2) AS cogs
+		FROM products p
+		LEFT JOIN costs c ON c.product_id = p.id
+		LEFT JOIN sold s ON s.product_id = p.id
+		WHERE p.deleted = false OR p.stock <> 0 OR s.units_sold IS NOT NULL
+		ORDER BY p.name`
+	if err := config.DB.Select(&rows, query, startDate, endDate); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to compute inventory valuation"})
+	}
+
+	var totalValue, totalCOGS float64
+	for _, row := range rows {
+		totalValue += row.InventoryValue
+		totalCOGS += row.COGS
+	}
+
+	return c.JSON(fiber.Map{
+		"start":       startDate.Format("2006-01-02"),
+		"end":         reportEnd.Format("2006-01-02"),
+		"total_value": totalValue,
+		"total_cogs":  totalCOGS,
+		"products":    rows,
+	})
+}
@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"horizon/config"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Lockout struct {
+	ID            int        `json:"id"`
+	Key           string     `json:"key"`
+	Kind          string     `json:"kind"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	Locked        bool       `json:"locked"`
+}
+
+func ViewLockouts(c *fiber.Ctx) error {
+	query := `
+		SELECT id, lock_key, kind, failures, last_failure_at, locked_until,
+		       COALESCE(locked_until > NOW(), false) AS locked
+		FROM login_lockouts
+		WHERE last_failure_at >= NOW() - INTERVAL '1 day' OR locked_until > NOW()
+		ORDER BY locked DESC, failures DESC
+	`
+	rows, err := config.DB.Query(query)
+	if err != nil {
+		log.Printf("Database query error: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch lockouts"})
+	}
+	defer rows.Close()
+
+	var lockouts []Lockout
+	for rows.Next() {
+		var lockout Lockout
+		if err := rows.Scan(&lockout.ID, &lockout.Key, &lockout.Kind, &lockout.Failures, &lockout.LastFailureAt, &lockout.LockedUntil, &lockout.Locked); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse lockouts"})
+		}
+		lockouts = append(lockouts, lockout)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "Lockouts fetched successfully",
+		"lockouts": lockouts,
+	})
+}
+
+func ClearLockout(c *fiber.Ctx) error {
+	lockoutID := c.Params("id")
+
+	result, err := config.DB.Exec(`DELETE FROM login_lockouts WHERE id = $1`, lockoutID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to clear lockout"})
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Lockout not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Lockout cleared successfully"})
+}
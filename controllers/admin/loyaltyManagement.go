@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UpdateLoyaltySettings sets how points are earned and redeemed and where
+// the tiers start. Changes apply to points earned or redeemed from now on.
+func UpdateLoyaltySettings(c *fiber.Ctx) error {
+	var req models.LoyaltySettings
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	switch {
+	case req.PointsPerRupee < 0 || req.RupeesPerPoint < 0 || req.ReviewBonusPoints < 0:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Rates and bonuses cannot be negative"})
+	case req.MaxRedemptionPercentage < 0 || req.MaxRedemptionPercentage > 100:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Max redemption percentage must be between 0 and 100"})
+	case req.ValidityDays <= 0:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Validity days must be positive"})
+	case req.SilverThreshold < 0 || req.GoldThreshold < req.SilverThreshold:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Gold threshold must not be below the silver threshold"})
+	case req.SilverMultiplier < 1 || req.GoldMultiplier < req.SilverMultiplier:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Tier multipliers must be at least 1 and gold at least silver"})
+	}
+
+	query := `
+		UPDATE loyalty_settings
+		SET points_per_rupee = $1, rupees_per_point = $2, max_redemption_percentage = $3, review_bonus_points = $4,
+		    validity_days = $5, silver_threshold = $6, gold_threshold = $7, silver_multiplier = $8, gold_multiplier = $9
+		RETURNING ` + models.LoyaltySettingsColumns
+	settings, err := models.ScanLoyaltySettings(config.DB.QueryRow(query, req.PointsPerRupee, req.RupeesPerPoint,
+		req.MaxRedemptionPercentage, req.ReviewBonusPoints, req.ValidityDays, req.SilverThreshold, req.GoldThreshold,
+		req.SilverMultiplier, req.GoldMultiplier))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update loyalty settings"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Loyalty settings updated successfully", "settings": settings})
+}
@@ -5,11 +5,25 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// Offer scopes, from the narrowest to the widest.
+const (
+	offerScopeProduct  = "product"
+	offerScopeProducts = "products"
+	offerScopeCategory = "category"
+	offerScopeBrand    = "brand"
+	offerScopeStore    = "store"
 )
 
 func AddOffer(c *fiber.Ctx) error {
 	var offer struct {
+		Scope              string  `json:"scope"`
 		ProductID          int     `json:"product_id"`
+		ProductIDs         []int   `json:"product_ids"`
+		CategoryID         int     `json:"category_id"`
+		BrandID            int     `json:"brand_id"`
 		DiscountPercentage float64 `json:"discount_percentage"`
 		StartDate          string  `json:"start_date"`
 		EndDate            string  `json:"end_date"`
@@ -19,6 +33,67 @@ func AddOffer(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
+	// Without an explicit scope, the target given decides it, as before
+	// scopes existed. A storewide offer has to ask for it.
+	targets := 0
+	for _, given := range []bool{offer.ProductID != 0, len(offer.ProductIDs) > 0, offer.CategoryID != 0, offer.BrandID != 0} {
+		if given {
+			targets++
+		}
+	}
+	if offer.Scope == "" {
+		switch {
+		case offer.ProductID != 0:
+			offer.Scope = offerScopeProduct
+		case len(offer.ProductIDs) > 0:
+			offer.Scope = offerScopeProducts
+		case offer.CategoryID != 0:
+			offer.Scope = offerScopeCategory
+		case offer.BrandID != 0:
+			offer.Scope = offerScopeBrand
+		}
+	}
+
+	switch offer.Scope {
+	case offerScopeProduct:
+		if offer.ProductID == 0 || targets != 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A product offer needs only product_id"})
+		}
+	case offerScopeProducts:
+		if len(offer.ProductIDs) == 0 || targets != 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A product set offer needs only product_ids"})
+		}
+		var found int
+		if err := config.DB.QueryRow(`SELECT COUNT(*) FROM products WHERE id = ANY($1) AND deleted = false`, pq.Array(offer.ProductIDs)).Scan(&found); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check products"})
+		}
+		if found != len(uniqueInts(offer.ProductIDs)) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Some products were not found or are deleted"})
+		}
+	case offerScopeCategory:
+		if offer.CategoryID == 0 || targets != 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A category offer needs only category_id"})
+		}
+		var exists bool
+		if err := config.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1 AND deleted = false)`, offer.CategoryID).Scan(&exists); err != nil || !exists {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Category not found or deleted"})
+		}
+	case offerScopeBrand:
+		if offer.BrandID == 0 || targets != 1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A brand offer needs only brand_id"})
+		}
+		brandID := offer.BrandID
+		if msg := validateProductBrand(&brandID); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+	case offerScopeStore:
+		if targets != 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A storewide offer takes no target"})
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Provide product_id, product_ids, category_id or brand_id, or scope \"store\""})
+	}
+
 	startDate, err := time.Parse(time.RFC3339, offer.StartDate)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid start_date format"})
@@ -32,49 +107,88 @@ func AddOffer(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "end_date must be after start_date"})
 	}
 
-	var existingOfferCount int
-	checkOfferQuery := `
-		SELECT COUNT(*) 
-		FROM offers 
-		WHERE product_id = $1 
-		AND NOW() BETWEEN start_date AND end_date
-	`
-	err = config.DB.QueryRow(checkOfferQuery, offer.ProductID).Scan(&existingOfferCount)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check existing offer"})
+	// Each target carries one running offer at a time. Product sets may
+	// overlap; precedence settles which offer a product gets.
+	if offer.Scope != offerScopeProducts {
+		var existingOfferCount int
+		checkOfferQuery := `
+			SELECT COUNT(*) 
+			FROM offers 
+			WHERE scope = $1
+			AND product_id IS NOT DISTINCT FROM NULLIF($2, 0)
+			AND category_id IS NOT DISTINCT FROM NULLIF($3, 0)
+			AND brand_id IS NOT DISTINCT FROM NULLIF($4, 0)
+			AND NOW() BETWEEN start_date AND end_date
+		`
+		err = config.DB.QueryRow(checkOfferQuery, offer.Scope, offer.ProductID, offer.CategoryID, offer.BrandID).Scan(&existingOfferCount)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check existing offer"})
+		}
+
+		if existingOfferCount > 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "The " + offer.Scope + " already has an active offer"})
+		}
 	}
 
-	if existingOfferCount > 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Product already has an active offer"})
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start transaction"})
 	}
+	defer tx.Rollback()
 
 	insertOfferQuery := `
-		INSERT INTO offers (product_id, discount_percentage, start_date, end_date)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO offers (scope, product_id, category_id, brand_id, discount_percentage, start_date, end_date)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), NULLIF($4, 0), $5, $6, $7)
 		RETURNING id
 	`
 	var offerID int
-	err = config.DB.QueryRow(insertOfferQuery, offer.ProductID, offer.DiscountPercentage, startDate, endDate).Scan(&offerID)
+	err = tx.QueryRow(insertOfferQuery, offer.Scope, offer.ProductID, offer.CategoryID, offer.BrandID, offer.DiscountPercentage, startDate, endDate).Scan(&offerID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add offer"})
 	}
 
-	updateProductQuery := `
-		UPDATE products
-		SET discounted_price = price - (price * $1 / 100)
-		WHERE id = $2
-	`
-	_, err = config.DB.Exec(updateProductQuery, offer.DiscountPercentage, offer.ProductID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update product price"})
+	if offer.Scope == offerScopeProducts {
+		_, err = tx.Exec(`INSERT INTO offer_products (offer_id, product_id) SELECT $1, UNNEST($2::int[]) ON CONFLICT DO NOTHING`, offerID, pq.Array(offer.ProductIDs))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add offer products"})
+		}
+	}
+
+	if offer.Scope == offerScopeProduct {
+		updateProductQuery := `
+			UPDATE products
+			SET discounted_price = price - (price * $1 / 100)
+			WHERE id = $2
+		`
+		_, err = tx.Exec(updateProductQuery, offer.DiscountPercentage, offer.ProductID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update product price"})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add offer"})
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message":  "Offer added successfully",
 		"offer_id": offerID,
+		"scope":    offer.Scope,
 	})
 }
 
+func uniqueInts(values []int) []int {
+	seen := map[int]bool{}
+	var unique []int
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
 func RemoveOffer(c *fiber.Ctx) error {
 
 	productID := c.Params("product_id")
@@ -109,6 +223,23 @@ func RemoveOffer(c *fiber.Ctx) error {
 	})
 }
 
+func RemoveBrandOffer(c *fiber.Ctx) error {
+	brandID, err := c.ParamsInt("brand_id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid brand ID"})
+	}
+
+	result, err := config.DB.Exec("DELETE FROM offers WHERE brand_id = $1 AND end_date >= NOW()", brandID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove the offer"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No active offer found for the brand"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Offer removed successfully"})
+}
+
 type Offer struct {
 	ID                 int     `json:"id"`
 	ProductID          int     `json:"product_id"`
@@ -117,23 +248,77 @@ type Offer struct {
 	EndDate            string  `json:"end_date"`
 }
 
-func ViewOffer(c *fiber.Ctx) error {
-	var offers []struct {
-		ID                 int     `json:"id"`
-		ProductID          int     `json:"product_id"`
-		ProductName        string  `json:"product_name"`
-		CategoryName       string  `json:"category_name"`
-		DiscountPercentage float64 `json:"discount_percentage"`
-		StartDate          string  `json:"start_date"`
-		EndDate            string  `json:"end_date"`
+// RemoveOfferByID ends any offer, whatever its scope.
+func RemoveOfferByID(c *fiber.Ctx) error {
+	offerID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid offer ID"})
+	}
+
+	result, err := config.DB.Exec("DELETE FROM offers WHERE id = $1", offerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove the offer"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Offer not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Offer removed successfully"})
+}
+
+// SetOfferPrecedence chooses how a product covered by several offers is
+// priced: "best_for_customer" takes the largest discount, "most_specific"
+// the offer with the narrowest scope.
+func SetOfferPrecedence(c *fiber.Ctx) error {
+	var req struct {
+		Precedence string `json:"precedence"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if req.Precedence != "best_for_customer" && req.Precedence != "most_specific" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "precedence must be best_for_customer or most_specific"})
 	}
 
+	if _, err := config.DB.Exec(`UPDATE offer_settings SET precedence = $1`, req.Precedence); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update offer precedence"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Offer precedence updated successfully", "precedence": req.Precedence})
+}
+
+type viewOffer struct {
+	ID                 int     `json:"id"`
+	Scope              string  `json:"scope"`
+	ProductID          *int    `json:"product_id"`
+	ProductName        string  `json:"product_name,omitempty"`
+	ProductIDs         []int64 `json:"product_ids,omitempty"`
+	CategoryID         *int    `json:"category_id"`
+	CategoryName       string  `json:"category_name,omitempty"`
+	BrandID            *int    `json:"brand_id"`
+	BrandName          string  `json:"brand_name,omitempty"`
+	DiscountPercentage float64 `json:"discount_percentage"`
+	StartDate          string  `json:"start_date"`
+	EndDate            string  `json:"end_date"`
+}
+
+func ViewOffer(c *fiber.Ctx) error {
+	var offers []viewOffer
+
+	// category_name is the offer's category for category offers and the
+	// product's category for product offers.
 	query := `
-		SELECT o.id, o.product_id, p.name as product_name, c.name as category_name,
+		SELECT o.id, o.scope, o.product_id, COALESCE(p.name, '') as product_name,
+		       ARRAY(SELECT op.product_id FROM offer_products op WHERE op.offer_id = o.id ORDER BY op.product_id) as product_ids,
+		       o.category_id, COALESCE(oc.name, c.name, '') as category_name,
+		       o.brand_id, COALESCE(b.name, '') as brand_name,
 		       o.discount_percentage, o.start_date, o.end_date
 		FROM offers o
-		JOIN products p ON o.product_id = p.id
-		JOIN categories c ON p.category_id = c.id
+		LEFT JOIN products p ON o.product_id = p.id
+		LEFT JOIN categories c ON p.category_id = c.id
+		LEFT JOIN categories oc ON o.category_id = oc.id
+		LEFT JOIN brands b ON o.brand_id = b.id
+		ORDER BY o.start_date DESC, o.id
 	`
 	rows, err := config.DB.Query(query)
 	if err != nil {
@@ -144,16 +329,9 @@ func ViewOffer(c *fiber.Ctx) error {
 	defer rows.Close()
 
 	for rows.Next() {
-		var offer struct {
-			ID                 int     `json:"id"`
-			ProductID          int     `json:"product_id"`
-			ProductName        string  `json:"product_name"`
-			CategoryName       string  `json:"category_name"`
-			DiscountPercentage float64 `json:"discount_percentage"`
-			StartDate          string  `json:"start_date"`
-			EndDate            string  `json:"end_date"`
-		}
-		if err := rows.Scan(&offer.ID, &offer.ProductID, &offer.ProductName, &offer.CategoryName,
+		var offer viewOffer
+		if err := rows.Scan(&offer.ID, &offer.Scope, &offer.ProductID, &offer.ProductName, pq.Array(&offer.ProductIDs),
+			&offer.CategoryID, &offer.CategoryName, &offer.BrandID, &offer.BrandName,
 			&offer.DiscountPercentage, &offer.StartDate, &offer.EndDate); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to parse offer details",
@@ -168,8 +346,14 @@ func ViewOffer(c *fiber.Ctx) error {
 		})
 	}
 
+	var precedence string
+	if err := config.DB.QueryRow(`SELECT precedence FROM offer_settings`).Scan(&precedence); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch offer precedence"})
+	}
+
 	return c.JSON(fiber.Map{
-		"message": "Offers fetched successfully",
-		"offers":  offers,
+		"message":    "Offers fetched successfully",
+		"precedence": precedence,
+		"offers":     offers,
 	})
 }
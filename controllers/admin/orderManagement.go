@@ -1,8 +1,10 @@
 package admin
 
 import (
+	"fmt"
 	"horizon/config"
 	"horizon/models"
+	"horizon/utils"
 	"log"
 	"strconv"
 
@@ -32,7 +34,7 @@ func AdminListOrder(c *fiber.Ctx) error {
 			o.total_amount,
 			o.coupon_discount,      -- Added coupon discount
 			o.offer_discount,       -- Added offer discount
-			(oi.subtotal - o.coupon_discount - o.offer_discount) AS final_amount -- Calculated final amount
+			(oi.subtotal - o.coupon_discount - o.offer_discount - o.promotion_discount - o.loyalty_discount) AS final_amount -- Calculated final amount
 		FROM orders o
 		JOIN order_items oi ON o.id = oi.order_id
 		JOIN products p ON oi.product_id = p.id
@@ -186,6 +188,65 @@ func AdminChangeOrderStatus(c *fiber.Ctx) error {
 		}
 	}
 
+	// Cancelled and returned items go back to the warehouses they were
+	// taken from. Only a delivered order can come back as a return; an order
+	// returned after it was cancelled already has its stock back.
+	var restockedProductIDs []int
+	if statusUpdate.Status == "Returned" && currentStatus == "Delivered" {
+		restockedProductIDs, err = models.RestockOrder(tx, orderID, models.StockReasonReturn, fmt.Sprintf("Order %d returned", orderID))
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Failed to restock returned items: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restock returned items"})
+		}
+	}
+	if statusUpdate.Status == "Cancelled" && currentStatus != "Cancelled" {
+		restockedProductIDs, err = models.RestockOrder(tx, orderID, models.StockReasonCancellation, fmt.Sprintf("Order %d cancelled", orderID))
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Failed to restock cancelled items: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restock cancelled items"})
+		}
+	}
+
+	// A cancelled order gives its flash sale units and coupons back, locked
+	// after its products in the order checkout takes them.
+	if statusUpdate.Status == "Cancelled" {
+		if err := models.ReleaseFlashSaleClaims(tx, orderID); err != nil {
+			tx.Rollback()
+			log.Printf("Failed to release flash sale units: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to release flash sale units"})
+		}
+		if err := models.RollbackOrderCoupons(tx, orderID); err != nil {
+			tx.Rollback()
+			log.Printf("Failed to release coupons: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to release coupon"})
+		}
+	}
+
+	// Cancelled and returned orders give back the points spent on them; a
+	// return of a delivered order also takes back the points it earned.
+	if statusUpdate.Status == "Returned" && currentStatus == "Delivered" {
+		if err := models.ReverseOrderPoints(tx, userID, orderID); err != nil {
+			tx.Rollback()
+			log.Printf("Failed to reverse loyalty points: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reverse loyalty points"})
+		}
+		// Returning the first order takes back the referral it paid out.
+		if _, err := models.ReverseReferral(tx, userID, orderID); err != nil {
+			tx.Rollback()
+			log.Printf("Failed to reverse referral reward: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reverse referral reward"})
+		}
+	}
+	if statusUpdate.Status == "Cancelled" || statusUpdate.Status == "Returned" {
+		if err := models.RefundRedeemedPoints(tx, userID, orderID); err != nil {
+			tx.Rollback()
+			log.Printf("Failed to refund loyalty points: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refund loyalty points"})
+		}
+	}
+
 	updateOrderQuery := `
 		UPDATE orders
 		SET status = $1
@@ -208,10 +269,26 @@ func AdminChangeOrderStatus(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Order not found"})
 	}
 
+	// Delivery earns loyalty points, and a referred customer's first
+	// delivered order pays out the referral.
+	if statusUpdate.Status == "Delivered" && currentStatus != "Delivered" {
+		if _, err := models.RewardReferral(tx, userID, orderID); err != nil {
+			tx.Rollback()
+			log.Printf("Failed to reward referral: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reward referral"})
+		}
+		if _, err := models.AwardOrderPoints(tx, userID, orderID); err != nil {
+			tx.Rollback()
+			log.Printf("Failed to award loyalty points: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to award loyalty points"})
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		log.Printf("Failed to commit transaction: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to finalize transaction"})
 	}
+	go utils.StockChanged(restockedProductIDs...)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Order status updated successfully",
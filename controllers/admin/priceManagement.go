@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SchedulePriceChange queues a future price for a product. The scheduler
+// applies it once effective_at has passed.
+func SchedulePriceChange(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var req struct {
+		Price       float64 `json:"price"`
+		EffectiveAt string  `json:"effective_at"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if req.Price < 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Price cannot be negative"})
+	}
+	effectiveAt, err := time.Parse(time.RFC3339, req.EffectiveAt)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid effective_at format"})
+	}
+	if !effectiveAt.After(time.Now()) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "effective_at must be in the future"})
+	}
+
+	var exists bool
+	checkQuery := `SELECT EXISTS (SELECT 1 FROM products WHERE id=$1 AND deleted=false)`
+	if err := config.DB.QueryRow(checkQuery, productID).Scan(&exists); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check product existence"})
+	}
+	if !exists {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found or unavailable"})
+	}
+
+	var change models.ScheduledPriceChange
+	query := `
+		INSERT INTO scheduled_price_changes (product_id, new_price, effective_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, product_id, new_price, effective_at, status, created_at, applied_at`
+	if err := config.DB.Get(&change, query, productID, req.Price, effectiveAt); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to schedule price change"})
+	}
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Price change scheduled", "change": change})
+}
+
+func CancelScheduledPriceChange(c *fiber.Ctx) error {
+	changeID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid schedule ID"})
+	}
+
+	result, err := config.DB.Exec(`UPDATE scheduled_price_changes SET status = 'Cancelled' WHERE id = $1 AND status = 'Pending'`, changeID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to cancel price change"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No pending price change found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Scheduled price change cancelled"})
+}
+
+// ViewPriceHistory returns a product's list prices over time, newest first,
+// along with any changes still waiting to take effect.
+func ViewPriceHistory(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	history := []models.PriceHistoryEntry{}
+	historyQuery := `
+		SELECT price, effective_from, source
+		FROM product_price_history
+		WHERE product_id = $1
+		ORDER BY effective_from DESC, id DESC`
+	if err := config.DB.Select(&history, historyQuery, productID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch price history"})
+	}
+
+	scheduled := []models.ScheduledPriceChange{}
+	scheduledQuery := `
+		SELECT id, product_id, new_price, effective_at, status, created_at, applied_at
+		FROM scheduled_price_changes
+		WHERE product_id = $1 AND status = 'Pending'
+		ORDER BY effective_at`
+	if err := config.DB.Select(&scheduled, scheduledQuery, productID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch scheduled price changes"})
+	}
+
+	return c.JSON(fiber.Map{
+		"history":   history,
+		"scheduled": scheduled,
+	})
+}
@@ -0,0 +1,249 @@
+package admin
+
+import (
+	"database/sql"
+	"fmt"
+	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func UploadProductImages(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var exists bool
+	checkQuery := `SELECT EXISTS (SELECT 1 FROM products WHERE id=$1 AND deleted=false)`
+	if err := config.DB.QueryRow(checkQuery, productID).Scan(&exists); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check product existence"})
+	}
+	if !exists {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found or unavailable"})
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["images"]) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Upload one or more files in the images field"})
+	}
+
+	var nextSort int
+	var hasPrimary bool
+	stateQuery := `SELECT COALESCE(MAX(sort_order) + 1, 0), COALESCE(BOOL_OR(is_primary), false) FROM product_images WHERE product_id=$1`
+	if err := config.DB.QueryRow(stateQuery, productID).Scan(&nextSort, &hasPrimary); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch product images"})
+	}
+
+	store := utils.Storage()
+	uploaded := 0
+	failures := fiber.Map{}
+	for _, header := range form.File["images"] {
+		if header.Size > utils.MaxImageSize {
+			failures[header.Filename] = utils.ErrImageTooLarge.Error()
+			continue
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			failures[header.Filename] = "Failed to read file"
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(file, utils.MaxImageSize+1))
+		file.Close()
+		if err != nil {
+			failures[header.Filename] = "Failed to read file"
+			continue
+		}
+
+		renditions, err := utils.ProcessImage(data)
+		if err != nil {
+			failures[header.Filename] = err.Error()
+			continue
+		}
+
+		name, err := utils.RandomToken(12)
+		if err != nil {
+			failures[header.Filename] = "Failed to store image"
+			continue
+		}
+		base := fmt.Sprintf("products/%d/%s", productID, name)
+		keys := []string{
+			base + renditions.OriginalExt,
+			base + "_medium" + renditions.RenditionExt,
+			base + "_thumb" + renditions.RenditionExt,
+		}
+		contents := [][]byte{renditions.Original, renditions.Medium, renditions.Thumbnail}
+
+		saved := 0
+		for i, key := range keys {
+			if err := store.Save(key, contents[i]); err != nil {
+				log.Printf("Failed to save image %s: %v", key, err)
+				break
+			}
+			saved++
+		}
+		if saved < len(keys) {
+			for _, key := range keys[:saved] {
+				store.Delete(key)
+			}
+			failures[header.Filename] = "Failed to store image"
+			continue
+		}
+
+		insertQuery := `
+			INSERT INTO product_images (product_id, original_key, medium_key, thumbnail_key, width, height, sort_order, is_primary)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+		_, err = config.DB.Exec(insertQuery, productID, keys[0], keys[1], keys[2], renditions.Width, renditions.Height, nextSort, !hasPrimary)
+		if err != nil {
+			log.Printf("Failed to record image: %v", err)
+			for _, key := range keys {
+				store.Delete(key)
+			}
+			failures[header.Filename] = "Failed to store image"
+			continue
+		}
+
+		nextSort++
+		hasPrimary = true
+		uploaded++
+	}
+
+	images, err := models.FetchProductImages(productID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch product images"})
+	}
+
+	status := http.StatusCreated
+	if uploaded == 0 {
+		status = http.StatusBadRequest
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"message":  fmt.Sprintf("%d image(s) uploaded", uploaded),
+		"images":   images,
+		"failures": failures,
+	})
+}
+
+func SetPrimaryProductImage(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+	imageID, err := c.ParamsInt("image_id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid image ID"})
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update primary image"})
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE product_images SET is_primary=false WHERE product_id=$1 AND is_primary`, productID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update primary image"})
+	}
+	result, err := tx.Exec(`UPDATE product_images SET is_primary=true WHERE id=$1 AND product_id=$2`, imageID, productID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update primary image"})
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Image not found for this product"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update primary image"})
+	}
+	return c.JSON(fiber.Map{"message": "Primary image updated successfully"})
+}
+
+func ReorderProductImages(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var req struct {
+		ImageIDs []int `json:"image_ids"`
+	}
+	if err := c.BodyParser(&req); err != nil || len(req.ImageIDs) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "image_ids must list the images in display order"})
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reorder images"})
+	}
+	defer tx.Rollback()
+
+	for position, imageID := range req.ImageIDs {
+		result, err := tx.Exec(`UPDATE product_images SET sort_order=$1 WHERE id=$2 AND product_id=$3`, position, imageID, productID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reorder images"})
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Image %d does not belong to this product", imageID)})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reorder images"})
+	}
+	return c.JSON(fiber.Map{"message": "Images reordered successfully"})
+}
+
+// DeleteProductImage removes an image record and queues its files for the
+// cleanup job. If it was the primary image, the next one in order takes over.
+func DeleteProductImage(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+	imageID, err := c.ParamsInt("image_id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid image ID"})
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete image"})
+	}
+	defer tx.Rollback()
+
+	var originalKey, mediumKey, thumbnailKey string
+	var wasPrimary bool
+	deleteQuery := `DELETE FROM product_images WHERE id=$1 AND product_id=$2 RETURNING original_key, medium_key, thumbnail_key, is_primary`
+	err = tx.QueryRow(deleteQuery, imageID, productID).Scan(&originalKey, &mediumKey, &thumbnailKey, &wasPrimary)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Image not found for this product"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete image"})
+	}
+
+	queueQuery := `INSERT INTO file_deletions (file_key) VALUES ($1), ($2), ($3)`
+	if _, err := tx.Exec(queueQuery, originalKey, mediumKey, thumbnailKey); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete image"})
+	}
+
+	if wasPrimary {
+		promoteQuery := `
+			UPDATE product_images SET is_primary=true
+			WHERE id = (SELECT id FROM product_images WHERE product_id=$1 ORDER BY sort_order, id LIMIT 1)`
+		if _, err := tx.Exec(promoteQuery, productID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete image"})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete image"})
+	}
+	return c.JSON(fiber.Map{"message": "Image deleted successfully"})
+}
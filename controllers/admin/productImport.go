@@ -0,0 +1,463 @@
+package admin
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	importBatchSize = 100
+	maxImportSize   = 20 << 20
+
+	// maxCategoryNameLength is the size of categories.name.
+	maxCategoryNameLength = 50
+)
+
+// importColumns is the column layout shared by import and export, so an
+// exported file can be edited and uploaded again as is.
+var importColumns = []string{"id", "name", "description", "price", "stock", "category"}
+
+type importRow struct {
+	Row      int
+	Product  models.Product
+	Category string
+}
+
+// readSpreadsheet returns the rows of a CSV file or of the first sheet of an
+// XLSX workbook, header included.
+func readSpreadsheet(fileName string, data []byte) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		return reader.ReadAll()
+	case ".xlsx":
+		f, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, fmt.Errorf("workbook has no sheets")
+		}
+		return f.GetRows(sheets[0])
+	default:
+		return nil, fmt.Errorf("only .csv and .xlsx files are supported")
+	}
+}
+
+// parseImportRows checks every row against the AddProduct rules and the
+// current catalog. Rows with problems are reported and left out.
+func parseImportRows(records [][]string) ([]importRow, []models.ImportRowError, error) {
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("file is empty")
+	}
+
+	columns := map[string]int{}
+	for i, header := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+	for _, name := range importColumns[1:] {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, fmt.Errorf("missing required column %q", name)
+		}
+	}
+	cell := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var liveIDs []int
+	if err := config.DB.Select(&liveIDs, `SELECT id FROM products WHERE deleted = false`); err != nil {
+		return nil, nil, err
+	}
+	live := map[int]bool{}
+	for _, id := range liveIDs {
+		live[id] = true
+	}
+
+	var categories []struct {
+		Name    string `db:"name"`
+		Deleted bool   `db:"deleted"`
+	}
+	if err := config.DB.Select(&categories, `SELECT name, deleted FROM categories`); err != nil {
+		return nil, nil, err
+	}
+	deletedCategory := map[string]bool{}
+	for _, category := range categories {
+		deletedCategory[strings.ToLower(category.Name)] = category.Deleted
+	}
+
+	var rows []importRow
+	var rowErrors []models.ImportRowError
+	for i, record := range records[1:] {
+		rowNumber := i + 2
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		fail := func(msg string) {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: rowNumber, Error: msg})
+		}
+
+		row := importRow{Row: rowNumber, Category: cell(record, "category")}
+		row.Product.Name = cell(record, "name")
+		row.Product.Description = cell(record, "description")
+
+		var err error
+		if id := cell(record, "id"); id != "" {
+			if row.Product.ID, err = strconv.Atoi(id); err != nil {
+				fail("Invalid product id")
+				continue
+			}
+			if !live[row.Product.ID] {
+				fail("Product not found or unavailable")
+				continue
+			}
+		}
+		if row.Product.Price, err = strconv.ParseFloat(cell(record, "price"), 64); err != nil {
+			fail("Invalid price")
+			continue
+		}
+		if row.Product.Stock, err = strconv.Atoi(cell(record, "stock")); err != nil {
+			fail("Invalid stock")
+			continue
+		}
+		if msg := validateProduct(&row.Product); msg != "" {
+			fail(msg)
+			continue
+		}
+		if len(row.Category) < 3 {
+			fail("Category name must be at least 3 characters long")
+			continue
+		}
+		if utf8.RuneCountInString(row.Category) > maxCategoryNameLength {
+			fail(fmt.Sprintf("Category name must be at most %d characters long", maxCategoryNameLength))
+			continue
+		}
+		if deletedCategory[strings.ToLower(row.Category)] {
+			fail(fmt.Sprintf("Category %q is deleted", row.Category))
+			continue
+		}
+
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, nil
+}
+
+// resolveImportCategory returns the id of the named category, creating it
+// at the top level if it does not exist yet. A new category gets its name's
+// slug, with its id added when another category already has that slug.
+func resolveImportCategory(tx *sql.Tx, name string, cache map[string]int) (int, error) {
+	key := strings.ToLower(name)
+	if id, ok := cache[key]; ok {
+		return id, nil
+	}
+
+	var id int
+	err := tx.QueryRow(`SELECT id FROM categories WHERE LOWER(name) = $1 AND deleted = false`, key).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(`INSERT INTO categories (name) VALUES ($1) RETURNING id`, name).Scan(&id)
+		if err == nil {
+			slugQuery := `
+				UPDATE categories
+				SET slug = CASE
+					WHEN $2 <> '' AND NOT EXISTS (SELECT 1 FROM categories WHERE slug = $2) THEN $2
+					ELSE trim(both '-' from $2 || '-' || id)
+				END
+				WHERE id = $1`
+			_, err = tx.Exec(slugQuery, id, utils.Slugify(name))
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	cache[key] = id
+	return id, nil
+}
+
+// importBatch writes one batch in a single transaction. If any row fails the
+// whole batch is rolled back and every row in it is reported.
+func importBatch(batch []importRow) (created, updated int, rowErrors []models.ImportRowError) {
+	failAll := func(err error) (int, int, []models.ImportRowError) {
+		for _, row := range batch {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row.Row, Error: "Batch rolled back: " + err.Error()})
+		}
+		return 0, 0, rowErrors
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return failAll(err)
+	}
+	defer tx.Rollback()
+
+	categoryIDs := map[string]int{}
+	var updatedIDs []int
+	for _, row := range batch {
+		categoryID, err := resolveImportCategory(tx, row.Category, categoryIDs)
+		if err != nil {
+			return failAll(fmt.Errorf("row %d: category: %v", row.Row, err))
+		}
+
+		product := row.Product
+		if product.ID == 0 {
+			insertQuery := `INSERT INTO products (name, description, price, category_id, stock) VALUES ($1, $2, $3, $4, 0) RETURNING id`
+			if err := tx.QueryRow(insertQuery, product.Name, product.Description, product.Price, categoryID).Scan(&product.ID); err != nil {
+				return failAll(fmt.Errorf("row %d: %v", row.Row, err))
+			}
+			if err := models.SetTotalStock(tx, product.ID, product.Stock, "Product import"); err != nil {
+				return failAll(fmt.Errorf("row %d: stock: %v", row.Row, err))
+			}
+			if err := models.RecordPrice(tx, product.ID, product.Price, nil, models.PriceSourceImport); err != nil {
+				return failAll(fmt.Errorf("row %d: price history: %v", row.Row, err))
+			}
+			created++
+			continue
+		}
+
+		updateQuery := `UPDATE products SET name=$1, description=$2, price=$3, category_id=$4, updated_at=NOW() WHERE id=$5 AND deleted=false`
+		result, err := tx.Exec(updateQuery, product.Name, product.Description, product.Price, categoryID, product.ID)
+		if err != nil {
+			return failAll(fmt.Errorf("row %d: %v", row.Row, err))
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return failAll(fmt.Errorf("row %d: product %d no longer exists", row.Row, product.ID))
+		}
+		err = models.SetTotalStock(tx, product.ID, product.Stock, "Product import")
+		if err == models.ErrInsufficientWarehouseStock {
+			return failAll(fmt.Errorf("row %d: stock: the warehouses hold fewer units than the stock being removed; adjust it per warehouse", row.Row))
+		}
+		if err != nil {
+			return failAll(fmt.Errorf("row %d: stock: %v", row.Row, err))
+		}
+		if err := models.RecordPrice(tx, product.ID, product.Price, nil, models.PriceSourceImport); err != nil {
+			return failAll(fmt.Errorf("row %d: price history: %v", row.Row, err))
+		}
+		updatedIDs = append(updatedIDs, product.ID)
+		updated++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return failAll(err)
+	}
+	utils.StockChanged(updatedIDs...)
+	return created, updated, nil
+}
+
+// runProductImport processes validated rows batch by batch, recording progress
+// on the job after each batch.
+func runProductImport(jobID int, rows []importRow, rowErrors []models.ImportRowError) {
+	processed, created, updated := len(rowErrors), 0, 0
+	for start := 0; start < len(rows); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		batchCreated, batchUpdated, batchErrors := importBatch(rows[start:end])
+		processed += end - start
+		created += batchCreated
+		updated += batchUpdated
+		rowErrors = append(rowErrors, batchErrors...)
+
+		errorsJSON, _ := json.Marshal(rowErrors)
+		progressQuery := `
+			UPDATE product_import_jobs
+			SET processed_rows = $1, created_count = $2, updated_count = $3, error_count = $4, errors = $5
+			WHERE id = $6`
+		if _, err := config.DB.Exec(progressQuery, processed, created, updated, len(rowErrors), errorsJSON, jobID); err != nil {
+			log.Printf("Failed to record import progress for job %d: %v", jobID, err)
+		}
+	}
+
+	status := "Completed"
+	if len(rows) > 0 && created+updated == 0 {
+		status = "Failed"
+	}
+	errorsJSON, _ := json.Marshal(rowErrors)
+	finishQuery := `
+		UPDATE product_import_jobs
+		SET status = $1, processed_rows = total_rows, created_count = $2, updated_count = $3,
+		    error_count = $4, errors = $5, finished_at = NOW()
+		WHERE id = $6`
+	if _, err := config.DB.Exec(finishQuery, status, created, updated, len(rowErrors), errorsJSON, jobID); err != nil {
+		log.Printf("Failed to finish import job %d: %v", jobID, err)
+	}
+}
+
+// ImportProducts creates and updates products from an uploaded CSV or XLSX
+// file. With dry_run=true it only reports what would happen; otherwise the
+// import runs in the background and its progress can be polled.
+func ImportProducts(c *fiber.Ctx) error {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Upload a .csv or .xlsx file in the file field"})
+	}
+	if header.Size > maxImportSize {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Import files are limited to 20 MB"})
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Failed to read file"})
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Failed to read file"})
+	}
+
+	records, err := readSpreadsheet(header.Filename, data)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	rows, rowErrors, err := parseImportRows(records)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rowErrors == nil {
+		rowErrors = []models.ImportRowError{}
+	}
+
+	if c.QueryBool("dry_run") {
+		creates := 0
+		for _, row := range rows {
+			if row.Product.ID == 0 {
+				creates++
+			}
+		}
+		return c.JSON(fiber.Map{
+			"message":    "Dry run completed, nothing was saved",
+			"total_rows": len(rows) + len(rowErrors),
+			"valid_rows": len(rows),
+			"creates":    creates,
+			"updates":    len(rows) - creates,
+			"errors":     rowErrors,
+		})
+	}
+
+	var jobID int
+	errorsJSON, _ := json.Marshal(rowErrors)
+	jobQuery := `
+		INSERT INTO product_import_jobs (file_name, total_rows, processed_rows, error_count, errors)
+		VALUES ($1, $2, $3, $3, $4)
+		RETURNING id`
+	if err := config.DB.QueryRow(jobQuery, header.Filename, len(rows)+len(rowErrors), len(rowErrors), errorsJSON).Scan(&jobID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start import"})
+	}
+
+	go runProductImport(jobID, rows, rowErrors)
+
+	return c.Status(http.StatusAccepted).JSON(fiber.Map{
+		"message":    "Import started",
+		"job_id":     jobID,
+		"status_url": fmt.Sprintf("/admin/products/imports/%d", jobID),
+	})
+}
+
+func ViewImportJob(c *fiber.Ctx) error {
+	jobID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid job ID"})
+	}
+
+	var job models.ProductImportJob
+	err = config.DB.Get(&job, `SELECT * FROM product_import_jobs WHERE id = $1`, jobID)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Import job not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch import job"})
+	}
+
+	return c.JSON(fiber.Map{"job": job})
+}
+
+func ExportProducts(c *fiber.Ctx) error {
+	var products []struct {
+		ID          int     `db:"id"`
+		Name        string  `db:"name"`
+		Description string  `db:"description"`
+		Price       float64 `db:"price"`
+		Stock       int     `db:"stock"`
+		Category    string  `db:"category"`
+	}
+	query := `
+		SELECT p.id, p.name, COALESCE(p.description, '') AS description, p.price, p.stock, COALESCE(c.name, '') AS category
+		FROM products p
+		LEFT JOIN categories c ON p.category_id = c.id
+		WHERE p.deleted = false
+		ORDER BY p.id`
+	if err := config.DB.Select(&products, query); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch products"})
+	}
+
+	records := [][]string{importColumns}
+	for _, p := range products {
+		records = append(records, []string{
+			strconv.Itoa(p.ID), p.Name, p.Description,
+			strconv.FormatFloat(p.Price, 'f', 2, 64), strconv.Itoa(p.Stock), p.Category,
+		})
+	}
+
+	fileName := "products-" + time.Now().Format("2006-01-02")
+	var buf bytes.Buffer
+	switch c.Query("format", "csv") {
+	case "csv":
+		w := csv.NewWriter(&buf)
+		if err := w.WriteAll(records); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build export"})
+		}
+		c.Set("Content-Type", "text/csv")
+		fileName += ".csv"
+	case "xlsx":
+		f := excelize.NewFile()
+		defer f.Close()
+		sheetName := f.GetSheetName(0)
+		for i, record := range records {
+			row := make([]interface{}, len(record))
+			for j, value := range record {
+				row[j] = value
+			}
+			if i > 0 {
+				row[0], row[3], row[4] = products[i-1].ID, products[i-1].Price, products[i-1].Stock
+			}
+			cellName, _ := excelize.CoordinatesToCellName(1, i+1)
+			if err := f.SetSheetRow(sheetName, cellName, &row); err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build export"})
+			}
+		}
+		if err := f.Write(&buf); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build export"})
+		}
+		c.Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		fileName += ".xlsx"
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be csv or xlsx"})
+	}
+
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	return c.Send(buf.Bytes())
+}
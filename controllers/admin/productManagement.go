@@ -5,42 +5,70 @@ import (
 	"horizon/config"
 	"horizon/models"
 	"horizon/sql"
+	"horizon/utils"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func AddProduct(c *fiber.Ctx) error {
-	product := new(models.Product)
-	if err := c.BodyParser(product); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
-	}
-
+// validateProduct normalises a product's text fields and returns the first
+// rule it breaks, or "" if it is valid. Single and bulk edits share it.
+func validateProduct(product *models.Product) string {
 	if product.Price < 0 {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Price cannot be negative"})
+		return "Price cannot be negative"
 	}
-
 	if product.Stock < 0 {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Stock cannot be negative"})
+		return "Stock cannot be negative"
 	}
 
 	product.Name = strings.TrimSpace(product.Name)
 	if len(product.Name) < 3 {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Product name must be at least 3 characters long"})
+		return "Product name must be at least 3 characters long"
 	}
 
 	product.Description = strings.TrimSpace(product.Description)
 	if len(product.Description) < 5 {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Product description must be at least 5 characters long"})
+		return "Product description must be at least 5 characters long"
+	}
+	return ""
+}
+
+func AddProduct(c *fiber.Ctx) error {
+	product := new(models.Product)
+	if err := c.BodyParser(product); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	if msg := validateProduct(product); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if msg := validateProductBrand(product.BrandID); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add product"})
 	}
+	defer tx.Rollback()
 
-	query := `INSERT INTO products (name, description, price, category_id, stock) VALUES ($1, $2, $3, $4, $5) RETURNING id`
-	err := config.DB.QueryRow(query, product.Name, product.Description, product.Price, product.CategoryID, product.Stock).Scan(&product.ID)
+	query := `INSERT INTO products (name, description, price, category_id, stock, brand_id) VALUES ($1, $2, $3, $4, 0, $5) RETURNING id`
+	err = tx.QueryRow(query, product.Name, product.Description, product.Price, product.CategoryID, product.BrandID).Scan(&product.ID)
 	if err != nil {
 		fmt.Println("er", err)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add product"})
 	}
+	if err := models.SetTotalStock(tx, product.ID, product.Stock, "Initial stock"); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add product stock"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add product"})
+	}
+	if err := models.RecordPrice(config.DB, product.ID, product.Price, nil, models.PriceSourceManual); err != nil {
+		log.Printf("Failed to record price history for product %d: %v", product.ID, err)
+	}
 
 	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Product added successfully", "product": product})
 }
@@ -51,18 +79,11 @@ func EditProduct(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	if product.Price < 0 {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Price cannot be negative"})
-	}
-	if product.Stock < 0 {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Stock cannot be negative"})
-	}
-
-	if len(product.Name) < 3 {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Product name must be at least 3 characters long"})
+	if msg := validateProduct(product); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
 	}
-	if len(product.Description) < 5 {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Product description must be at least 5 characters long"})
+	if msg := validateProductBrand(product.BrandID); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
 	}
 
 	var exists bool
@@ -75,18 +96,38 @@ func EditProduct(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found or unavailable"})
 	}
 
-	updateQuery := `UPDATE products SET name=$1, description=$2, price=$3, category_id=$4, stock=$5 WHERE id=$6 AND deleted=false`
-	_, err = config.DB.Exec(updateQuery, product.Name, product.Description, product.Price, product.CategoryID, product.Stock, product.ID)
+	tx, err := config.DB.Begin()
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update product"})
 	}
+	defer tx.Rollback()
+
+	updateQuery := `UPDATE products SET name=$1, description=$2, price=$3, category_id=$4, brand_id=$5 WHERE id=$6 AND deleted=false`
+	_, err = tx.Exec(updateQuery, product.Name, product.Description, product.Price, product.CategoryID, product.BrandID, product.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update product"})
+	}
+	err = models.SetTotalStock(tx, product.ID, product.Stock, "Product edit")
+	if err == models.ErrInsufficientWarehouseStock {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "The warehouses hold fewer units than the stock being removed; adjust it per warehouse instead"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update product stock"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update product"})
+	}
+	if err := models.RecordPrice(config.DB, product.ID, product.Price, nil, models.PriceSourceManual); err != nil {
+		log.Printf("Failed to record price history for product %d: %v", product.ID, err)
+	}
+	go utils.StockChanged(product.ID)
 
 	return c.JSON(fiber.Map{"message": "Product updated successfully"})
 }
 
 func SoftDeleteProduct(c *fiber.Ctx) error {
 	productID := c.Params("id")
-	query := `UPDATE products SET deleted=true WHERE id=$1`
+	query := `UPDATE products SET deleted=true, deleted_by_cascade=false, deleted_at=NOW() WHERE id=$1`
 	_, err := config.DB.Exec(query, productID)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete product"})
@@ -96,7 +137,17 @@ func SoftDeleteProduct(c *fiber.Ctx) error {
 }
 func RecoverProduct(c *fiber.Ctx) error {
 	productID := c.Params("id")
-	query := `UPDATE products SET deleted=false WHERE id=$1`
+
+	var categoryDeleted bool
+	checkQuery := `SELECT COALESCE(c.deleted, false) FROM products p LEFT JOIN categories c ON p.category_id = c.id WHERE p.id=$1`
+	if err := config.DB.QueryRow(checkQuery, productID).Scan(&categoryDeleted); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found"})
+	}
+	if categoryDeleted {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Recover the product's category first"})
+	}
+
+	query := `UPDATE products SET deleted=false, deleted_by_cascade=false, deleted_at=NULL WHERE id=$1`
 	_, err := config.DB.Exec(query, productID)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to recover product"})
@@ -117,7 +168,7 @@ func AdminViewProducts(c *fiber.Ctx) error {
 	var products []models.Product
 	for rows.Next() {
 		var product models.Product
-		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryID, &product.Stock, &product.Deleted); err != nil {
+		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryID, &product.Stock, &product.BrandID, &product.Deleted); err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to parse products",
 			})
@@ -130,18 +181,27 @@ func AdminViewProducts(c *fiber.Ctx) error {
 		"products": products,
 	})
 }
+
+// UpdateProductStock adjusts a product's stock at one warehouse by a signed
+// change and records why. The product's total is the sum over warehouses.
 func UpdateProductStock(c *fiber.Ctx) error {
 	var stockUpdate struct {
-		ProductID int `json:"product_id"`
-		Stock     int `json:"stock"`
+		ProductID   int    `json:"product_id"`
+		WarehouseID int    `json:"warehouse_id"`
+		Change      int    `json:"change"`
+		Reason      string `json:"reason"`
+		Note        string `json:"note"`
 	}
 
 	if err := c.BodyParser(&stockUpdate); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	if stockUpdate.Stock < 0 {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Stock cannot be negative"})
+	if stockUpdate.Change == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Change cannot be zero"})
+	}
+	if !models.ManualStockReasons[stockUpdate.Reason] {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Reason must be one of received, damage or count_correction"})
 	}
 
 	var exists bool
@@ -154,11 +214,31 @@ func UpdateProductStock(c *fiber.Ctx) error {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found or unavailable"})
 	}
 
-	updateQuery := `UPDATE products SET stock = $1 WHERE id = $2 AND deleted=false`
-	_, err = config.DB.Exec(updateQuery, stockUpdate.Stock, stockUpdate.ProductID)
+	checkQuery = `SELECT EXISTS (SELECT 1 FROM warehouses WHERE id=$1 AND active)`
+	if err := config.DB.QueryRow(checkQuery, stockUpdate.WarehouseID).Scan(&exists); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check warehouse existence"})
+	}
+	if !exists {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Warehouse not found or inactive"})
+	}
+
+	tx, err := config.DB.Begin()
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update product stock"})
 	}
+	defer tx.Rollback()
+
+	err = models.AdjustStock(tx, stockUpdate.ProductID, stockUpdate.WarehouseID, stockUpdate.Change, stockUpdate.Reason, stockUpdate.Note)
+	if err == models.ErrInsufficientWarehouseStock {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update product stock"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update product stock"})
+	}
+	go utils.StockChanged(stockUpdate.ProductID)
 
 	return c.JSON(fiber.Map{"message": "Stock updated successfully"})
 }
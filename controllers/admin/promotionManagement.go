@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"horizon/config"
+	"horizon/models"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func AddPromotion(c *fiber.Ctx) error {
+	promotion := new(models.Promotion)
+	if err := c.BodyParser(promotion); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	promotion.Name = strings.TrimSpace(promotion.Name)
+	if msg := promotion.Validate(); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	conditions, _ := json.Marshal(promotion.Conditions)
+	action, _ := json.Marshal(promotion.Action)
+	query := `
+		INSERT INTO promotions (name, description, priority, exclusive, conditions, action_type, action, start_date, end_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, active`
+	err := config.DB.QueryRow(query, promotion.Name, promotion.Description, promotion.Priority, promotion.Exclusive,
+		conditions, promotion.ActionType, action, promotion.StartDate, promotion.EndDate).Scan(&promotion.ID, &promotion.Active)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add promotion"})
+	}
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Promotion added successfully", "promotion": promotion})
+}
+
+func EditPromotion(c *fiber.Ctx) error {
+	promotionID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid promotion ID"})
+	}
+
+	var req struct {
+		models.Promotion
+		Active *bool `json:"active"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	promotion := &req.Promotion
+	promotion.Name = strings.TrimSpace(promotion.Name)
+	if msg := promotion.Validate(); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	// Leaving active out keeps the promotion's current state.
+	conditions, _ := json.Marshal(promotion.Conditions)
+	action, _ := json.Marshal(promotion.Action)
+	query := `
+		UPDATE promotions
+		SET name = $1, description = $2, priority = $3, exclusive = $4, conditions = $5, action_type = $6, action = $7,
+		    start_date = $8, end_date = $9, active = COALESCE($10, active), updated_at = NOW()
+		WHERE id = $11
+		RETURNING ` + models.PromotionColumns
+	updated, err := models.ScanPromotion(config.DB.QueryRow(query, promotion.Name, promotion.Description, promotion.Priority,
+		promotion.Exclusive, conditions, promotion.ActionType, action, promotion.StartDate, promotion.EndDate, req.Active, promotionID))
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Promotion not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update promotion"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Promotion updated successfully", "promotion": updated})
+}
+
+// DeactivatePromotion switches a promotion off. Promotions are never deleted
+// since orders keep a record of the ones that discounted them.
+func DeactivatePromotion(c *fiber.Ctx) error {
+	promotionID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid promotion ID"})
+	}
+
+	result, err := config.DB.Exec(`UPDATE promotions SET active = false, updated_at = NOW() WHERE id = $1`, promotionID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to deactivate promotion"})
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Promotion not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Promotion deactivated successfully"})
+}
+
+func AdminViewPromotions(c *fiber.Ctx) error {
+	rows, err := config.DB.Query(`SELECT ` + models.PromotionColumns + ` FROM promotions ORDER BY active DESC, priority DESC, id`)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch promotions"})
+	}
+	defer rows.Close()
+
+	promotions := []models.Promotion{}
+	for rows.Next() {
+		promotion, err := models.ScanPromotion(rows)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse promotions"})
+		}
+		promotions = append(promotions, promotion)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "Promotions fetched successfully",
+		"promotions": promotions,
+	})
+}
@@ -0,0 +1,336 @@
+package admin
+
+import (
+	"fmt"
+	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// CreatePurchaseOrder drafts an order to a supplier for delivery into one
+// warehouse. Drafts can still be cancelled freely; PlacePurchaseOrder marks
+// them as sent.
+func CreatePurchaseOrder(c *fiber.Ctx) error {
+	var req struct {
+		SupplierID   int    `json:"supplier_id"`
+		WarehouseID  int    `json:"warehouse_id"`
+		ExpectedDate string `json:"expected_date"`
+		Notes        string `json:"notes"`
+		Items        []struct {
+			ProductID int     `json:"product_id"`
+			Quantity  int     `json:"quantity"`
+			UnitCost  float64 `json:"unit_cost"`
+		} `json:"items"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if len(req.Items) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "A purchase order needs at least one item"})
+	}
+	seen := map[int]bool{}
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Item quantities must be positive"})
+		}
+		if item.UnitCost < 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unit cost cannot be negative"})
+		}
+		if seen[item.ProductID] {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Each product can appear only once"})
+		}
+		seen[item.ProductID] = true
+	}
+
+	var expectedDate *time.Time
+	if req.ExpectedDate != "" {
+		date, err := time.Parse("2006-01-02", req.ExpectedDate)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid expected_date format"})
+		}
+		expectedDate = &date
+	}
+
+	var exists bool
+	checkQuery := `SELECT EXISTS (SELECT 1 FROM suppliers WHERE id=$1 AND active)`
+	if err := config.DB.QueryRow(checkQuery, req.SupplierID).Scan(&exists); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check supplier"})
+	}
+	if !exists {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Supplier not found or inactive"})
+	}
+	checkQuery = `SELECT EXISTS (SELECT 1 FROM warehouses WHERE id=$1 AND active)`
+	if err := config.DB.QueryRow(checkQuery, req.WarehouseID).Scan(&exists); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check warehouse"})
+	}
+	if !exists {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Warehouse not found or inactive"})
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create purchase order"})
+	}
+	defer tx.Rollback()
+
+	poNumber := fmt.Sprintf("PO-%d", time.Now().UnixNano())
+	var poID int
+	insertQuery := `
+		INSERT INTO purchase_orders (po_number, supplier_id, warehouse_id, expected_date, notes)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+		RETURNING id`
+	if err := tx.QueryRow(insertQuery, poNumber, req.SupplierID, req.WarehouseID, expectedDate, req.Notes).Scan(&poID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create purchase order"})
+	}
+
+	for _, item := range req.Items {
+		_, err := tx.Exec(`
+			INSERT INTO purchase_order_items (purchase_order_id, product_id, quantity_ordered, unit_cost)
+			SELECT $1, id, $3, $4 FROM products WHERE id = $2 AND deleted = false`,
+			poID, item.ProductID, item.Quantity, item.UnitCost)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add purchase order items"})
+		}
+	}
+
+	var itemCount int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM purchase_order_items WHERE purchase_order_id = $1`, poID).Scan(&itemCount); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add purchase order items"})
+	}
+	if itemCount != len(req.Items) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "One or more products were not found"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create purchase order"})
+	}
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Purchase order created", "id": poID, "po_number": poNumber})
+}
+
+func PlacePurchaseOrder(c *fiber.Ctx) error {
+	return setPurchaseOrderStatus(c, models.PurchaseOrderOrdered, []string{models.PurchaseOrderDraft})
+}
+
+// CancelPurchaseOrder cancels an order that nothing has been received
+// against yet.
+func CancelPurchaseOrder(c *fiber.Ctx) error {
+	return setPurchaseOrderStatus(c, models.PurchaseOrderCancelled, []string{models.PurchaseOrderDraft, models.PurchaseOrderOrdered})
+}
+
+func setPurchaseOrderStatus(c *fiber.Ctx, status string, from []string) error {
+	poID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid purchase order ID"})
+	}
+
+	query := `UPDATE purchase_orders SET status = $1, updated_at = NOW() WHERE id = $2 AND status = ANY($3)`
+	result, err := config.DB.Exec(query, status, poID, pq.Array(from))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update purchase order"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Purchase order not found or not in a state that allows this"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Purchase order " + status})
+}
+
+// ReceiveGoods records a goods-received note against a purchase order. Each
+// line adds to the warehouse's stock as a "received" adjustment; a delivery
+// may cover only part of the order, and the order stays open until every
+// line is received in full.
+func ReceiveGoods(c *fiber.Ctx) error {
+	poID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid purchase order ID"})
+	}
+
+	var req struct {
+		LandedCost float64 `json:"landed_cost"`
+		Note       string  `json:"note"`
+		Items      []struct {
+			PurchaseOrderItemID int `json:"purchase_order_item_id"`
+			Quantity            int `json:"quantity"`
+		} `json:"items"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if len(req.Items) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "A receipt needs at least one item"})
+	}
+	if req.LandedCost < 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Landed cost cannot be negative"})
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record receipt"})
+	}
+	defer tx.Rollback()
+
+	var status, poNumber string
+	var warehouseID int
+	poQuery := `SELECT status, po_number, warehouse_id FROM purchase_orders WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(poQuery, poID).Scan(&status, &poNumber, &warehouseID); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Purchase order not found"})
+	}
+	if status != models.PurchaseOrderOrdered && status != models.PurchaseOrderPartiallyReceived {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Goods can only be received against a placed purchase order"})
+	}
+
+	var lines []models.GoodsReceiptItem
+	seen := map[int]bool{}
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Received quantities must be positive"})
+		}
+		if seen[item.PurchaseOrderItemID] {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Each purchase order item can appear only once"})
+		}
+		seen[item.PurchaseOrderItemID] = true
+		var line models.GoodsReceiptItem
+		var outstanding int
+		lineQuery := `
+			SELECT product_id, unit_cost, quantity_ordered - quantity_received
+			FROM purchase_order_items
+			WHERE id = $1 AND purchase_order_id = $2`
+		if err := tx.QueryRow(lineQuery, item.PurchaseOrderItemID, poID).Scan(&line.ProductID, &line.UnitCost, &outstanding); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Item %d is not on this purchase order", item.PurchaseOrderItemID)})
+		}
+		if item.Quantity > outstanding {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Item %d has only %d units outstanding", item.PurchaseOrderItemID, outstanding)})
+		}
+		line.PurchaseOrderItemID = item.PurchaseOrderItemID
+		line.Quantity = item.Quantity
+		lines = append(lines, line)
+	}
+	models.SpreadLandedCost(lines, req.LandedCost)
+
+	receipt := models.GoodsReceipt{WarehouseID: warehouseID, LandedCost: req.LandedCost, Note: req.Note, Items: lines}
+	receiptQuery := `
+		INSERT INTO goods_receipts (purchase_order_id, warehouse_id, landed_cost, note)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING id, received_at`
+	if err := tx.QueryRow(receiptQuery, poID, warehouseID, req.LandedCost, req.Note).Scan(&receipt.ID, &receipt.ReceivedAt); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record receipt"})
+	}
+
+	var productIDs []int
+	note := fmt.Sprintf("%s receipt %d", poNumber, receipt.ID)
+	for _, line := range lines {
+		_, err := tx.Exec(`
+			INSERT INTO goods_receipt_items (goods_receipt_id, purchase_order_item_id, product_id, quantity, unit_cost, landed_unit_cost)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			receipt.ID, line.PurchaseOrderItemID, line.ProductID, line.Quantity, line.UnitCost, line.LandedUnitCost)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record receipt"})
+		}
+		if _, err := tx.Exec(`UPDATE purchase_order_items SET quantity_received = quantity_received + $1 WHERE id = $2`, line.Quantity, line.PurchaseOrderItemID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record receipt"})
+		}
+		if err := models.AdjustStock(tx, line.ProductID, warehouseID, line.Quantity, models.StockReasonReceived, note); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update stock"})
+		}
+		productIDs = append(productIDs, line.ProductID)
+	}
+
+	statusQuery := `
+		UPDATE purchase_orders SET updated_at = NOW(), status = CASE
+			WHEN EXISTS (SELECT 1 FROM purchase_order_items WHERE purchase_order_id = $1 AND quantity_received < quantity_ordered)
+			THEN $2 ELSE $3 END
+		WHERE id = $1
+		RETURNING status`
+	if err := tx.QueryRow(statusQuery, poID, models.PurchaseOrderPartiallyReceived, models.PurchaseOrderReceived).Scan(&status); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update purchase order"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record receipt"})
+	}
+	go utils.StockChanged(productIDs...)
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message": "Goods received",
+		"status":  status,
+		"receipt": receipt,
+	})
+}
+
+func AdminViewPurchaseOrders(c *fiber.Ctx) error {
+	status := c.Query("status")
+
+	orders := []models.PurchaseOrder{}
+	query := `
+		SELECT po.id, po.po_number, po.supplier_id, s.name AS supplier_name, po.warehouse_id, po.status,
+		       po.expected_date, COALESCE(po.notes, '') AS notes, po.created_at
+		FROM purchase_orders po
+		JOIN suppliers s ON s.id = po.supplier_id
+		WHERE $1 = '' OR po.status = $1
+		ORDER BY po.created_at DESC`
+	if err := config.DB.Select(&orders, query, status); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch purchase orders"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":         "Purchase orders fetched successfully",
+		"purchase_orders": orders,
+	})
+}
+
+// ViewPurchaseOrder returns one purchase order with its lines and every
+// goods-received note recorded against it.
+func ViewPurchaseOrder(c *fiber.Ctx) error {
+	poID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid purchase order ID"})
+	}
+
+	var order models.PurchaseOrder
+	query := `
+		SELECT po.id, po.po_number, po.supplier_id, s.name AS supplier_name, po.warehouse_id, po.status,
+		       po.expected_date, COALESCE(po.notes, '') AS notes, po.created_at
+		FROM purchase_orders po
+		JOIN suppliers s ON s.id = po.supplier_id
+		WHERE po.id = $1`
+	if err := config.DB.Get(&order, query, poID); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Purchase order not found"})
+	}
+
+	itemsQuery := `
+		SELECT i.id, i.product_id, p.name AS product_name, i.quantity_ordered, i.quantity_received, i.unit_cost
+		FROM purchase_order_items i
+		JOIN products p ON p.id = i.product_id
+		WHERE i.purchase_order_id = $1
+		ORDER BY i.id`
+	if err := config.DB.Select(&order.Items, itemsQuery, poID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch purchase order items"})
+	}
+
+	receiptsQuery := `
+		SELECT id, warehouse_id, landed_cost, COALESCE(note, '') AS note, received_at
+		FROM goods_receipts
+		WHERE purchase_order_id = $1
+		ORDER BY received_at`
+	if err := config.DB.Select(&order.Receipts, receiptsQuery, poID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch receipts"})
+	}
+	for i := range order.Receipts {
+		receiptItemsQuery := `
+			SELECT purchase_order_item_id, product_id, quantity, unit_cost, landed_unit_cost
+			FROM goods_receipt_items
+			WHERE goods_receipt_id = $1
+			ORDER BY id`
+		if err := config.DB.Select(&order.Receipts[i].Items, receiptItemsQuery, order.Receipts[i].ID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch receipts"})
+		}
+	}
+
+	return c.JSON(fiber.Map{"purchase_order": order})
+}
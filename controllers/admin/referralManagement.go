@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UpdateReferralSettings sets the wallet rewards paid for a converted
+// referral. Leaving active out keeps the program's current state.
+func UpdateReferralSettings(c *fiber.Ctx) error {
+	var req struct {
+		ReferrerReward float64 `json:"referrer_reward"`
+		RefereeReward  float64 `json:"referee_reward"`
+		Active         *bool   `json:"active"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if req.ReferrerReward < 0 || req.RefereeReward < 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Rewards cannot be negative"})
+	}
+
+	var settings models.ReferralSettings
+	query := `
+		UPDATE referral_settings
+		SET referrer_reward = $1, referee_reward = $2, active = COALESCE($3, active)
+		RETURNING referrer_reward, referee_reward, active`
+	if err := config.DB.Get(&settings, query, req.ReferrerReward, req.RefereeReward, req.Active); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update referral settings"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Referral settings updated successfully", "settings": settings})
+}
+
+// ReferralReport summarises referrals made between start and end: how many
+// converted into a delivered first order, how many were rejected and why,
+// how many were reversed by a return, the rewards paid and kept, and the top
+// referrers. Both dates default to the current
+// month.
+func ReferralReport(c *fiber.Ctx) error {
+	now := time.Now()
+	startDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	endDate := now
+
+	var err error
+	if start := c.Query("start"); start != "" {
+		if startDate, err = time.Parse("2006-01-02", start); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid start date"})
+		}
+	}
+	if end := c.Query("end"); end != "" {
+		if endDate, err = time.Parse("2006-01-02", end); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid end date"})
+		}
+		endDate = endDate.AddDate(0, 0, 1)
+	}
+
+	var summary struct {
+		Referred       int     `json:"referred" db:"referred"`
+		Pending        int     `json:"pending" db:"pending"`
+		Converted      int     `json:"converted" db:"converted"`
+		Rejected       int     `json:"rejected" db:"rejected"`
+		Reversed       int     `json:"reversed" db:"reversed"`
+		RewardsPaid    float64 `json:"rewards_paid" db:"rewards_paid"`
+		ConversionRate float64 `json:"conversion_rate" db:"conversion_rate"`
+	}
+	summaryQuery := `
+		SELECT COUNT(*) AS referred,
+		       COUNT(*) FILTER (WHERE status = 'Pending') AS pending,
+		       COUNT(*) FILTER (WHERE status = 'Rewarded') AS converted,
+		       COUNT(*) FILTER (WHERE status = 'Rejected') AS rejected,
+		       COUNT(*) FILTER (WHERE status = 'Reversed') AS reversed,
+		       COALESCE(SUM(referrer_reward + referee_reward) FILTER (WHERE status = 'Rewarded'), 0) AS rewards_paid,
+		       ROUND(COALESCE(100.0 * COUNT(*) FILTER (WHERE status = 'Rewarded')
+		             / NULLIF(COUNT(*) FILTER (WHERE status <> 'Rejected'), 0), 0), 2) AS conversion_rate
+		FROM referrals
+		WHERE created_at >= $1 AND created_at < $2`
+	if err := config.DB.Get(&summary, summaryQuery, startDate, endDate); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to compute referral summary"})
+	}
+
+	rejections := []struct {
+		Reason string `json:"reason" db:"reason"`
+		Count  int    `json:"count" db:"count"`
+	}{}
+	rejectionQuery := `
+		SELECT rejection_reason AS reason, COUNT(*) AS count
+		FROM referrals
+		WHERE status = 'Rejected' AND created_at >= $1 AND created_at < $2
+		GROUP BY rejection_reason
+		ORDER BY count DESC`
+	if err := config.DB.Select(&rejections, rejectionQuery, startDate, endDate); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to compute referral rejections"})
+	}
+
+	referrers := []struct {
+		UserID    int     `json:"user_id" db:"user_id"`
+		Name      string  `json:"name" db:"name"`
+		Email     string  `json:"email" db:"email"`
+		Referred  int     `json:"referred" db:"referred"`
+		Converted int     `json:"converted" db:"converted"`
+		Earned    float64 `json:"earned" db:"earned"`
+	}{}
+	referrersQuery := `
+		SELECT u.id AS user_id, u.name, u.email, COUNT(*) AS referred,
+		       COUNT(*) FILTER (WHERE r.status = 'Rewarded') AS converted,
+		       COALESCE(SUM(r.referrer_reward) FILTER (WHERE r.status = 'Rewarded'), 0) AS earned
+		FROM referrals r
+		JOIN users u ON u.id = r.referrer_id
+		WHERE r.created_at >= $1 AND r.created_at < $2
+		GROUP BY u.id, u.name, u.email
+		ORDER BY converted DESC, referred DESC
+		LIMIT 20`
+	if err := config.DB.Select(&referrers, referrersQuery, startDate, endDate); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to compute top referrers"})
+	}
+
+	settings, err := models.LoadReferralSettings(config.DB)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch referral settings"})
+	}
+
+	return c.JSON(fiber.Map{
+		"start":         startDate.Format("2006-01-02"),
+		"end":           endDate.AddDate(0, 0, -1).Format("2006-01-02"),
+		"settings":      settings,
+		"summary":       summary,
+		"rejections":    rejections,
+		"top_referrers": referrers,
+	})
+}
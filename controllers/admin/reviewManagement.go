@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"database/sql"
+	"horizon/config"
+	"horizon/models"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func AdminViewReviews(c *fiber.Ctx) error {
+	status := c.Query("status", models.ReviewPending)
+
+	reviews := []models.Review{}
+	query := `
+		SELECT r.id, r.product_id, r.user_id, u.name AS user_name, r.rating, COALESCE(r.title, '') AS title,
+		       COALESCE(r.body, '') AS body, r.status, r.helpful_count, r.created_at
+		FROM product_reviews r
+		JOIN users u ON r.user_id = u.id
+		WHERE r.status = $1
+		ORDER BY r.created_at`
+	if err := config.DB.Select(&reviews, query, status); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch reviews"})
+	}
+	if err := models.AttachReviewPhotos(reviews); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch review photos"})
+	}
+
+	return c.JSON(fiber.Map{"reviews": reviews})
+}
+
+// ModerateReview approves or hides a review and refreshes the product's
+// stored rating, which only counts approved reviews. A review's first
+// approval earns its author the loyalty review bonus.
+func ModerateReview(c *fiber.Ctx) error {
+	reviewID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid review ID"})
+	}
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if req.Status != models.ReviewApproved && req.Status != models.ReviewHidden {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Status must be Approved or Hidden"})
+	}
+
+	var productID, userID int
+	query := `UPDATE product_reviews SET status = $1, updated_at = NOW() WHERE id = $2 RETURNING product_id, user_id`
+	err = config.DB.QueryRow(query, req.Status, reviewID).Scan(&productID, &userID)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Review not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update review"})
+	}
+
+	if err := models.RefreshProductRating(productID); err != nil {
+		log.Printf("Failed to refresh rating for product %d: %v", productID, err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update product rating"})
+	}
+
+	if req.Status == models.ReviewApproved {
+		if err := models.AwardReviewBonus(config.DB, userID, reviewID); err != nil {
+			log.Printf("Failed to award review bonus for review %d: %v", reviewID, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to award review bonus"})
+		}
+	}
+
+	return c.JSON(fiber.Map{"message": "Review status updated successfully", "status": req.Status})
+}
@@ -18,17 +18,19 @@ func fetchSalesData(startDate, endDate time.Time) ([]models.SalesItem, int, floa
             p.id AS product_id,
             p.name AS product_name,
             p.description AS product_description,
+            COALESCE(b.name, '') AS brand_name,
             SUM(oi.quantity) AS total_quantity,
             SUM(oi.subtotal) AS total_amount,
             SUM(o.offer_discount) AS total_offer_discount,
             SUM(o.coupon_discount) AS total_coupon_discount,
-            SUM(oi.subtotal - o.offer_discount - o.coupon_discount) AS total_revenue
+            SUM(oi.subtotal - o.offer_discount - o.coupon_discount - o.promotion_discount - o.loyalty_discount) AS total_revenue
         FROM order_items oi
         JOIN orders o ON oi.order_id = o.id
         JOIN products p ON oi.product_id = p.id
+        LEFT JOIN brands b ON p.brand_id = b.id
         WHERE o.order_date BETWEEN $1 AND $2
           AND o.status IN ('Delivered', 'Returned', 'Canceled')
-        GROUP BY p.id, p.name, p.description
+        GROUP BY p.id, p.name, p.description, b.name
     `
 	rows, err := config.DB.Queryx(query, startDate, endDate)
 	if err != nil {
@@ -60,6 +62,29 @@ func fetchSalesData(startDate, endDate time.Time) ([]models.SalesItem, int, floa
 
 	return items, totalSalesCount, totalRevenue, totalDiscount, nil
 }
+
+// fetchBrandSales totals sold quantity and amount per brand over the same
+// orders as fetchSalesData. Unbranded products are grouped together.
+func fetchBrandSales(startDate, endDate time.Time) ([]models.BrandSales, error) {
+	query := `
+        SELECT 
+            COALESCE(b.name, 'Unbranded') AS brand_name,
+            SUM(oi.quantity) AS total_quantity,
+            SUM(oi.subtotal) AS total_amount
+        FROM order_items oi
+        JOIN orders o ON oi.order_id = o.id
+        JOIN products p ON oi.product_id = p.id
+        LEFT JOIN brands b ON p.brand_id = b.id
+        WHERE o.order_date BETWEEN $1 AND $2
+          AND o.status IN ('Delivered', 'Returned', 'Canceled')
+        GROUP BY b.id, b.name
+        ORDER BY total_amount DESC
+    `
+	var brands []models.BrandSales
+	err := config.DB.Select(&brands, query, startDate, endDate)
+	return brands, err
+}
+
 func GenerateSalesReport(c *fiber.Ctx) error {
 	timeFilter := c.Query("timeFilter")
 	fileType := c.Query("fileType")
@@ -99,6 +124,10 @@ func GenerateSalesReport(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString("Failed to fetch sales data")
 	}
+	brands, err := fetchBrandSales(startDate, endDate)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to fetch brand sales data")
+	}
 
 	report := models.SalesReport{
 		CompanyName:     "HORIZON ECOM",
@@ -108,6 +137,7 @@ func GenerateSalesReport(c *fiber.Ctx) error {
 		TotalRevenue:    totalRevenue,
 		TotalDiscount:   totalDiscount,
 		Items:           items,
+		Brands:          brands,
 	}
 
 	switch fileType {
@@ -144,7 +174,8 @@ func generateSalesReportPDF(report models.SalesReport) error {
 
 	pdf.SetFont("Arial", "B", 10)
 	pdf.Cell(20, 10, "Product ID")
-	pdf.Cell(50, 10, "Item Name")
+	pdf.Cell(30, 10, "Item Name")
+	pdf.Cell(20, 10, "Brand")
 	pdf.Cell(25, 10, "Quantity")
 	pdf.Cell(25, 10, "Amount")
 	pdf.Cell(25, 10, "Offer")
@@ -155,7 +186,8 @@ func generateSalesReportPDF(report models.SalesReport) error {
 	for _, item := range report.Items {
 		pdf.SetFont("Arial", "", 10)
 		pdf.Cell(20, 10, fmt.Sprintf("%d", item.ProductID))
-		pdf.Cell(50, 10, item.ProductName)
+		pdf.Cell(30, 10, item.ProductName)
+		pdf.Cell(20, 10, item.BrandName)
 		pdf.Cell(25, 10, fmt.Sprintf("%d", item.TotalQuantity))
 		pdf.Cell(25, 10, fmt.Sprintf("%.2f", item.TotalAmount))
 		pdf.Cell(25, 10, fmt.Sprintf("%.2f", item.TotalOfferDiscount))
@@ -166,6 +198,22 @@ func generateSalesReportPDF(report models.SalesReport) error {
 
 	pdf.Ln(10)
 
+	pdf.SetFont("Arial", "B", 10)
+	pdf.Cell(60, 10, "Brand")
+	pdf.Cell(25, 10, "Quantity")
+	pdf.Cell(25, 10, "Amount")
+	pdf.Ln(6)
+
+	for _, brand := range report.Brands {
+		pdf.SetFont("Arial", "", 10)
+		pdf.Cell(60, 10, brand.BrandName)
+		pdf.Cell(25, 10, fmt.Sprintf("%d", brand.TotalQuantity))
+		pdf.Cell(25, 10, fmt.Sprintf("%.2f", brand.TotalAmount))
+		pdf.Ln(6)
+	}
+
+	pdf.Ln(10)
+
 	pdf.SetFont("Arial", "B", 12)
 	pdf.Cell(100, 10, fmt.Sprintf("Total Sales Count: %d", report.TotalSalesCount))
 	pdf.Ln(6)
@@ -193,16 +241,31 @@ func generateSalesReportExcel(report models.SalesReport) error {
 
 	f.SetCellValue(sheetName, "A6", "Item Number")
 	f.SetCellValue(sheetName, "B6", "Item Name")
-	f.SetCellValue(sheetName, "C6", "Quantity")
-	f.SetCellValue(sheetName, "D6", "Amount")
+	f.SetCellValue(sheetName, "C6", "Brand")
+	f.SetCellValue(sheetName, "D6", "Quantity")
+	f.SetCellValue(sheetName, "E6", "Amount")
 
 	row := 7
 
 	for _, item := range report.Items {
 		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), item.ProductID)
 		f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), item.ProductName)
-		f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), item.TotalQuantity)
-		f.SetCellValue(sheetName, fmt.Sprintf("D%d", row), item.TotalRevenue)
+		f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), item.BrandName)
+		f.SetCellValue(sheetName, fmt.Sprintf("D%d", row), item.TotalQuantity)
+		f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), item.TotalRevenue)
+		row++
+	}
+
+	row++
+	f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), "Brand")
+	f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), "Quantity")
+	f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), "Amount")
+	row++
+
+	for _, brand := range report.Brands {
+		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), brand.BrandName)
+		f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), brand.TotalQuantity)
+		f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), brand.TotalAmount)
 		row++
 	}
 
@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetReorderThreshold sets the stock level below which a product raises a
+// low-stock alert. A threshold of zero disables alerts for the product.
+func SetReorderThreshold(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var req struct {
+		Threshold int `json:"threshold"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if req.Threshold < 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Threshold cannot be negative"})
+	}
+
+	result, err := config.DB.Exec(`UPDATE products SET reorder_threshold = $1 WHERE id = $2 AND deleted = false`, req.Threshold, productID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update reorder threshold"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found or unavailable"})
+	}
+	go utils.StockChanged(productID)
+
+	return c.JSON(fiber.Map{"message": "Reorder threshold updated successfully"})
+}
+
+// ViewStockAlerts lists low-stock alerts, open ones by default. Pass
+// status=resolved or status=all to include alerts that have been restocked.
+func ViewStockAlerts(c *fiber.Ctx) error {
+	var filter string
+	switch c.Query("status", "open") {
+	case "open":
+		filter = "WHERE a.resolved_at IS NULL"
+	case "resolved":
+		filter = "WHERE a.resolved_at IS NOT NULL"
+	case "all":
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid status"})
+	}
+
+	alerts := []models.StockAlert{}
+	query := `
+		SELECT a.id, a.product_id, p.name AS product_name, a.stock, a.threshold,
+		       p.stock AS current_stock, a.created_at, a.resolved_at
+		FROM stock_alerts a
+		JOIN products p ON p.id = a.product_id
+		` + filter + `
+		ORDER BY a.created_at DESC`
+	if err := config.DB.Select(&alerts, query); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch stock alerts"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Stock alerts fetched successfully",
+		"alerts":  alerts,
+	})
+}
@@ -0,0 +1,99 @@
+package admin
+
+import (
+	"database/sql"
+	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func validateSupplier(supplier *models.Supplier) string {
+	supplier.Name = strings.TrimSpace(supplier.Name)
+	if len(supplier.Name) < 2 {
+		return "Supplier name must be at least 2 characters long"
+	}
+	supplier.Email = strings.TrimSpace(supplier.Email)
+	if supplier.Email != "" && !utils.IsValidEmail(supplier.Email) {
+		return "Invalid supplier email"
+	}
+	return ""
+}
+
+func AddSupplier(c *fiber.Ctx) error {
+	supplier := new(models.Supplier)
+	if err := c.BodyParser(supplier); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if msg := validateSupplier(supplier); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	query := `
+		INSERT INTO suppliers (name, contact_name, email, phone, address)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO NOTHING
+		RETURNING id, active`
+	err := config.DB.QueryRow(query, supplier.Name, supplier.ContactName, supplier.Email, supplier.Phone, supplier.Address).Scan(&supplier.ID, &supplier.Active)
+	if err != nil {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "A supplier with this name already exists"})
+	}
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Supplier added successfully", "supplier": supplier})
+}
+
+func EditSupplier(c *fiber.Ctx) error {
+	supplierID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid supplier ID"})
+	}
+
+	var req struct {
+		models.Supplier
+		Active *bool `json:"active"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	supplier := &req.Supplier
+	if msg := validateSupplier(supplier); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	supplier.ID = supplierID
+
+	// Leaving active out keeps the supplier's current state.
+	query := `
+		UPDATE suppliers
+		SET name = $1, contact_name = $2, email = $3, phone = $4, address = $5, active = COALESCE($6, active), updated_at = NOW()
+		WHERE id = $7
+		RETURNING active`
+	err = config.DB.QueryRow(query, supplier.Name, supplier.ContactName, supplier.Email, supplier.Phone, supplier.Address, req.Active, supplierID).Scan(&supplier.Active)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Supplier not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update supplier"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Supplier updated successfully", "supplier": supplier})
+}
+
+func AdminViewSuppliers(c *fiber.Ctx) error {
+	suppliers := []models.Supplier{}
+	query := `
+		SELECT id, name, COALESCE(contact_name, '') AS contact_name, COALESCE(email, '') AS email,
+		       COALESCE(phone, '') AS phone, COALESCE(address, '') AS address, active
+		FROM suppliers
+		ORDER BY active DESC, name`
+	if err := config.DB.Select(&suppliers, query); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch suppliers"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":   "Suppliers fetched successfully",
+		"suppliers": suppliers,
+	})
+}
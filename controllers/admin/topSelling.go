@@ -87,6 +87,41 @@ func FetchTopSellingData() (models.DashboardReport, error) {
 		data.TopCategories = append(data.TopCategories, category)
 	}
 
+	brandQuery := `
+		SELECT 
+			b.name AS brand_name, 
+			SUM(oi.quantity) AS total_sold
+		FROM 
+			order_items oi
+		JOIN 
+			products p ON oi.product_id = p.id
+		JOIN 
+			brands b ON p.brand_id = b.id
+		JOIN 
+			orders o ON oi.order_id = o.id
+		WHERE 
+		o.payment_status IN ('Paid', 'Completed')
+		GROUP BY 
+			b.id
+		ORDER BY 
+			total_sold DESC
+		LIMIT 10;
+	`
+
+	rows, err = config.DB.Queryx(brandQuery)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var brand models.BrandReport
+		if err := rows.StructScan(&brand); err != nil {
+			return data, err
+		}
+		data.TopBrands = append(data.TopBrands, brand)
+	}
+
 	return data, nil
 }
 
@@ -95,7 +130,7 @@ func GenerateTopSellingPDF(data models.DashboardReport) (*bytes.Buffer, error) {
 
 	pdf.AddPage()
 	pdf.SetFont("Arial", "B", 16)
-	pdf.Cell(190, 10, "Top Selling Products and Categories Report")
+	pdf.Cell(190, 10, "Top Selling Products, Categories and Brands Report")
 	pdf.Ln(10)
 
 	pdf.SetFont("Arial", "", 12)
@@ -127,6 +162,19 @@ func GenerateTopSellingPDF(data models.DashboardReport) (*bytes.Buffer, error) {
 		pdf.Ln(10)
 	}
 
+	pdf.Ln(10)
+
+	pdf.SetFont("Arial", "B", 14)
+	pdf.Cell(190, 10, "Top 10 Best-Selling Brands")
+	pdf.Ln(10)
+
+	for _, brand := range data.TopBrands {
+		pdf.SetFont("Arial", "", 12)
+		pdf.Cell(100, 10, brand.BrandName)
+		pdf.Cell(30, 10, fmt.Sprintf("Sold: %d", brand.TotalSold))
+		pdf.Ln(10)
+	}
+
 	var buf bytes.Buffer
 	err := pdf.Output(&buf)
 	if err != nil {
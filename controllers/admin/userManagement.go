@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"horizon/config"
 	"horizon/models"
+	queries "horizon/sql"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
@@ -62,3 +63,35 @@ func UnblockUser(c *fiber.Ctx) error {
 
 	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "User unblocked successfully"})
 }
+
+func ViewDeletionRequests(c *fiber.Ctx) error {
+	status := c.Query("status", "Pending")
+
+	query := `
+		SELECT r.id, r.user_id, u.name, u.email, COALESCE(r.reason, '') AS reason, r.status,
+		       r.requested_at, r.scheduled_for, COALESCE(u.wallet_balance, 0),
+		       (SELECT COUNT(*) FROM orders o WHERE o.user_id = r.user_id AND ` + queries.OrderInFlightCondition + `)
+		FROM account_deletion_requests r
+		JOIN users u ON r.user_id = u.id
+		WHERE r.status = $1
+		ORDER BY r.scheduled_for
+	`
+	rows, err := config.DB.Query(query, status)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch deletion requests"})
+	}
+	defer rows.Close()
+
+	var requests []models.DeletionRequest
+	for rows.Next() {
+		var request models.DeletionRequest
+		if err := rows.Scan(&request.ID, &request.UserID, &request.UserName, &request.UserEmail, &request.Reason, &request.Status, &request.RequestedAt, &request.ScheduledFor,
+			&request.WalletBalance, &request.OrdersInFlight); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse deletion requests"})
+		}
+		requests = append(requests, request)
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"deletion_requests": requests})
+}
@@ -0,0 +1,320 @@
+package admin
+
+import (
+	"fmt"
+	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func validateWarehouse(warehouse *models.Warehouse) string {
+	warehouse.Name = strings.TrimSpace(warehouse.Name)
+	if len(warehouse.Name) < 3 {
+		return "Warehouse name must be at least 3 characters long"
+	}
+	warehouse.ZipCode = strings.TrimSpace(warehouse.ZipCode)
+	if warehouse.ZipCode == "" {
+		return "Zip code is required"
+	}
+	return ""
+}
+
+func AddWarehouse(c *fiber.Ctx) error {
+	warehouse := new(models.Warehouse)
+	if err := c.BodyParser(warehouse); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if msg := validateWarehouse(warehouse); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	query := `INSERT INTO warehouses (name, address_line, city, zip_code) VALUES ($1, $2, $3, $4) RETURNING id, active`
+	err := config.DB.QueryRow(query, warehouse.Name, warehouse.AddressLine, warehouse.City, warehouse.ZipCode).Scan(&warehouse.ID, &warehouse.Active)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add warehouse"})
+	}
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Warehouse added successfully", "warehouse": warehouse})
+}
+
+// EditWarehouse updates a warehouse's details. Making it the default moves
+// the flag from the previous default; a warehouse can only be deactivated
+// once it holds no stock, and the default one never.
+func EditWarehouse(c *fiber.Ctx) error {
+	warehouseID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid warehouse ID"})
+	}
+
+	var req struct {
+		models.Warehouse
+		IsDefault *bool `json:"is_default"`
+		Active    *bool `json:"active"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	warehouse := &req.Warehouse
+	if msg := validateWarehouse(warehouse); msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	warehouse.ID = warehouseID
+
+	var isDefault, active bool
+	var onHand int
+	checkQuery := `
+		SELECT w.is_default, w.active, COALESCE((SELECT SUM(quantity) FROM warehouse_stock WHERE warehouse_id = w.id), 0)
+		FROM warehouses w WHERE w.id = $1`
+	if err := config.DB.QueryRow(checkQuery, warehouseID).Scan(&isDefault, &active, &onHand); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Warehouse not found"})
+	}
+	warehouse.IsDefault, warehouse.Active = isDefault, active
+	if req.IsDefault != nil {
+		warehouse.IsDefault = *req.IsDefault
+	}
+	if req.Active != nil {
+		warehouse.Active = *req.Active
+	}
+
+	if !warehouse.Active && warehouse.IsDefault {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "The default warehouse cannot be deactivated"})
+	}
+	if !warehouse.Active && onHand != 0 {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Transfer this warehouse's stock out before deactivating it"})
+	}
+	if isDefault && !warehouse.IsDefault {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Make another warehouse the default instead"})
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update warehouse"})
+	}
+	defer tx.Rollback()
+
+	if warehouse.IsDefault && !isDefault {
+		if _, err := tx.Exec(`UPDATE warehouses SET is_default = false WHERE is_default`); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update warehouse"})
+		}
+	}
+
+	updateQuery := `
+		UPDATE warehouses
+		SET name = $1, address_line = $2, city = $3, zip_code = $4, is_default = $5, active = $6, updated_at = NOW()
+		WHERE id = $7`
+	_, err = tx.Exec(updateQuery, warehouse.Name, warehouse.AddressLine, warehouse.City, warehouse.ZipCode, warehouse.IsDefault, warehouse.Active, warehouseID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update warehouse"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update warehouse"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Warehouse updated successfully", "warehouse": warehouse})
+}
+
+func AdminViewWarehouses(c *fiber.Ctx) error {
+	warehouses := []models.Warehouse{}
+	query := `
+		SELECT id, name, COALESCE(address_line, '') AS address_line, COALESCE(city, '') AS city, zip_code, is_default, active
+		FROM warehouses
+		ORDER BY is_default DESC, name`
+	if err := config.DB.Select(&warehouses, query); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch warehouses"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "Warehouses fetched successfully",
+		"warehouses": warehouses,
+	})
+}
+
+// ViewProductStock returns a product's stock at each warehouse along with
+// the total customers see.
+func ViewProductStock(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var total int
+	if err := config.DB.QueryRow(`SELECT stock FROM products WHERE id = $1`, productID).Scan(&total); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found"})
+	}
+
+	levels := []models.WarehouseStock{}
+	query := `
+		SELECT w.id AS warehouse_id, w.name AS warehouse_name, COALESCE(s.quantity, 0) AS quantity
+		FROM warehouses w
+		LEFT JOIN warehouse_stock s ON s.warehouse_id = w.id AND s.product_id = $1
+		WHERE w.active OR s.quantity <> 0
+		ORDER BY w.is_default DESC, w.name`
+	if err := config.DB.Select(&levels, query, productID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch stock levels"})
+	}
+
+	return c.JSON(fiber.Map{
+		"product_id": productID,
+		"total":      total,
+		"warehouses": levels,
+	})
+}
+
+// ViewStockAdjustments lists stock movements, newest first, optionally
+// narrowed to one product or warehouse.
+func ViewStockAdjustments(c *fiber.Ctx) error {
+	var conditions []string
+	var args []interface{}
+	for _, filter := range []string{"product_id", "warehouse_id"} {
+		if value := c.QueryInt(filter); value > 0 {
+			args = append(args, value)
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", filter, len(args)))
+		}
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	adjustments := []models.StockAdjustment{}
+	query := `
+		SELECT id, product_id, warehouse_id, delta, reason, COALESCE(note, '') AS note, created_at
+		FROM stock_adjustments
+		` + where + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT 500`
+	if err := config.DB.Select(&adjustments, query, args...); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch stock adjustments"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":     "Stock adjustments fetched successfully",
+		"adjustments": adjustments,
+	})
+}
+
+// CreateStockTransfer ships stock from one warehouse to another. The stock
+// leaves the source straight away and is not sellable until the transfer is
+// received at the destination.
+func CreateStockTransfer(c *fiber.Ctx) error {
+	transfer := new(models.StockTransfer)
+	if err := c.BodyParser(transfer); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if transfer.Quantity <= 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Quantity must be positive"})
+	}
+	if transfer.FromWarehouseID == transfer.ToWarehouseID {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Source and destination must differ"})
+	}
+
+	var activeCount int
+	checkQuery := `SELECT COUNT(*) FROM warehouses WHERE id IN ($1, $2) AND active`
+	if err := config.DB.QueryRow(checkQuery, transfer.FromWarehouseID, transfer.ToWarehouseID).Scan(&activeCount); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check warehouses"})
+	}
+	if activeCount != 2 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Warehouse not found or inactive"})
+	}
+
+	tx, err := config.DB.Beginx()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create transfer"})
+	}
+	defer tx.Rollback()
+
+	insertQuery := `
+		INSERT INTO stock_transfers (product_id, from_warehouse_id, to_warehouse_id, quantity, note)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+		RETURNING id, status, created_at`
+	err = tx.QueryRow(insertQuery, transfer.ProductID, transfer.FromWarehouseID, transfer.ToWarehouseID, transfer.Quantity, transfer.Note).
+		Scan(&transfer.ID, &transfer.Status, &transfer.CreatedAt)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create transfer"})
+	}
+
+	note := fmt.Sprintf("Transfer %d", transfer.ID)
+	err = models.AdjustStock(tx, transfer.ProductID, transfer.FromWarehouseID, -transfer.Quantity, models.StockReasonTransferOut, note)
+	if err == models.ErrInsufficientWarehouseStock {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create transfer"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create transfer"})
+	}
+	go utils.StockChanged(transfer.ProductID)
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Transfer created successfully", "transfer": transfer})
+}
+
+func ReceiveStockTransfer(c *fiber.Ctx) error {
+	return closeStockTransfer(c, "Completed")
+}
+
+func CancelStockTransfer(c *fiber.Ctx) error {
+	return closeStockTransfer(c, "Cancelled")
+}
+
+// closeStockTransfer settles an in-transit transfer: completing it books the
+// stock into the destination, cancelling it puts it back at the source.
+func closeStockTransfer(c *fiber.Ctx, status string) error {
+	transferID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid transfer ID"})
+	}
+
+	tx, err := config.DB.Beginx()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update transfer"})
+	}
+	defer tx.Rollback()
+
+	var transfer models.StockTransfer
+	query := `
+		UPDATE stock_transfers SET status = $1, completed_at = NOW()
+		WHERE id = $2 AND status = 'In Transit'
+		RETURNING id, product_id, from_warehouse_id, to_warehouse_id, quantity, status, COALESCE(note, '') AS note, created_at, completed_at`
+	if err := tx.Get(&transfer, query, status, transferID); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No in-transit transfer found"})
+	}
+
+	warehouseID, reason := transfer.ToWarehouseID, models.StockReasonTransferIn
+	if status == "Cancelled" {
+		warehouseID = transfer.FromWarehouseID
+	}
+	note := fmt.Sprintf("Transfer %d %s", transfer.ID, strings.ToLower(status))
+	if err := models.AdjustStock(tx, transfer.ProductID, warehouseID, transfer.Quantity, reason, note); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update transfer"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update transfer"})
+	}
+	go utils.StockChanged(transfer.ProductID)
+
+	return c.JSON(fiber.Map{"message": "Transfer " + strings.ToLower(status), "transfer": transfer})
+}
+
+func ViewStockTransfers(c *fiber.Ctx) error {
+	status := c.Query("status")
+
+	transfers := []models.StockTransfer{}
+	query := `
+		SELECT id, product_id, from_warehouse_id, to_warehouse_id, quantity, status, COALESCE(note, '') AS note, created_at, completed_at
+		FROM stock_transfers
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC`
+	if err := config.DB.Select(&transfers, query, status); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch transfers"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":   "Transfers fetched successfully",
+		"transfers": transfers,
+	})
+}
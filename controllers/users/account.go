@@ -0,0 +1,246 @@
+package users
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"horizon/config"
+	queries "horizon/sql"
+	"horizon/utils"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const accountDeletionGracePeriod = 14 * 24 * time.Hour
+
+type exportProfile struct {
+	Name          string    `json:"name" db:"name"`
+	Email         string    `json:"email" db:"email"`
+	Phone         string    `json:"phone" db:"phone"`
+	WalletBalance float64   `json:"wallet_balance" db:"wallet_balance"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+type exportAddress struct {
+	AddressLine string `json:"address_line" db:"address_line"`
+	City        string `json:"city" db:"city"`
+	ZipCode     string `json:"zip_code" db:"zip_code"`
+}
+
+type exportOrderItem struct {
+	OrderID     int     `json:"-" db:"order_id"`
+	ProductName string  `json:"product_name" db:"product_name"`
+	Quantity    int     `json:"quantity" db:"quantity"`
+	Price       float64 `json:"price" db:"price"`
+	Subtotal    float64 `json:"subtotal" db:"subtotal"`
+}
+
+type exportOrder struct {
+	ID                int               `json:"-" db:"id"`
+	ReferenceID       string            `json:"reference_id" db:"order_id"`
+	OrderDate         time.Time         `json:"order_date" db:"order_date"`
+	Status            string            `json:"status" db:"status"`
+	PaymentMethod     string            `json:"payment_method" db:"payment_method"`
+	PaymentStatus     string            `json:"payment_status" db:"payment_status"`
+	TotalAmount       float64           `json:"total_amount" db:"total_amount"`
+	CouponDiscount    float64           `json:"coupon_discount" db:"coupon_discount"`
+	OfferDiscount     float64           `json:"offer_discount" db:"offer_discount"`
+	PromotionDiscount float64           `json:"promotion_discount" db:"promotion_discount"`
+	LoyaltyDiscount   float64           `json:"loyalty_discount" db:"loyalty_discount"`
+	AddressLine       string            `json:"address_line" db:"address_line"`
+	City              string            `json:"city" db:"city"`
+	ZipCode           string            `json:"zip_code" db:"zip_code"`
+	Items             []exportOrderItem `json:"items"`
+}
+
+type exportWalletTransaction struct {
+	OrderID         int       `json:"order_id" db:"order_id"`
+	Amount          float64   `json:"amount" db:"amount"`
+	TransactionType string    `json:"transaction_type" db:"transaction_type"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+type exportWishlistItem struct {
+	ProductName string    `json:"product_name" db:"product_name"`
+	AddedAt     time.Time `json:"added_at" db:"created_at"`
+}
+
+func ExportUserData(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var profile exportProfile
+	profileQuery := `SELECT name, email, COALESCE(phone, '') AS phone, wallet_balance, created_at FROM users WHERE id = $1`
+	if err := config.DB.Get(&profile, profileQuery, userID); err != nil {
+		log.Printf("Failed to export profile: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to export profile"})
+	}
+
+	var addresses []exportAddress
+	if err := config.DB.Select(&addresses, `SELECT address_line, city, zip_code FROM addresses WHERE user_id = $1`, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to export addresses"})
+	}
+
+	var orders []exportOrder
+	ordersQuery := `
+		SELECT id, order_id, order_date, status, payment_method, payment_status, total_amount,
+		       coupon_discount, offer_discount, promotion_discount, loyalty_discount,
+		       COALESCE(address_line, '') AS address_line, COALESCE(city, '') AS city, COALESCE(zip_code, '') AS zip_code
+		FROM orders
+		WHERE user_id = $1
+		ORDER BY order_date
+	`
+	if err := config.DB.Select(&orders, ordersQuery, userID); err != nil {
+		log.Printf("Failed to export orders: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to export orders"})
+	}
+
+	var items []exportOrderItem
+	itemsQuery := `
+		SELECT oi.order_id, p.name AS product_name, oi.quantity, oi.price, oi.subtotal
+		FROM order_items oi
+		JOIN orders o ON oi.order_id = o.id
+		JOIN products p ON oi.product_id = p.id
+		WHERE o.user_id = $1
+	`
+	if err := config.DB.Select(&items, itemsQuery, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to export order items"})
+	}
+	for i := range orders {
+		for _, item := range items {
+			if item.OrderID == orders[i].ID {
+				orders[i].Items = append(orders[i].Items, item)
+			}
+		}
+	}
+
+	var transactions []exportWalletTransaction
+	transactionsQuery := `SELECT order_id, amount, transaction_type, created_at FROM wallet_transactions WHERE user_id = $1 ORDER BY created_at`
+	if err := config.DB.Select(&transactions, transactionsQuery, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to export wallet transactions"})
+	}
+
+	var wishlist []exportWishlistItem
+	wishlistQuery := `SELECT p.name AS product_name, w.created_at FROM wishlists w JOIN products p ON w.product_id = p.id WHERE w.user_id = $1`
+	if err := config.DB.Select(&wishlist, wishlistQuery, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to export wishlist"})
+	}
+
+	files := []struct {
+		Name string
+		Data interface{}
+	}{
+		{"profile.json", profile},
+		{"addresses.json", addresses},
+		{"orders.json", orders},
+		{"wallet_transactions.json", transactions},
+		{"wishlist.json", wishlist},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.Create(file.Name)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build export"})
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.Data); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build export"})
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build export"})
+	}
+
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="horizon-data-%s.zip"`, time.Now().Format("2006-01-02")))
+	return c.Send(buf.Bytes())
+}
+
+func RequestAccountDeletion(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var req struct {
+		Password string `json:"password"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	var password sql.NullString
+	if err := config.DB.QueryRow(`SELECT password FROM users WHERE id = $1`, userID).Scan(&password); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+	if password.Valid && password.String != "" {
+		if err := utils.CheckPassword(password.String, req.Password); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Incorrect password"})
+		}
+	}
+
+	var scheduledFor time.Time
+	query := `
+		INSERT INTO account_deletion_requests (user_id, reason, status, requested_at, scheduled_for)
+		VALUES ($1, $2, 'Pending', NOW(), NOW() + make_interval(secs => $3))
+		ON CONFLICT (user_id) DO UPDATE
+		SET reason = $2, status = 'Pending', requested_at = NOW(), scheduled_for = NOW() + make_interval(secs => $3), completed_at = NULL
+		WHERE account_deletion_requests.status <> 'Completed'
+		RETURNING scheduled_for
+	`
+	err := config.DB.QueryRow(query, userID, req.Reason, accountDeletionGracePeriod.Seconds()).Scan(&scheduledFor)
+	if err == sql.ErrNoRows {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Account has already been deleted"})
+	}
+	if err != nil {
+		log.Printf("Failed to create deletion request: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to request account deletion"})
+	}
+
+	// Tell the customer up front what deletion waits for and what it leaves
+	// behind.
+	var walletBalance float64
+	var ordersInFlight int
+	statusQuery := `
+		SELECT COALESCE(u.wallet_balance, 0),
+		       (SELECT COUNT(*) FROM orders o WHERE o.user_id = u.id AND ` + queries.OrderInFlightCondition + `)
+		FROM users u WHERE u.id = $1`
+	if err := config.DB.QueryRow(statusQuery, userID).Scan(&walletBalance, &ordersInFlight); err != nil {
+		log.Printf("Failed to check account before deletion: %v", err)
+	}
+
+	response := fiber.Map{
+		"message":       "Account deletion scheduled. You can cancel it before the scheduled date.",
+		"scheduled_for": scheduledFor,
+	}
+	if ordersInFlight > 0 {
+		response["orders_in_flight"] = ordersInFlight
+		response["orders_note"] = "Your account will be deleted once your open orders have been delivered or cancelled."
+	}
+	if walletBalance > 0 {
+		response["wallet_balance"] = walletBalance
+		response["wallet_note"] = "Your wallet balance will be refunded by our support team after deletion."
+	}
+	return c.JSON(response)
+}
+
+func CancelAccountDeletion(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	query := `UPDATE account_deletion_requests SET status = 'Cancelled' WHERE user_id = $1 AND status = 'Pending'`
+	result, err := config.DB.Exec(query, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to cancel account deletion"})
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No pending deletion request"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Account deletion cancelled"})
+}
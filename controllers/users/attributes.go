@@ -0,0 +1,125 @@
+package users
+
+import (
+	"fmt"
+	"horizon/config"
+	"horizon/models"
+	queries "horizon/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// attributeFilters turns attr.<code>=a,b and attr.<code>_min / _max query
+// parameters into conditions on products, numbering placeholders from
+// len(args)+1. Only filterable attributes may be used.
+func attributeFilters(c *fiber.Ctx, args []interface{}) (string, []interface{}, string) {
+	params := map[string]string{}
+	c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+		if k := string(key); strings.HasPrefix(k, "attr.") {
+			params[strings.TrimPrefix(k, "attr.")] = string(value)
+		}
+	})
+	if len(params) == 0 {
+		return "", args, ""
+	}
+
+	var filterable []string
+	if err := config.DB.Select(&filterable, `SELECT DISTINCT code FROM attribute_definitions WHERE filterable`); err != nil {
+		return "", args, "Failed to load attribute filters"
+	}
+	allowed := map[string]bool{}
+	for _, code := range filterable {
+		allowed[code] = true
+	}
+
+	var conditions strings.Builder
+	for key, value := range params {
+		code, bound := key, ""
+		if strings.HasSuffix(key, "_min") || strings.HasSuffix(key, "_max") {
+			if base := key[:len(key)-4]; allowed[base] {
+				code, bound = base, key[len(key)-3:]
+			}
+		}
+		if !allowed[code] {
+			return "", args, fmt.Sprintf("Cannot filter by attribute %q", code)
+		}
+
+		var condition string
+		if bound != "" {
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return "", args, fmt.Sprintf("attr.%s must be a number", key)
+			}
+			operator := ">="
+			if bound == "max" {
+				operator = "<="
+			}
+			args = append(args, code, number)
+			condition = fmt.Sprintf("v.value_number %s $%d", operator, len(args))
+		} else {
+			var values []string
+			for _, v := range strings.Split(value, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, strings.ToLower(v))
+				}
+			}
+			args = append(args, code, pq.Array(values))
+			condition = fmt.Sprintf("LOWER(v.value) = ANY($%d)", len(args))
+		}
+
+		fmt.Fprintf(&conditions, `
+			AND EXISTS (
+				SELECT 1 FROM product_attribute_values v
+				JOIN attribute_definitions a ON a.id = v.attribute_id
+				WHERE v.product_id = products.id AND a.code = $%d AND a.filterable AND %s
+			)`, len(args)-1, condition)
+	}
+	return conditions.String(), args, ""
+}
+
+// CategoryFilters lists the filterable attributes of a category with the
+// values products in its subtree currently use.
+func CategoryFilters(c *fiber.Ctx) error {
+	categoryID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category ID"})
+	}
+
+	var attributes []models.AttributeDefinition
+	if err := config.DB.Select(&attributes, queries.CategoryAttributesQuery, categoryID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch attributes"})
+	}
+
+	var subtree []int
+	if err := config.DB.Select(&subtree, queries.CategorySubtreeQuery, categoryID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch category"})
+	}
+
+	type filter struct {
+		models.AttributeDefinition
+		Values []string `json:"values"`
+	}
+	filters := []filter{}
+	for _, attribute := range attributes {
+		if !attribute.Filterable {
+			continue
+		}
+		values := []string{}
+		valuesQuery := `
+			SELECT DISTINCT v.value
+			FROM product_attribute_values v
+			JOIN products p ON p.id = v.product_id
+			WHERE v.attribute_id = $1 AND p.deleted = false AND p.category_id = ANY($2)
+			ORDER BY v.value`
+		if err := config.DB.Select(&values, valuesQuery, attribute.ID, pq.Array(subtree)); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch attribute values"})
+		}
+		filters = append(filters, filter{AttributeDefinition: attribute, Values: values})
+	}
+
+	return c.JSON(fiber.Map{"filters": filters})
+}
@@ -0,0 +1,46 @@
+package users
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func ViewBrands(c *fiber.Ctx) error {
+	brands := []models.Brand{}
+	query := `SELECT id, name, slug, COALESCE(description, '') AS description, COALESCE(logo_key, '') AS logo_key, deleted FROM brands WHERE deleted=false ORDER BY name`
+	if err := config.DB.Select(&brands, query); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch brands"})
+	}
+	for i := range brands {
+		brands[i].ResolveLogo()
+	}
+
+	return c.JSON(fiber.Map{"brands": brands})
+}
+
+func BrandProducts(c *fiber.Ctx) error {
+	brandID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid brand ID"})
+	}
+
+	var brand models.Brand
+	query := `SELECT id, name, slug, COALESCE(description, '') AS description, COALESCE(logo_key, '') AS logo_key, deleted FROM brands WHERE id=$1 AND deleted=false`
+	if err := config.DB.Get(&brand, query, brandID); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Brand not found"})
+	}
+	brand.ResolveLogo()
+
+	products, err := fetchProductViews(" AND p.brand_id = $1", brandID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch products"})
+	}
+
+	return c.JSON(fiber.Map{
+		"brand":    brand,
+		"products": nonNilProducts(products),
+	})
+}
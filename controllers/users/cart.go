@@ -4,6 +4,7 @@ import (
 	"horizon/config"
 	"horizon/models"
 	responsemodels "horizon/models/responsemodels"
+	"horizon/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -16,8 +17,6 @@ func AddToCart(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	const maxQtyPerPerson = 10
-
 	var availableStock int
 	query := `SELECT stock FROM products WHERE id=$1 AND deleted=false`
 	err := config.DB.QueryRow(query, cartItem.ProductID).Scan(&availableStock)
@@ -29,20 +28,8 @@ func AddToCart(c *fiber.Ctx) error {
 	cartQuery := `SELECT quantity FROM cart WHERE user_id=$1 AND product_id=$2`
 	_ = config.DB.QueryRow(cartQuery, userID, cartItem.ProductID).Scan(&currentCartQty)
 
-	if cartItem.Quantity+currentCartQty > maxQtyPerPerson {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":                       "Requested quantity exceeds the maximum allowed per person",
-			"Maximum Quantity per person": maxQtyPerPerson,
-			"In your Cart":                currentCartQty,
-		})
-	}
-
-	if cartItem.Quantity+currentCartQty > availableStock {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":   "Requested quantity exceeds available stock",
-			"stock":   availableStock,
-			"current": currentCartQty,
-		})
+	if conflict := cartQuantityConflict(cartItem.Quantity, currentCartQty, availableStock); conflict != nil {
+		return c.Status(fiber.StatusConflict).JSON(conflict)
 	}
 
 	query = `
@@ -58,6 +45,27 @@ func AddToCart(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Product added to cart successfully"})
 }
 
+// cartQuantityConflict applies the per person limit and the stock check to
+// adding quantity units to a cart already holding current of them, and
+// returns the error response when either is broken.
+func cartQuantityConflict(quantity, current, stock int) fiber.Map {
+	if quantity+current > models.MaxQtyPerPerson {
+		return fiber.Map{
+			"error":                       "Requested quantity exceeds the maximum allowed per person",
+			"Maximum Quantity per person": models.MaxQtyPerPerson,
+			"In your Cart":                current,
+		}
+	}
+	if quantity+current > stock {
+		return fiber.Map{
+			"error":   "Requested quantity exceeds available stock",
+			"stock":   stock,
+			"current": current,
+		}
+	}
+	return nil
+}
+
 func RemoveFromCart(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(int)
 	productID := c.Params("product_id")
@@ -81,9 +89,11 @@ func ViewCart(c *fiber.Ctx) error {
 
 	query := `
         SELECT p.id, p.name, p.price, c.quantity, 
-               (p.price * c.quantity) AS subtotal
+               (p.price * c.quantity) AS subtotal,
+               COALESCE(pi.thumbnail_key, '')
         FROM cart c
         JOIN products p ON c.product_id = p.id
+        LEFT JOIN product_images pi ON pi.product_id = p.id AND pi.is_primary
         WHERE c.user_id=$1`
 	rows, err := config.DB.Query(query, userID)
 	if err != nil {
@@ -93,13 +103,41 @@ func ViewCart(c *fiber.Ctx) error {
 
 	for rows.Next() {
 		var item responsemodels.ViewCartItem
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Quantity, &item.Subtotal); err != nil {
+		var thumbnailKey string
+		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Quantity, &item.Subtotal, &thumbnailKey); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse cart item"})
 		}
+		item.ThumbnailURL = utils.Storage().URL(thumbnailKey)
 		cart = append(cart, item)
 	}
 
-	return c.JSON(fiber.Map{"message": "Cart fetched successfully", "cart": cart})
+	pricing, err := models.PriceUserCart(config.DB, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to price cart"})
+	}
+	priced := map[int]models.PricedLine{}
+	for _, line := range pricing.Lines {
+		priced[line.ProductID] = line
+	}
+	for i := range cart {
+		line := priced[cart[i].ID]
+		cart[i].FlashSaleUnits = line.FlashSaleUnits
+		cart[i].OfferDiscount = line.OfferDiscount
+		cart[i].PromotionDiscount = line.PromotionDiscount
+		cart[i].Total = line.Total
+		cart[i].Promotions = line.Promotions
+	}
+
+	return c.JSON(fiber.Map{
+		"message":            "Cart fetched successfully",
+		"cart":               cart,
+		"subtotal":           pricing.Subtotal,
+		"offer_discount":     pricing.OfferDiscount,
+		"promotion_discount": pricing.PromotionDiscount,
+		"total":              pricing.Total,
+		"free_shipping":      pricing.FreeShipping,
+		"promotions":         pricing.Promotions,
+	})
 }
 func ClearCart(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(int)
@@ -0,0 +1,98 @@
+package users
+
+import (
+	"database/sql"
+	"horizon/config"
+	responsemodels "horizon/models/responsemodels"
+	queries "horizon/sql"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+func CategoryTree(c *fiber.Ctx) error {
+	query := `SELECT id, parent_id, name, COALESCE(description, ''), COALESCE(slug, ''), sort_order, COALESCE(image_url, '') FROM categories WHERE deleted=false ORDER BY sort_order, name`
+	rows, err := config.DB.Query(query)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch categories"})
+	}
+	defer rows.Close()
+
+	var nodes []*responsemodels.CategoryNode
+	byID := map[int]*responsemodels.CategoryNode{}
+	for rows.Next() {
+		node := &responsemodels.CategoryNode{Children: []*responsemodels.CategoryNode{}}
+		if err := rows.Scan(&node.ID, &node.ParentID, &node.Name, &node.Description, &node.Slug, &node.SortOrder, &node.ImageURL); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse categories"})
+		}
+		nodes = append(nodes, node)
+		byID[node.ID] = node
+	}
+
+	tree := []*responsemodels.CategoryNode{}
+	for _, node := range nodes {
+		if node.ParentID != nil {
+			if parent, ok := byID[*node.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		tree = append(tree, node)
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"categories": tree})
+}
+
+func ProductBreadcrumbs(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var categoryID int
+	var productName string
+	query := `SELECT category_id, name FROM products WHERE id=$1 AND deleted=false`
+	err = config.DB.QueryRow(query, productID).Scan(&categoryID, &productName)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found"})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch product"})
+	}
+
+	var breadcrumbs []responsemodels.Breadcrumb
+	if err := config.DB.Select(&breadcrumbs, queries.CategoryPathQuery, categoryID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch breadcrumbs"})
+	}
+
+	return c.JSON(fiber.Map{
+		"product":     productName,
+		"breadcrumbs": breadcrumbs,
+	})
+}
+
+func CategoryProducts(c *fiber.Ctx) error {
+	categoryID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category ID"})
+	}
+
+	var subtree []int
+	if err := config.DB.Select(&subtree, queries.CategorySubtreeQuery, categoryID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch category"})
+	}
+	if len(subtree) == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+	}
+
+	products, err := fetchProductViews(" AND c.deleted = false AND p.category_id = ANY($1)", pq.Array(subtree))
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch products"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "Products fetched successfully",
+		"products": products,
+	})
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
+	"log"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -19,10 +22,15 @@ func Checkout(c *fiber.Ctx) error {
 	addressID := c.Query("address_id")
 	couponCode := c.Query("coupon_code")
 	paymentMethod := c.Query("payment_method")
+	autoApplyCoupon := c.QueryBool("auto_apply_coupon")
+	redeemPoints := c.QueryInt("redeem_points")
 
 	if addressID == "" || paymentMethod == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Missing required parameters"})
 	}
+	if paymentMethod != "cod" && paymentMethod != "paypal" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payment method"})
+	}
 
 	var address struct {
 		AddressLine string
@@ -49,11 +57,15 @@ func Checkout(c *fiber.Ctx) error {
 		}
 	}()
 
+	// The cart's products stay locked, in id order so that concurrent
+	// checkouts cannot deadlock, until the order has taken their stock.
 	cartQuery := `
 		SELECT p.id, p.stock, c.quantity, p.price
 		FROM cart c
 		JOIN products p ON c.product_id = p.id
 		WHERE c.user_id = $1
+		ORDER BY p.id
+		FOR UPDATE OF p
 	`
 	rows, err := tx.Query(cartQuery, userID)
 	if err != nil {
@@ -97,64 +109,101 @@ func Checkout(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cart is empty"})
 	}
 
+	// Flash sale items stay locked until the order claims its units, so the
+	// cart is priced with units that cannot be sold to anyone else meanwhile.
+	if err := models.LockCartFlashSales(tx, userID); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check flash sales"})
+	}
+	pricing, err := models.PriceUserCart(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to price cart"})
+	}
+	offerDiscountFloat := pricing.OfferDiscount
+
+	// Without a code, auto_apply_coupon takes the coupon that saves the most.
+	// Coupons are not available on COD orders; a code given there is refused
+	// rather than dropped and still counted as used.
+	var coupon *models.Coupon
 	var couponDiscountFloat float64
-	if couponCode != "" && paymentMethod != "cod" {
-		var discountPercentage, maxDiscountAmount, minOrderAmount float64
-		var usedCount, usageLimit int
-		var startDate, endDate time.Time
-		couponQuery := `
-			SELECT discount_percentage, max_discount_amount, min_order_amount, used_count, usage_limit, start_date, end_date
-			FROM coupons
-			WHERE code = $1 AND CURRENT_TIMESTAMP BETWEEN start_date AND end_date
-		`
-
-		err := config.DB.QueryRow(couponQuery, couponCode).Scan(&discountPercentage, &maxDiscountAmount, &minOrderAmount, &usedCount, &usageLimit, &startDate, &endDate)
+	if couponCode == "" && autoApplyCoupon && paymentMethod != "cod" {
+		customer, err := models.LoadPricingCustomer(tx, userID)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired coupon"})
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check coupons"})
 		}
-
-		if usedCount >= usageLimit {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Coupon usage limit reached"})
+		ranked, err := models.RankCoupons(tx, userID, pricing, customer)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check coupons"})
 		}
-
-		if orderTotal < minOrderAmount {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Order total does not meet the minimum amount required for this coupon"})
+		if len(ranked) > 0 && ranked[0].Eligible && ranked[0].Savings > 0 {
+			coupon = &ranked[0].Coupon
+			couponCode = coupon.Code
+			couponDiscountFloat = ranked[0].Savings
 		}
-
-		discount := (orderTotal * discountPercentage) / 100
-		if discount > maxDiscountAmount {
-			discount = maxDiscountAmount
+	} else if couponCode != "" {
+		if paymentMethod == "cod" {
+			tx.Rollback()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Coupons cannot be used on COD orders"})
 		}
-		couponDiscountFloat = discount
-		orderTotal -= couponDiscountFloat
-	}
-
-	var offerDiscountFloat float64
 
-	for _, item := range cartItems {
-		var discountPercentage float64
-
-		offerQuery := `
-    SELECT discount_percentage
-    FROM offers
-    WHERE product_id = $1 AND CURRENT_TIMESTAMP BETWEEN start_date AND end_date
-	`
-		err := config.DB.QueryRow(offerQuery, item.ProductID).Scan(&discountPercentage)
-		if err == nil {
-			offerDiscountFloat += (float64(item.Quantity) * item.Price * discountPercentage) / 100
+		liveCoupon, err := models.LoadLiveCoupon(tx, couponCode)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired coupon"})
 		}
-		if err != nil && err.Error() != "no rows in result set" {
-			fmt.Println(err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch offer data"})
+		customer, err := models.LoadPricingCustomer(tx, userID)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check coupon"})
 		}
+		discount, reason, err := models.EvaluateCoupon(tx, liveCoupon, userID, pricing, customer)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check coupon"})
+		}
+		if reason != "" {
+			tx.Rollback()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": reason})
+		}
+		coupon = &liveCoupon
+		couponDiscountFloat = discount
 	}
-
-	orderTotal -= offerDiscountFloat
+	orderTotal = pricing.Total - couponDiscountFloat
 
 	if orderTotal < 0 {
 		orderTotal = 0
 	}
 
+	// Points pay for at most the configured share of what is left after the
+	// coupon; asking for more redeems only what the cap allows.
+	var pointsRedeemed int
+	var loyaltyDiscount float64
+	if redeemPoints > 0 {
+		settings, err := models.LoadLoyaltySettings(tx)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check loyalty points"})
+		}
+		balance, err := models.LoyaltyBalance(tx, userID)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check loyalty points"})
+		}
+		if redeemPoints > balance {
+			tx.Rollback()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Not enough loyalty points", "balance": balance})
+		}
+		pointsRedeemed, loyaltyDiscount = settings.Redemption(redeemPoints, orderTotal)
+		if pointsRedeemed == 0 {
+			tx.Rollback()
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Loyalty points cannot be redeemed on this order"})
+		}
+		orderTotal -= loyaltyDiscount
+	}
+
 	var paymentStatus, status string
 	if paymentMethod == "cod" {
 		if orderTotal > 1000 {
@@ -172,28 +221,47 @@ func Checkout(c *fiber.Ctx) error {
 	var orderID int
 	createOrderQuery := `
 	INSERT INTO orders 
-	(order_id, user_id, total_amount, coupon_discount, offer_discount, payment_method, payment_status, status, address_line, city, zip_code) 
+	(order_id, user_id, total_amount, coupon_discount, offer_discount, promotion_discount, loyalty_points_redeemed, loyalty_discount, payment_method, payment_status, status, address_line, city, zip_code) 
 	VALUES 
-	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) 
+	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) 
 	RETURNING id
 `
-	err = tx.QueryRow(createOrderQuery, uniqueOrderID, userID, orderTotal, couponDiscountFloat, offerDiscountFloat, paymentMethod, paymentStatus, status, address.AddressLine, address.City, address.ZipCode).Scan(&orderID)
+	err = tx.QueryRow(createOrderQuery, uniqueOrderID, userID, orderTotal, couponDiscountFloat, offerDiscountFloat, pricing.PromotionDiscount, pointsRedeemed, loyaltyDiscount, paymentMethod, paymentStatus, status, address.AddressLine, address.City, address.ZipCode).Scan(&orderID)
 	if err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create order"})
 	}
+	if err := models.RecordOrderPromotions(tx, orderID, pricing.Promotions); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record order promotions"})
+	}
+	if err := models.ClaimFlashSaleUnits(tx, userID, orderID, pricing.Lines); err != nil {
+		tx.Rollback()
+		if err == models.ErrFlashSaleUnavailable || err == models.ErrFlashSaleCustomerLimit {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Flash sale units are no longer available, please review your cart"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to claim flash sale units"})
+	}
 
+	var orderedProductIDs []int
 	for _, item := range cartItems {
+		orderedProductIDs = append(orderedProductIDs, item.ProductID)
 		subtotal := item.Price * float64(item.Quantity)
-		_, err := tx.Exec(`
+		var orderItemID int
+		err := tx.QueryRow(`
 		INSERT INTO order_items (order_id, product_id, quantity, price, subtotal)
-		VALUES ($1, $2, $3, $4, $5)`,
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
 			orderID, item.ProductID, item.Quantity, item.Price, subtotal,
-		)
+		).Scan(&orderItemID)
 		if err != nil {
 			tx.Rollback()
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add order items"})
 		}
+		if err := models.AllocateOrderLine(tx, orderID, orderItemID, item.ProductID, item.Quantity, address.ZipCode); err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to allocate order items"})
+		}
 	}
 
 	_, err = tx.Exec(`DELETE FROM cart WHERE user_id = $1`, userID)
@@ -201,23 +269,41 @@ func Checkout(c *fiber.Ctx) error {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to clear cart"})
 	}
+	if paymentMethod == "cod" {
+		if err := models.MarkCartRecovered(tx, userID, orderID, orderTotal); err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record cart recovery"})
+		}
+	}
 
-	if couponCode != "" {
-		updateCouponQuery := `
-		UPDATE coupons
-		SET used_count = used_count + 1
-		WHERE code = $1
-	`
-		_, err = tx.Exec(updateCouponQuery, couponCode)
+	if coupon != nil {
+		err := models.RedeemCoupon(tx, *coupon, userID, orderID, couponDiscountFloat)
+		if err == models.ErrCouponUsedUp || err == models.ErrCouponUserLimit {
+			tx.Rollback()
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Coupon is no longer available"})
+		}
 		if err != nil {
 			tx.Rollback()
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update coupon usage"})
 		}
 	}
 
+	if pointsRedeemed > 0 {
+		err := models.RedeemPoints(tx, userID, orderID, pointsRedeemed)
+		if err == models.ErrInsufficientPoints {
+			tx.Rollback()
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Not enough loyalty points"})
+		}
+		if err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to redeem loyalty points"})
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to finalize transaction"})
 	}
+	go utils.StockChanged(orderedProductIDs...)
 
 	if paymentMethod == "paypal" {
 		paypalClient := config.GetPayPalClient()
@@ -241,13 +327,24 @@ func Checkout(c *fiber.Ctx) error {
 				CancelURL: "https://horizonweb.me/paypal/cancel",
 			},
 		)
-		if err != nil {
+		// The order has already taken its items, so it is cancelled again
+		// when the buyer cannot be sent to PayPal to pay for it.
+		if err != nil || len(order.Links) <= 1 {
+			if err := cancelUnpaidOrder(orderID); err != nil {
+				log.Printf("Failed to cancel order ID %d: %v\n", orderID, err)
+			}
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create PayPal order"})
 		}
-		if len(order.Links) > 1 {
-			return c.JSON(fiber.Map{"url": order.Links[1].Href})
-		}
+		return c.JSON(fiber.Map{"url": order.Links[1].Href})
 	}
 
-	return c.JSON(fiber.Map{"message": "Order placed successfully", "order_id": uniqueOrderID, "total_amount": orderTotal})
+	return c.JSON(fiber.Map{
+		"message":                 "Order placed successfully",
+		"order_id":                uniqueOrderID,
+		"total_amount":            orderTotal,
+		"coupon_code":             couponCode,
+		"coupon_discount":         couponDiscountFloat,
+		"loyalty_points_redeemed": pointsRedeemed,
+		"loyalty_discount":        loyaltyDiscount,
+	})
 }
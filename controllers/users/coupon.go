@@ -3,76 +3,96 @@ package users
 import (
 	"horizon/config"
 	"horizon/models"
-	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// ApplyCoupon previews a coupon against the customer's cart, with the same
+// checks Checkout makes.
 func ApplyCoupon(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
 	couponCode := c.Query("code")
-	orderAmount := c.Query("order_amount")
-	if couponCode == "" || orderAmount == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Coupon code and order amount are required"})
+	if couponCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Coupon code is required"})
 	}
 
-	var coupon models.Coupon
-	query := `
-        SELECT id, discount_percentage, max_discount_amount, min_order_amount, usage_limit, used_count, end_date 
-        FROM coupons 
-        WHERE code = $1 AND end_date >= NOW()
-    `
-	err := config.DB.QueryRow(query, couponCode).Scan(&coupon.ID, &coupon.DiscountPercentage, &coupon.MaxDiscountAmount, &coupon.MinOrderAmount, &coupon.UsageLimit, &coupon.UsedCount, &coupon.EndDate)
+	coupon, err := models.LoadLiveCoupon(config.DB, couponCode)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invalid or expired coupon"})
 	}
 
-	orderAmountFloat, err := strconv.ParseFloat(orderAmount, 64)
+	pricing, err := models.PriceUserCart(config.DB, userID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid order amount"})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to price cart"})
 	}
-
-	if orderAmountFloat < coupon.MinOrderAmount {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Order amount does not meet the minimum requirement for this coupon"})
+	if len(pricing.Lines) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cart is empty"})
 	}
-
-	if coupon.UsedCount >= coupon.UsageLimit {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Coupon usage limit reached"})
+	customer, err := models.LoadPricingCustomer(config.DB, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check coupon"})
 	}
 
-	discount := (coupon.DiscountPercentage / 100) * orderAmountFloat
-	if discount > coupon.MaxDiscountAmount {
-		discount = coupon.MaxDiscountAmount
+	discount, reason, err := models.EvaluateCoupon(config.DB, coupon, userID, pricing, customer)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check coupon"})
+	}
+	if reason != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": reason})
 	}
 
+	finalPrice := pricing.Total - discount
+	if finalPrice < 0 {
+		finalPrice = 0
+	}
 	return c.JSON(fiber.Map{
 		"message":    "Coupon applied successfully",
 		"discount":   discount,
-		"finalPrice": orderAmountFloat - discount,
+		"finalPrice": finalPrice,
 	})
 }
+
+// ViewCoupons lists the running and upcoming coupons open to the customer.
+// Coupons meant for other customers and single-use batch codes are left out.
 func ViewCoupons(c *fiber.Ctx) error {
-	query := `
-        SELECT id, code, discount_percentage, max_discount_amount, min_order_amount, start_date, end_date, usage_limit, used_count, created_at, updated_at
-        FROM coupons
-        WHERE end_date >= NOW()
-    `
-	rows, err := config.DB.Query(query)
+	userID := c.Locals("userID").(int)
+	coupons, err := models.LoadCouponsOpenTo(config.DB, userID, false)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch coupons"})
 	}
-	defer rows.Close()
-
-	var coupons []models.Coupon
-	for rows.Next() {
-		var coupon models.Coupon
-		if err := rows.Scan(&coupon.ID, &coupon.Code, &coupon.DiscountPercentage, &coupon.MaxDiscountAmount, &coupon.MinOrderAmount, &coupon.StartDate, &coupon.EndDate, &coupon.UsageLimit, &coupon.UsedCount, &coupon.CreatedAt, &coupon.UpdatedAt); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse coupons"})
-		}
-		coupons = append(coupons, coupon)
-	}
 
 	return c.JSON(fiber.Map{
 		"message": "Coupons fetched successfully",
 		"coupons": coupons,
 	})
 }
+
+// EligibleCoupons checks every running coupon against the customer's cart
+// and ranks the usable ones by how much they save. The others come last with
+// the reason they cannot be used.
+func EligibleCoupons(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	pricing, err := models.PriceUserCart(config.DB, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to price cart"})
+	}
+	if len(pricing.Lines) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cart is empty"})
+	}
+	customer, err := models.LoadPricingCustomer(config.DB, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check coupons"})
+	}
+
+	coupons, err := models.RankCoupons(config.DB, userID, pricing, customer)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check coupons"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "Coupons checked successfully",
+		"cart_total": pricing.Total,
+		"coupons":    coupons,
+	})
+}
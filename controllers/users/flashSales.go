@@ -0,0 +1,44 @@
+package users
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ViewFlashSales lists the flash sales running now and those still to come,
+// with the units left on each item. server_time and the per-sale countdowns
+// let clients run a timer without trusting their own clock.
+func ViewFlashSales(c *fiber.Ctx) error {
+	sales := []models.FlashSale{}
+	query := `
+		SELECT id, name, start_time, end_time, active
+		FROM flash_sales
+		WHERE active AND end_time > NOW()
+		ORDER BY start_time, id`
+	if err := config.DB.Select(&sales, query); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch flash sales"})
+	}
+	if err := models.AttachFlashSaleItems(sales); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch flash sale items"})
+	}
+
+	live, upcoming := []models.FlashSale{}, []models.FlashSale{}
+	for _, sale := range sales {
+		switch sale.Status {
+		case models.FlashSaleLive:
+			live = append(live, sale)
+		case models.FlashSaleUpcoming:
+			upcoming = append(upcoming, sale)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"server_time": time.Now(),
+		"live":        live,
+		"upcoming":    upcoming,
+	})
+}
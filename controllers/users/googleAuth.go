@@ -1,18 +1,78 @@
 package users
 
 import (
+	"crypto/subtle"
+	"database/sql"
 	"encoding/json"
-	"fmt"
 	"horizon/config"
+	middleware "horizon/middlewares"
 	"horizon/models"
+	"horizon/utils"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/oauth2"
 )
 
+const (
+	googleProvider    = "google"
+	googleStateCookie = "google_oauth_state"
+	// googleSignupCookie carries the referral code and device id given to
+	// GoogleLogin through the redirect, for accounts created on callback.
+	googleSignupCookie = "google_signup"
+	googleStateTTL     = 10 * time.Minute
+	googleLinkTTL      = 15 * time.Minute
+)
+
+type googleSignupClaims struct {
+	ReferralCode string `json:"referral_code"`
+	DeviceID     string `json:"device_id"`
+}
+
+type googleLinkClaims struct {
+	UserID         int    `json:"user_id"`
+	ProviderUserID string `json:"provider_user_id"`
+	Email          string `json:"email"`
+}
+
 func GoogleLogin(c *fiber.Ctx) error {
-	url := config.GoogleOAuthConfig.AuthCodeURL("random_state_token", oauth2.AccessTypeOffline)
+	state, err := utils.RandomToken(16)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString("Failed to start Google login")
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	c.Cookie(&fiber.Cookie{
+		Name:     googleStateCookie,
+		Value:    utils.SignValue(state+":"+verifier, googleStateTTL),
+		Path:     "/auth/google",
+		Expires:  time.Now().Add(googleStateTTL),
+		HTTPOnly: true,
+		Secure:   strings.HasPrefix(config.AppBaseURL(), "https://"),
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	if ref := strings.TrimSpace(c.Query("ref")); ref != "" {
+		if _, err := models.FindReferrer(config.DB, ref); err != nil {
+			return c.Status(http.StatusBadRequest).SendString("Invalid referral code")
+		}
+	}
+	signup, _ := json.Marshal(googleSignupClaims{ReferralCode: strings.TrimSpace(c.Query("ref")), DeviceID: c.Query("device_id")})
+	c.Cookie(&fiber.Cookie{
+		Name:     googleSignupCookie,
+		Value:    utils.SignValue(string(signup), googleStateTTL),
+		Path:     "/auth/google",
+		Expires:  time.Now().Add(googleStateTTL),
+		HTTPOnly: true,
+		Secure:   strings.HasPrefix(config.AppBaseURL(), "https://"),
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	url := config.GoogleOAuthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
 	return c.Redirect(url)
 }
 
@@ -22,7 +82,22 @@ func GoogleCallback(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).SendString("No code in the callback URL")
 	}
 
-	token, err := config.GoogleOAuthConfig.Exchange(c.Context(), code)
+	stored, err := utils.VerifySignedValue(c.Cookies(googleStateCookie))
+	c.ClearCookie(googleStateCookie)
+	var signup googleSignupClaims
+	if value, err := utils.VerifySignedValue(c.Cookies(googleSignupCookie)); err == nil {
+		json.Unmarshal([]byte(value), &signup)
+	}
+	c.ClearCookie(googleSignupCookie)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Login session expired, please try again")
+	}
+	state, verifier, found := strings.Cut(stored, ":")
+	if !found || subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		return c.Status(http.StatusBadRequest).SendString("Invalid OAuth state")
+	}
+
+	token, err := config.GoogleOAuthConfig.Exchange(c.Context(), code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).SendString("Failed to exchange token")
 	}
@@ -35,33 +110,140 @@ func GoogleCallback(c *fiber.Ctx) error {
 	defer resp.Body.Close()
 
 	var userInfo struct {
-		Email string `json:"email"`
-		Name  string `json:"name"`
-		ID    string `json:"id"`
+		Email         string `json:"email"`
+		VerifiedEmail bool   `json:"verified_email"`
+		Name          string `json:"name"`
+		ID            string `json:"id"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
 		return c.Status(http.StatusInternalServerError).SendString("Failed to decode user info")
 	}
+	if !userInfo.VerifiedEmail {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Google account email is not verified"})
+	}
+
+	identity := models.UserIdentity{}
+	err = identity.FindByProvider(googleProvider, userInfo.ID)
+	if err == nil {
+		recordDevice(identity.UserID, signup.DeviceID)
+		return issueSocialLoginToken(c, identity.UserID)
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Failed to look up identity: %v", err)
+		return c.Status(http.StatusInternalServerError).SendString("Failed to look up account")
+	}
 
-	user := models.UserDet{}
-	if err := user.FindByEmail(userInfo.Email); err != nil {
-		user.Name = userInfo.Name
-		user.Email = userInfo.Email
-		user.Verified = true
+	var existingID int
+	var password sql.NullString
+	err = config.DB.QueryRow(`SELECT id, password FROM users WHERE email = $1`, userInfo.Email).Scan(&existingID, &password)
+	switch {
+	case err == sql.ErrNoRows:
+		user := models.UserDet{Name: userInfo.Name, Email: userInfo.Email, Verified: true}
 		if err := user.Create(); err != nil {
-			fmt.Println("errr", err)
+			log.Printf("Failed to create user: %v", err)
 			return c.Status(http.StatusInternalServerError).SendString("Failed to create user")
 		}
-	} else {
-
-		user.Verified = true
+		existingID = user.ID
+		applyReferral(existingID, signup.ReferralCode, signup.DeviceID)
+	case err != nil:
+		return c.Status(http.StatusInternalServerError).SendString("Failed to look up account")
+	case password.Valid && password.String != "":
+		// A password account owns this email. Linking needs proof of that
+		// password, so hand back a short-lived token for LinkGoogleAccount.
+		claims, _ := json.Marshal(googleLinkClaims{UserID: existingID, ProviderUserID: userInfo.ID, Email: userInfo.Email})
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"error":      "An account with this email already exists. Confirm your password to link Google.",
+			"link_token": utils.SignValue(string(claims), googleLinkTTL),
+		})
+	default:
+		// Accounts created by Google login before identities were tracked
+		// have no password and are linked automatically.
+		user := models.UserDet{Email: userInfo.Email, Verified: true}
 		if err := user.Update(); err != nil {
 			return c.Status(http.StatusInternalServerError).SendString("Failed to update user")
 		}
 	}
 
-	return c.JSON(fiber.Map{
-		"message": "Login successful, Welcome to Horizon!",
-	})
+	identity = models.UserIdentity{UserID: existingID, Provider: googleProvider, ProviderUserID: userInfo.ID, Email: userInfo.Email}
+	if err := identity.Create(); err != nil {
+		log.Printf("Failed to link identity: %v", err)
+		return c.Status(http.StatusInternalServerError).SendString("Failed to link Google account")
+	}
+	recordDevice(existingID, signup.DeviceID)
+
+	return issueSocialLoginToken(c, existingID)
+}
+
+// GoogleLinkAccountKey is the login throttle key for LinkGoogleAccount: the
+// id of the account the link token is for, so that password guesses against
+// one account are counted together.
+func GoogleLinkAccountKey(c *fiber.Ctx) string {
+	var req struct {
+		LinkToken string `json:"link_token"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return ""
+	}
+	value, err := utils.VerifySignedValue(req.LinkToken)
+	if err != nil {
+		return ""
+	}
+	var claims googleLinkClaims
+	if err := json.Unmarshal([]byte(value), &claims); err != nil || claims.UserID == 0 {
+		return ""
+	}
+	return strconv.Itoa(claims.UserID)
+}
+
+func LinkGoogleAccount(c *fiber.Ctx) error {
+	var req struct {
+		LinkToken string `json:"link_token"`
+		Password  string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	value, err := utils.VerifySignedValue(req.LinkToken)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired link token"})
+	}
+	var claims googleLinkClaims
+	if err := json.Unmarshal([]byte(value), &claims); err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired link token"})
+	}
+
+	var hashedPassword string
+	if err := config.DB.QueryRow(`SELECT password FROM users WHERE id = $1`, claims.UserID).Scan(&hashedPassword); err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid email or password"})
+	}
+	if err := utils.CheckPassword(hashedPassword, req.Password); err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid email or password"})
+	}
+
+	identity := models.UserIdentity{UserID: claims.UserID, Provider: googleProvider, ProviderUserID: claims.ProviderUserID, Email: claims.Email}
+	if err := identity.Create(); err != nil {
+		log.Printf("Failed to link identity: %v", err)
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Google account is already linked"})
+	}
+
+	return issueSocialLoginToken(c, claims.UserID)
+}
+
+func issueSocialLoginToken(c *fiber.Ctx, userID int) error {
+	var blocked bool
+	if err := config.DB.QueryRow(`SELECT blocked FROM users WHERE id = $1`, userID).Scan(&blocked); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
+	if blocked {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Your account is blocked. Contact support for assistance."})
+	}
+
+	token, err := middleware.GenerateToken(userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+
+	return c.JSON(loginResponse(c, userID, fiber.Map{"message": "Login successful, Welcome to Horizon!", "token": token}))
 }
@@ -0,0 +1,221 @@
+package users
+
+import (
+	"horizon/config"
+	"horizon/models"
+	responsemodels "horizon/models/responsemodels"
+	"horizon/utils"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// guestCartCookie holds the signed id of a visitor's cart until they log
+	// in. Apps that do not keep cookies send the same token in
+	// guestCartHeader instead.
+	guestCartCookie = "guest_cart"
+	guestCartHeader = "X-Guest-Cart"
+	guestCartTTL    = 30 * 24 * time.Hour
+)
+
+// guestCartID returns the id in the request's guest cart token, or "" when
+// there is no valid one.
+func guestCartID(c *fiber.Ctx) string {
+	token := c.Get(guestCartHeader)
+	if token == "" {
+		token = c.Cookies(guestCartCookie)
+	}
+	if token == "" {
+		return ""
+	}
+	id, err := utils.VerifySignedValue(token)
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+// setGuestCartToken signs a guest cart id into the cookie and returns the
+// token for clients that send it as a header.
+func setGuestCartToken(c *fiber.Ctx, id string) string {
+	token := utils.SignValue(id, guestCartTTL)
+	c.Cookie(&fiber.Cookie{
+		Name:     guestCartCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(guestCartTTL),
+		HTTPOnly: true,
+		Secure:   strings.HasPrefix(config.AppBaseURL(), "https://"),
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return token
+}
+
+func GuestAddToCart(c *fiber.Ctx) error {
+	cartItem := new(models.CartItem)
+	if err := c.BodyParser(cartItem); err != nil || cartItem.Quantity <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	var availableStock int
+	query := `SELECT stock FROM products WHERE id=$1 AND deleted=false`
+	err := config.DB.QueryRow(query, cartItem.ProductID).Scan(&availableStock)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Product not found or unavailable"})
+	}
+
+	guestID := guestCartID(c)
+	if guestID == "" {
+		if guestID, err = utils.RandomToken(16); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start guest cart"})
+		}
+	}
+
+	var currentCartQty int
+	cartQuery := `SELECT quantity FROM guest_cart_items WHERE guest_id=$1 AND product_id=$2`
+	_ = config.DB.QueryRow(cartQuery, guestID, cartItem.ProductID).Scan(&currentCartQty)
+
+	if conflict := cartQuantityConflict(cartItem.Quantity, currentCartQty, availableStock); conflict != nil {
+		return c.Status(fiber.StatusConflict).JSON(conflict)
+	}
+
+	query = `
+        INSERT INTO guest_cart_items (guest_id, product_id, quantity)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (guest_id, product_id)
+        DO UPDATE SET quantity = guest_cart_items.quantity + $3, updated_at = NOW()`
+	if _, err := config.DB.Exec(query, guestID, cartItem.ProductID, cartItem.Quantity); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add to cart"})
+	}
+
+	// Re-signing on every add keeps an active cart from expiring.
+	return c.JSON(fiber.Map{
+		"message":     "Product added to cart successfully",
+		"guest_token": setGuestCartToken(c, guestID),
+	})
+}
+
+func GuestRemoveFromCart(c *fiber.Ctx) error {
+	guestID := guestCartID(c)
+	if guestID == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Product not found in cart"})
+	}
+
+	query := `DELETE FROM guest_cart_items WHERE guest_id=$1 AND product_id=$2`
+	result, err := config.DB.Exec(query, guestID, c.Params("product_id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove from cart"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Product not found in cart"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Product removed from cart successfully"})
+}
+
+func GuestViewCart(c *fiber.Ctx) error {
+	cart := []responsemodels.ViewCartItem{}
+	guestID := guestCartID(c)
+
+	query := `
+        SELECT p.id, p.name, p.price, g.quantity,
+               (p.price * g.quantity) AS subtotal,
+               COALESCE(pi.thumbnail_key, '')
+        FROM guest_cart_items g
+        JOIN products p ON g.product_id = p.id
+        LEFT JOIN product_images pi ON pi.product_id = p.id AND pi.is_primary
+        WHERE g.guest_id=$1
+        ORDER BY g.id`
+	rows, err := config.DB.Query(query, guestID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch cart items"})
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item responsemodels.ViewCartItem
+		var thumbnailKey string
+		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Quantity, &item.Subtotal, &thumbnailKey); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse cart item"})
+		}
+		item.ThumbnailURL = utils.Storage().URL(thumbnailKey)
+		cart = append(cart, item)
+	}
+
+	pricing, err := models.PriceGuestCart(config.DB, guestID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to price cart"})
+	}
+	priced := map[int]models.PricedLine{}
+	for _, line := range pricing.Lines {
+		priced[line.ProductID] = line
+	}
+	for i := range cart {
+		line := priced[cart[i].ID]
+		cart[i].OfferDiscount = line.OfferDiscount
+		cart[i].PromotionDiscount = line.PromotionDiscount
+		cart[i].Total = line.Total
+		cart[i].Promotions = line.Promotions
+	}
+
+	return c.JSON(fiber.Map{
+		"message":            "Cart fetched successfully",
+		"cart":               cart,
+		"subtotal":           pricing.Subtotal,
+		"offer_discount":     pricing.OfferDiscount,
+		"promotion_discount": pricing.PromotionDiscount,
+		"total":              pricing.Total,
+		"free_shipping":      pricing.FreeShipping,
+		"promotions":         pricing.Promotions,
+	})
+}
+
+func GuestClearCart(c *fiber.Ctx) error {
+	if guestID := guestCartID(c); guestID != "" {
+		if _, err := config.DB.Exec(`DELETE FROM guest_cart_items WHERE guest_id=$1`, guestID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to clear cart"})
+		}
+	}
+	return c.JSON(fiber.Map{"message": "Cart cleared successfully"})
+}
+
+// mergeGuestCart moves the request's guest cart, if any, into the cart of
+// the customer logging in and returns what was merged for the login
+// response. A failed merge leaves the guest cart in place and does not stop
+// the login.
+func mergeGuestCart(c *fiber.Ctx, userID int) *models.CartMerge {
+	guestID := guestCartID(c)
+	if guestID == "" {
+		return nil
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Failed to merge guest cart for user %d: %v", userID, err)
+		return nil
+	}
+	defer tx.Rollback()
+
+	merge, err := models.MergeGuestCart(tx, guestID, userID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Failed to merge guest cart for user %d: %v", userID, err)
+		return nil
+	}
+	c.ClearCookie(guestCartCookie)
+	return &merge
+}
+
+// loginResponse adds the outcome of merging the visitor's guest cart to the
+// response of a successful login or account verification.
+func loginResponse(c *fiber.Ctx, userID int, response fiber.Map) fiber.Map {
+	if merge := mergeGuestCart(c, userID); merge != nil {
+		response["cart_merge"] = merge
+	}
+	return response
+}
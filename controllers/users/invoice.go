@@ -1,10 +1,13 @@
 package users
 
 import (
+	"bytes"
 	"fmt"
 	"horizon/config"
 	"horizon/models"
+	"horizon/utils"
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jung-kurt/gofpdf"
@@ -23,16 +26,18 @@ func fetchInvoiceData(orderID int) (models.Invoice, error) {
 			o.total_amount, 
 			o.offer_discount, 
 			o.coupon_discount,
-			(o.offer_discount + o.coupon_discount) AS total_discount,
+			(o.offer_discount + o.coupon_discount + o.promotion_discount + o.loyalty_discount) AS total_discount,
 			oi.quantity, 
 			p.name AS product_name, 
 			oi.price AS price_per_unit, 
-			oi.subtotal
+			oi.subtotal,
+			COALESCE(pi.thumbnail_key, '') AS thumbnail_key
 		FROM orders o
 		JOIN users u ON o.user_id = u.id
 		JOIN addresses a ON u.id = a.user_id  
 		JOIN order_items oi ON oi.order_id = o.id
 		JOIN products p ON oi.product_id = p.id
+		LEFT JOIN product_images pi ON pi.product_id = p.id AND pi.is_primary
 		WHERE o.id = $1
 	`
 
@@ -53,7 +58,7 @@ func fetchInvoiceData(orderID int) (models.Invoice, error) {
 			&invoice.UserAddress, &invoice.UserPhoneNumber, &invoice.OrderDate,
 			&invoice.PaymentMethod, &invoice.TotalAmount, &invoice.OfferDiscount,
 			&invoice.CouponDiscount, &invoice.TotalDiscount, &item.Quantity, &item.ProductName,
-			&item.PricePerUnit, &item.Subtotal)
+			&item.PricePerUnit, &item.Subtotal, &item.ThumbnailKey)
 		if err != nil {
 			return models.Invoice{}, err
 		}
@@ -109,7 +114,11 @@ func generateInvoicePDF(invoice models.Invoice) error {
 
 	pdf.SetFont("Arial", "", 10)
 	for _, item := range invoice.Items {
-		pdf.Cell(80, 10, item.ProductName)
+		if name, ok := registerInvoiceThumbnail(pdf, item.ThumbnailKey); ok {
+			pdf.ImageOptions(name, pdf.GetX(), pdf.GetY()+1, 8, 8, false, gofpdf.ImageOptions{}, 0, "")
+		}
+		pdf.SetX(pdf.GetX() + 10)
+		pdf.Cell(70, 10, item.ProductName)
 		pdf.Cell(25, 10, fmt.Sprintf("%d", item.Quantity))
 		pdf.Cell(25, 10, fmt.Sprintf("%.2f", item.PricePerUnit))
 		pdf.Cell(25, 10, fmt.Sprintf("%.2f", item.Subtotal))
@@ -136,6 +145,28 @@ func generateInvoicePDF(invoice models.Invoice) error {
 	return pdf.OutputFileAndClose("invoice.pdf")
 }
 
+// registerInvoiceThumbnail loads a product thumbnail from storage into the
+// PDF. Items without a readable thumbnail are printed without one.
+func registerInvoiceThumbnail(pdf *gofpdf.Fpdf, key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	data, err := utils.Storage().Read(key)
+	if err != nil {
+		return "", false
+	}
+	imageType := "JPG"
+	if strings.HasSuffix(key, ".png") {
+		imageType = "PNG"
+	}
+	pdf.RegisterImageOptionsReader(key, gofpdf.ImageOptions{ImageType: imageType}, bytes.NewReader(data))
+	if !pdf.Ok() {
+		pdf.ClearError()
+		return "", false
+	}
+	return key, true
+}
+
 func GetInvoice(c *fiber.Ctx) error {
 	orderID := c.Params("orderID")
 	if orderID == "" {
@@ -0,0 +1,69 @@
+package users
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LoyaltyDashboard shows a customer's points balance, what it is worth at
+// checkout, their tier and how far they are from the next one, points about
+// to expire and their recent ledger.
+func LoyaltyDashboard(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	settings, err := models.LoadLoyaltySettings(config.DB)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch loyalty settings"})
+	}
+	balance, err := models.LoyaltyBalance(config.DB, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch points balance"})
+	}
+	spend, err := models.RollingSpend(config.DB, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch spend"})
+	}
+	tier, multiplier := settings.Tier(spend)
+
+	var nextTier fiber.Map
+	switch tier {
+	case models.TierMember:
+		nextTier = fiber.Map{"tier": models.TierSilver, "spend_needed": settings.SilverThreshold - spend}
+	case models.TierSilver:
+		nextTier = fiber.Map{"tier": models.TierGold, "spend_needed": settings.GoldThreshold - spend}
+	}
+
+	var expiringSoon int
+	expiringQuery := `
+		SELECT COALESCE(SUM(remaining), 0) FROM loyalty_ledger
+		WHERE user_id = $1 AND remaining > 0 AND expires_at > NOW() AND expires_at <= NOW() + INTERVAL '30 days'`
+	if err := config.DB.Get(&expiringSoon, expiringQuery, userID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch expiring points"})
+	}
+
+	entries := []models.LoyaltyEntry{}
+	ledgerQuery := `
+		SELECT id, entry_type, points, order_id, note, expires_at, created_at
+		FROM loyalty_ledger
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 50`
+	if err := config.DB.Select(&entries, ledgerQuery, userID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch points history"})
+	}
+
+	return c.JSON(fiber.Map{
+		"balance":                   balance,
+		"balance_value":             float64(balance) * settings.RupeesPerPoint,
+		"tier":                      tier,
+		"earning_multiplier":        multiplier,
+		"spend_last_12_months":      spend,
+		"next_tier":                 nextTier,
+		"expiring_in_30_days":       expiringSoon,
+		"max_redemption_percentage": settings.MaxRedemptionPercentage,
+		"history":                   entries,
+	})
+}
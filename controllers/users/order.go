@@ -3,7 +3,9 @@ package users
 import (
 	"fmt"
 	"horizon/config"
+	"horizon/models"
 	responsemodels "horizon/models/responsemodels"
+	"horizon/utils"
 	"log"
 	"time"
 
@@ -103,14 +105,15 @@ func CancelOrder(c *fiber.Ctx) error {
 		}
 	}()
 
+	var orderNumber int
 	var orderAmount float64
 	var status, paymentStatus string
 	checkOrderQuery := `
-		SELECT total_amount, status, payment_status
+		SELECT id, total_amount, status, payment_status
 		FROM orders
 		WHERE id = $1 AND user_id = $2
 	`
-	err = tx.QueryRow(checkOrderQuery, orderID, userID).Scan(&orderAmount, &status, &paymentStatus)
+	err = tx.QueryRow(checkOrderQuery, orderID, userID).Scan(&orderNumber, &orderAmount, &status, &paymentStatus)
 	if err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid order"})
@@ -164,9 +167,16 @@ func CancelOrder(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update order status"})
 	}
 
+	restockedProductIDs, err := models.ReleaseOrder(tx, userID, orderNumber)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to release the order's items"})
+	}
+
 	if err := tx.Commit(); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to commit transaction"})
 	}
+	go utils.StockChanged(restockedProductIDs...)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Order cancelled successfully",
@@ -199,32 +209,6 @@ func UseWalletForPurchase(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or unauthorized address"})
 	}
 
-	var walletBalance float64
-	err = config.DB.QueryRow(`
-		SELECT wallet_balance
-		FROM users
-		WHERE id = $1
-	`, userID).Scan(&walletBalance)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch wallet balance"})
-	}
-
-	var cartTotal float64
-	cartQuery := `
-		SELECT SUM(c.quantity * p.price)
-		FROM cart c
-		JOIN products p ON c.product_id = p.id
-		WHERE c.user_id = $1
-	`
-	err = config.DB.QueryRow(cartQuery, userID).Scan(&cartTotal)
-	if err != nil || cartTotal <= 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Failed to calculate cart total"})
-	}
-
-	if walletBalance < cartTotal {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Insufficient wallet balance"})
-	}
-
 	tx, err := config.DB.Begin()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start transaction"})
@@ -235,11 +219,25 @@ func UseWalletForPurchase(c *fiber.Ctx) error {
 		}
 	}()
 
+	var walletBalance float64
+	err = tx.QueryRow(`
+		SELECT wallet_balance
+		FROM users
+		WHERE id = $1
+		FOR UPDATE
+	`, userID).Scan(&walletBalance)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch wallet balance"})
+	}
+
 	cartItemsQuery := `
 		SELECT p.id, p.stock, c.quantity, p.price
 		FROM cart c
 		JOIN products p ON c.product_id = p.id
 		WHERE c.user_id = $1
+		ORDER BY p.id
+		FOR UPDATE OF p
 	`
 	rows, err := tx.Query(cartItemsQuery, userID)
 	if err != nil {
@@ -280,6 +278,24 @@ func UseWalletForPurchase(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cart is empty"})
 	}
 
+	// As at checkout, flash sale items stay locked until the order claims
+	// its units, so the cart is priced with units nobody else can take.
+	if err := models.LockCartFlashSales(tx, userID); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check flash sales"})
+	}
+	pricing, err := models.PriceUserCart(tx, userID)
+	if err != nil || len(pricing.Lines) == 0 {
+		tx.Rollback()
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Failed to calculate cart total"})
+	}
+	cartTotal := pricing.Total
+
+	if walletBalance < cartTotal {
+		tx.Rollback()
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Insufficient wallet balance"})
+	}
+
 	newBalance := walletBalance - cartTotal
 	_, err = tx.Exec(`
 		UPDATE users
@@ -295,28 +311,47 @@ func UseWalletForPurchase(c *fiber.Ctx) error {
 	var orderID int
 	createOrderQuery := `
 		INSERT INTO orders 
-		(order_id, user_id, total_amount, payment_method, payment_status, status, address_line, city, zip_code) 
+		(order_id, user_id, total_amount, offer_discount, promotion_discount, payment_method, payment_status, status, address_line, city, zip_code) 
 		VALUES 
-		($1, $2, $3, $4, $5, $6, $7, $8, $9) 
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) 
 		RETURNING id
 	`
-	err = tx.QueryRow(createOrderQuery, uniqueOrderID, userID, cartTotal, "wallet", "Paid", "Confirmed", address.AddressLine, address.City, address.ZipCode).Scan(&orderID)
+	err = tx.QueryRow(createOrderQuery, uniqueOrderID, userID, cartTotal, pricing.OfferDiscount, pricing.PromotionDiscount, "wallet", "Paid", "Confirmed", address.AddressLine, address.City, address.ZipCode).Scan(&orderID)
 	if err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create order"})
 	}
+	if err := models.RecordOrderPromotions(tx, orderID, pricing.Promotions); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record order promotions"})
+	}
+	if err := models.ClaimFlashSaleUnits(tx, userID, orderID, pricing.Lines); err != nil {
+		tx.Rollback()
+		if err == models.ErrFlashSaleUnavailable || err == models.ErrFlashSaleCustomerLimit {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Flash sale units are no longer available, please review your cart"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to claim flash sale units"})
+	}
 
+	var orderedProductIDs []int
 	for _, item := range cartItems {
+		orderedProductIDs = append(orderedProductIDs, item.ProductID)
 		subtotal := item.Price * float64(item.Quantity)
-		_, err := tx.Exec(`
+		var orderItemID int
+		err := tx.QueryRow(`
 			INSERT INTO order_items (order_id, product_id, quantity, price, subtotal)
-			VALUES ($1, $2, $3, $4, $5)`,
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`,
 			orderID, item.ProductID, item.Quantity, item.Price, subtotal,
-		)
+		).Scan(&orderItemID)
 		if err != nil {
 			tx.Rollback()
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add order items"})
 		}
+		if err := models.AllocateOrderLine(tx, orderID, orderItemID, item.ProductID, item.Quantity, address.ZipCode); err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to allocate order items"})
+		}
 	}
 
 	_, err = tx.Exec(`DELETE FROM cart WHERE user_id = $1`, userID)
@@ -324,10 +359,15 @@ func UseWalletForPurchase(c *fiber.Ctx) error {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to clear cart"})
 	}
+	if err := models.MarkCartRecovered(tx, userID, orderID, cartTotal); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record cart recovery"})
+	}
 
 	if err := tx.Commit(); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to finalize transaction"})
 	}
+	go utils.StockChanged(orderedProductIDs...)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message":        "Order placed successfully using wallet",
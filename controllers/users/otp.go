@@ -16,7 +16,19 @@ func ResendOTP(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	err := utils.ResendOTP(req.Email)
+	var pending bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE email=$1 AND verified=false)`
+	if err := config.DB.QueryRow(query, req.Email).Scan(&pending); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check account"})
+	}
+	if !pending {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "No account awaiting verification for this email"})
+	}
+
+	err := utils.ResendOTP(req.Email, utils.OTPPurposeSignup, c.IP())
+	if err == utils.ErrOTPLocked || err == utils.ErrOTPRateLimited {
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -30,15 +42,24 @@ func VerifyOTP(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	if !utils.ValidateOTP(req.Email, req.OTP) {
+	err := utils.ValidateOTP(req.Email, utils.OTPPurposeSignup, req.OTP)
+	if err == utils.ErrOTPLocked {
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err == utils.ErrOTPInvalid {
 		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired OTP"})
 	}
+	if err != nil {
+		log.Printf("Failed to validate OTP: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify OTP"})
+	}
 
-	query := `UPDATE users SET verified=true WHERE email=$1`
-	if _, err := config.DB.Exec(query, req.Email); err != nil {
+	var userID int
+	query := `UPDATE users SET verified=true WHERE email=$1 RETURNING id`
+	if err := config.DB.QueryRow(query, req.Email).Scan(&userID); err != nil {
 		log.Printf("Failed to update user verification: %v", err)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify account"})
 	}
 
-	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "OTP verified successfully"})
+	return c.Status(http.StatusOK).JSON(loginResponse(c, userID, fiber.Map{"message": "OTP verified successfully"}))
 }
@@ -0,0 +1,133 @@
+package users
+
+import (
+	"database/sql"
+	"fmt"
+	"horizon/config"
+	middleware "horizon/middlewares"
+	"horizon/models"
+	"horizon/utils"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// loginUser looks up an account for passwordless login and applies the same
+// verified and blocked checks as Login. A non-zero status means login is refused.
+func loginUser(email string) (int, int, string) {
+	var userID int
+	var verified, blocked bool
+	query := `SELECT id, verified, blocked FROM users WHERE email=$1`
+	err := config.DB.QueryRow(query, email).Scan(&userID, &verified, &blocked)
+	if err == sql.ErrNoRows {
+		return 0, http.StatusUnauthorized, "Invalid email"
+	}
+	if err != nil {
+		return 0, http.StatusInternalServerError, "Failed to fetch user"
+	}
+
+	if !verified {
+		return 0, http.StatusForbidden, "Account not verified. Please verify with OTP."
+	}
+	if blocked {
+		return 0, http.StatusForbidden, "Your account is blocked. Contact support for assistance."
+	}
+
+	return userID, 0, ""
+}
+
+const loginCodeSent = "Login code has been sent to your email!"
+
+func RequestLoginOTP(c *fiber.Ctx) error {
+	req := new(models.OTP)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	// Accounts that cannot sign in get the same answer as those that can, so
+	// the endpoint does not reveal which emails are registered.
+	_, status, msg := loginUser(req.Email)
+	if status == http.StatusInternalServerError {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+	if status != 0 {
+		return c.JSON(fiber.Map{"message": loginCodeSent})
+	}
+
+	otp, err := utils.IssueOTP(req.Email, utils.OTPPurposeLogin, c.IP())
+	if err == utils.ErrOTPLocked || err == utils.ErrOTPRateLimited {
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	linkToken, err := utils.IssueMagicLinkToken(req.Email)
+	if err != nil {
+		log.Printf("Failed to issue magic link: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create login link"})
+	}
+
+	link := fmt.Sprintf("%s/user/login/magic?email=%s&token=%s", config.AppBaseURL(), url.QueryEscape(req.Email), linkToken)
+	body := fmt.Sprintf("Your Horizon login code is: %s\r\n\r\nOr sign in with this link: %s\r\n\r\nBoth expire in 5 minutes.", otp, link)
+	go utils.SendEmail(req.Email, "Your Horizon login code", body)
+
+	return c.JSON(fiber.Map{"message": loginCodeSent})
+}
+
+func VerifyLoginOTP(c *fiber.Ctx) error {
+	req := new(models.OTP)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	return completePasswordlessLogin(c, req.Email, utils.OTPPurposeLogin, req.OTP)
+}
+
+func MagicLinkLogin(c *fiber.Ctx) error {
+	email := c.Query("email")
+	token := c.Query("token")
+	if email == "" || token == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Email and token are required"})
+	}
+
+	return completePasswordlessLogin(c, email, utils.OTPPurposeMagicLink, token)
+}
+
+func completePasswordlessLogin(c *fiber.Ctx, email string, purpose utils.OTPPurpose, secret string) error {
+	err := utils.ValidateOTP(email, purpose, secret)
+	if err == utils.ErrOTPLocked {
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err == utils.ErrOTPInvalid {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired login code"})
+	}
+	if err != nil {
+		log.Printf("Failed to validate login code: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify login code"})
+	}
+
+	// The code and the link are alternatives, so using one retires the other.
+	other := utils.OTPPurposeMagicLink
+	if purpose == utils.OTPPurposeMagicLink {
+		other = utils.OTPPurposeLogin
+	}
+	if err := utils.DiscardOTP(email, other); err != nil {
+		log.Printf("Failed to discard unused login code: %v", err)
+	}
+
+	userID, status, msg := loginUser(email)
+	if status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	token, err := middleware.GenerateToken(userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+	recordDevice(userID, c.Get(deviceHeader))
+
+	return c.JSON(loginResponse(c, userID, fiber.Map{"message": "Login successful", "token": token}))
+}
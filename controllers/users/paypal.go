@@ -2,9 +2,13 @@ package users
 
 import (
 	"context"
+	"database/sql"
 	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/plutov/paypal/v4"
@@ -73,29 +77,64 @@ func PayPalSuccess(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Order reference missing from PayPal response"})
 	}
 
-	updateOrderQuery := `UPDATE orders SET payment_status = 'Completed' WHERE id = $1`
-	res, err := config.DB.Exec(updateOrderQuery, orderID)
+	tx, err := config.DB.Begin()
 	if err != nil {
-		log.Printf("Failed to update payment status for order ID %s: %v\n", orderID, err)
+		log.Printf("Failed to start transaction for order ID %s: %v\n", orderID, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update order status"})
 	}
-
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
+	defer tx.Rollback()
+
+	var userID int
+	var orderTotal float64
+	var status string
+	orderQuery := `SELECT user_id, total_amount, status FROM orders WHERE id = $1 AND payment_status = 'Processing' FOR UPDATE`
+	err = tx.QueryRow(orderQuery, orderID).Scan(&userID, &orderTotal, &status)
+	if err == sql.ErrNoRows {
 		log.Printf("No rows updated for order ID %s. Payment status might already be 'Completed'.\n", orderID)
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Order status update failed"})
 	}
-
-	deductStockQuery := `
-		UPDATE products
-		SET stock = stock - oi.quantity
-		FROM order_items oi
-		WHERE products.id = oi.product_id AND oi.order_id = $1
-	`
-	_, err = config.DB.Exec(deductStockQuery, orderID)
 	if err != nil {
-		log.Printf("Failed to deduct stock for order ID %s: %v\n", orderID, err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to deduct stock"})
+		log.Printf("Failed to update payment status for order ID %s: %v\n", orderID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update order status"})
+	}
+
+	if _, err := tx.Exec(`UPDATE orders SET payment_status = 'Completed' WHERE id = $1`, orderID); err != nil {
+		log.Printf("Failed to update payment status for order ID %s: %v\n", orderID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update order status"})
+	}
+
+	// An order cancelled while the buyer was still at PayPal has already
+	// given its items back, so the payment is refunded to the wallet.
+	if status == "Cancelled" {
+		if _, err := tx.Exec(`UPDATE users SET wallet_balance = wallet_balance + $1 WHERE id = $2`, orderTotal, userID); err != nil {
+			log.Printf("Failed to refund cancelled order ID %s: %v\n", orderID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refund cancelled order"})
+		}
+		_, err := tx.Exec(`INSERT INTO wallet_transactions (user_id, order_id, amount, transaction_type) VALUES ($1, $2, $3, 'refund')`,
+			userID, orderID, orderTotal)
+		if err != nil {
+			log.Printf("Failed to log refund for cancelled order ID %s: %v\n", orderID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refund cancelled order"})
+		}
+		if err := tx.Commit(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refund cancelled order"})
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":    "The order was cancelled before payment; the amount has been refunded to your wallet",
+			"order_id": orderID,
+		})
+	}
+
+	// A PayPal order only recovers an abandoned cart once it is paid.
+	if id, _ := strconv.Atoi(orderID); id > 0 {
+		if err := models.MarkCartRecovered(tx, userID, id, orderTotal); err != nil {
+			log.Printf("Failed to record cart recovery for order ID %s: %v\n", orderID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update order status"})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to update payment status for order ID %s: %v\n", orderID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update order status"})
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -103,9 +142,58 @@ func PayPalSuccess(c *fiber.Ctx) error {
 		"order_id": orderID,
 	})
 }
+
+// PayPalCancel cancels the order the buyer backed out of at PayPal, giving
+// back its items and putting them back in the cart. Orders whose lookup
+// fails are left for the abandoned order job.
 func PayPalCancel(c *fiber.Ctx) error {
+	if token := c.Query("token"); token != "" {
+		order, err := config.GetPayPalClient().GetOrder(context.Background(), token)
+		if err != nil {
+			log.Printf("PayPal GetOrder error: %v\n", err)
+		} else {
+			for _, purchaseUnit := range order.PurchaseUnits {
+				if orderID, err := strconv.Atoi(purchaseUnit.ReferenceID); err == nil {
+					if err := cancelUnpaidOrder(orderID); err != nil {
+						log.Printf("Failed to cancel order ID %d: %v\n", orderID, err)
+					}
+				}
+			}
+		}
+	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Payment was canceled by the user.",
 	})
 }
+
+// cancelUnpaidOrder cancels an order whose PayPal payment was abandoned and
+// puts its items back in the buyer's cart.
+func cancelUnpaidOrder(orderID int) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	productIDs, cancelled, err := models.CancelUnpaidOrder(tx, orderID)
+	if err != nil || !cancelled {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO cart (user_id, product_id, quantity)
+		SELECT o.user_id, oi.product_id, LEAST(SUM(oi.quantity), $2)
+		FROM order_items oi
+		JOIN orders o ON o.id = oi.order_id
+		WHERE oi.order_id = $1
+		GROUP BY o.user_id, oi.product_id
+		ON CONFLICT (user_id, product_id) DO NOTHING`, orderID, models.MaxQtyPerPerson)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	go utils.StockChanged(productIDs...)
+	return nil
+}
@@ -0,0 +1,145 @@
+package users
+
+import (
+	"database/sql"
+	"horizon/config"
+	"horizon/models"
+	responsemodels "horizon/models/responsemodels"
+	queries "horizon/sql"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+const (
+	relatedProductsLimit = 8
+	lowStockThreshold    = 5
+)
+
+type productOffer struct {
+	DiscountPercentage float64   `json:"discount_percentage" db:"discount_percentage"`
+	StartDate          time.Time `json:"start_date" db:"start_date"`
+	EndDate            time.Time `json:"end_date" db:"end_date"`
+	Scope              string    `json:"scope" db:"scope"`
+}
+
+type productStock struct {
+	Status   string `json:"status"`
+	Quantity int    `json:"quantity"`
+	LowStock bool   `json:"low_stock"`
+}
+
+// ProductDetail returns a single product with its offer, stock, category
+// path, images, specifications and two recommendation lists. "Frequently
+// bought together" comes from scores precomputed by a background job.
+func ProductDetail(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	products, err := fetchProductViews(" AND p.id = $1", productID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch product"})
+	}
+	if len(products) == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found"})
+	}
+
+	var categoryID, quantity int
+	if err := config.DB.QueryRow(`SELECT category_id, stock FROM products WHERE id=$1`, productID).Scan(&categoryID, &quantity); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch product"})
+	}
+	stock := productStock{
+		Status:   products[0].Status,
+		Quantity: quantity,
+		LowStock: quantity > 0 && quantity <= lowStockThreshold,
+	}
+
+	var offer *productOffer
+	var activeOffer productOffer
+	offerQuery := `SELECT o.discount_percentage, o.start_date, o.end_date, o.scope FROM products p` +
+		queries.ActiveOfferJoin + ` WHERE p.id = $1 AND o.offer_id IS NOT NULL`
+	err = config.DB.Get(&activeOffer, offerQuery, productID)
+	if err == nil {
+		offer = &activeOffer
+	} else if err != sql.ErrNoRows {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch offer"})
+	}
+
+	var category []responsemodels.Breadcrumb
+	if err := config.DB.Select(&category, queries.CategoryPathQuery, categoryID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch category"})
+	}
+
+	images, err := models.FetchProductImages(productID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch product images"})
+	}
+
+	specs := []models.ProductSpec{}
+	if err := config.DB.Select(&specs, queries.ProductSpecsQuery, productID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch product specifications"})
+	}
+
+	related, err := fetchProductViews(" AND p.category_id = $1 AND p.id <> $2 ORDER BY p.avg_rating DESC, p.rating_count DESC, p.id LIMIT $3",
+		categoryID, productID, relatedProductsLimit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch related products"})
+	}
+
+	boughtTogether, err := fetchBoughtTogether(productID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch recommendations"})
+	}
+
+	return c.JSON(fiber.Map{
+		"product":                    products[0],
+		"offer":                      offer,
+		"stock":                      stock,
+		"category":                   category,
+		"images":                     images,
+		"specs":                      specs,
+		"related_products":           nonNilProducts(related),
+		"frequently_bought_together": boughtTogether,
+	})
+}
+
+// fetchBoughtTogether returns the live products most often ordered with
+// productID, highest score first.
+func fetchBoughtTogether(productID int) ([]ProductView, error) {
+	var companionIDs []int64
+	query := `SELECT related_product_id FROM product_cooccurrence WHERE product_id = $1 ORDER BY score DESC, related_product_id`
+	if err := config.DB.Select(&companionIDs, query, productID); err != nil {
+		return nil, err
+	}
+	if len(companionIDs) == 0 {
+		return []ProductView{}, nil
+	}
+
+	products, err := fetchProductViews(" AND p.id = ANY($1)", pq.Array(companionIDs))
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]ProductView{}
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	ordered := []ProductView{}
+	for _, id := range companionIDs {
+		if product, ok := byID[int(id)]; ok {
+			ordered = append(ordered, product)
+		}
+	}
+	return ordered, nil
+}
+
+func nonNilProducts(products []ProductView) []ProductView {
+	if products == nil {
+		return []ProductView{}
+	}
+	return products
+}
@@ -0,0 +1,78 @@
+package users
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// deviceHeader carries a stable id the client generates per device. It is
+// only used to spot referrals between accounts on one device.
+const deviceHeader = "X-Device-ID"
+
+func recordDevice(userID int, deviceID string) {
+	if err := models.RecordUserDevice(config.DB, userID, deviceID); err != nil {
+		log.Printf("Failed to record device for user %d: %v", userID, err)
+	}
+}
+
+// applyReferral links a new account to the referral code it signed up with.
+// Signup has already gone through, so a failure here is only logged.
+func applyReferral(userID int, code, deviceID string) {
+	if code == "" {
+		return
+	}
+	if err := models.CreateReferral(config.DB, userID, code, deviceID); err != nil {
+		log.Printf("Failed to record referral for user %d: %v", userID, err)
+	}
+}
+
+// ReferralDashboard shows the customer their referral code and link, the
+// current rewards, and how the people they referred are getting on.
+func ReferralDashboard(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var code string
+	if err := config.DB.Get(&code, `SELECT referral_code FROM users WHERE id = $1`, userID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch referral code"})
+	}
+	settings, err := models.LoadReferralSettings(config.DB)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch referral settings"})
+	}
+
+	referrals := []models.Referral{}
+	query := `
+		SELECT r.id, SPLIT_PART(u.name, ' ', 1) AS referee_name, r.status, r.rejection_reason,
+		       r.referrer_reward, r.created_at, r.rewarded_at
+		FROM referrals r
+		JOIN users u ON u.id = r.referee_id
+		WHERE r.referrer_id = $1
+		ORDER BY r.created_at DESC`
+	if err := config.DB.Select(&referrals, query, userID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch referrals"})
+	}
+
+	var earned float64
+	counts := map[string]int{models.ReferralPending: 0, models.ReferralRewarded: 0, models.ReferralRejected: 0, models.ReferralReversed: 0}
+	for _, referral := range referrals {
+		counts[referral.Status]++
+		if referral.Status == models.ReferralRewarded && referral.ReferrerReward != nil {
+			earned += *referral.ReferrerReward
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"referral_code": code,
+		"referral_link": config.AppBaseURL() + "/signup?ref=" + code,
+		"active":        settings.Active,
+		"your_reward":   settings.ReferrerReward,
+		"friend_reward": settings.RefereeReward,
+		"counts":        counts,
+		"total_earned":  earned,
+		"referrals":     referrals,
+	})
+}
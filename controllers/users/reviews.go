@@ -0,0 +1,298 @@
+package users
+
+import (
+	"fmt"
+	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxReviewPhotos = 3
+
+type reviewPhotoKeys struct {
+	image, thumbnail string
+}
+
+// saveReviewPhotos validates and stores the uploaded review photos, removing
+// anything already saved if a later photo fails.
+func saveReviewPhotos(c *fiber.Ctx, productID, userID int) ([]reviewPhotoKeys, string) {
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["photos"]) == 0 {
+		return nil, ""
+	}
+	if len(form.File["photos"]) > maxReviewPhotos {
+		return nil, fmt.Sprintf("A review can have at most %d photos", maxReviewPhotos)
+	}
+
+	store := utils.Storage()
+	var saved []reviewPhotoKeys
+	cleanup := func() {
+		for _, keys := range saved {
+			store.Delete(keys.image)
+			store.Delete(keys.thumbnail)
+		}
+	}
+
+	for _, header := range form.File["photos"] {
+		if header.Size > utils.MaxImageSize {
+			cleanup()
+			return nil, utils.ErrImageTooLarge.Error()
+		}
+		file, err := header.Open()
+		if err != nil {
+			cleanup()
+			return nil, "Failed to read photo"
+		}
+		data, err := io.ReadAll(io.LimitReader(file, utils.MaxImageSize+1))
+		file.Close()
+		if err != nil {
+			cleanup()
+			return nil, "Failed to read photo"
+		}
+
+		renditions, err := utils.ProcessImage(data)
+		if err != nil {
+			cleanup()
+			return nil, err.Error()
+		}
+
+		name, err := utils.RandomToken(12)
+		if err != nil {
+			cleanup()
+			return nil, "Failed to store photo"
+		}
+		base := fmt.Sprintf("reviews/%d/%d_%s", productID, userID, name)
+		keys := reviewPhotoKeys{
+			image:     base + "_medium" + renditions.RenditionExt,
+			thumbnail: base + "_thumb" + renditions.RenditionExt,
+		}
+		if err := store.Save(keys.image, renditions.Medium); err != nil {
+			cleanup()
+			return nil, "Failed to store photo"
+		}
+		if err := store.Save(keys.thumbnail, renditions.Thumbnail); err != nil {
+			store.Delete(keys.image)
+			cleanup()
+			return nil, "Failed to store photo"
+		}
+		saved = append(saved, keys)
+	}
+	return saved, ""
+}
+
+// SubmitReview creates or replaces the caller's review of a product. Only
+// customers with a delivered order containing the product may review it, and
+// every submission goes back into the moderation queue.
+func SubmitReview(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var req struct {
+		Rating int    `json:"rating" form:"rating"`
+		Title  string `json:"title" form:"title"`
+		Body   string `json:"body" form:"body"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Rating < 1 || req.Rating > 5 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Rating must be between 1 and 5"})
+	}
+	if len(req.Title) > 150 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Title must be at most 150 characters"})
+	}
+
+	var verified bool
+	verifiedQuery := `
+		SELECT EXISTS (
+			SELECT 1 FROM order_items oi
+			JOIN orders o ON oi.order_id = o.id
+			WHERE o.user_id = $1 AND oi.product_id = $2 AND o.status = 'Delivered'
+		)`
+	if err := config.DB.QueryRow(verifiedQuery, userID, productID).Scan(&verified); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check order history"})
+	}
+	if !verified {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Only customers who received this product can review it"})
+	}
+
+	photos, msg := saveReviewPhotos(c, productID, userID)
+	if msg != "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	discardPhotos := func() {
+		for _, keys := range photos {
+			utils.Storage().Delete(keys.image)
+			utils.Storage().Delete(keys.thumbnail)
+		}
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		discardPhotos()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save review"})
+	}
+	defer tx.Rollback()
+
+	var reviewID int
+	upsertQuery := `
+		INSERT INTO product_reviews (product_id, user_id, rating, title, body, status)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), 'Pending')
+		ON CONFLICT (product_id, user_id) DO UPDATE
+		SET rating = $3, title = NULLIF($4, ''), body = NULLIF($5, ''), status = 'Pending', updated_at = NOW()
+		RETURNING id`
+	if err := tx.QueryRow(upsertQuery, productID, userID, req.Rating, req.Title, req.Body).Scan(&reviewID); err != nil {
+		log.Printf("Failed to save review: %v", err)
+		discardPhotos()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save review"})
+	}
+
+	// New photos replace the old set; the old files go to the cleanup queue.
+	if len(photos) > 0 {
+		replaceQuery := `
+			WITH removed AS (
+				DELETE FROM review_photos WHERE review_id = $1 RETURNING image_key, thumbnail_key
+			)
+			INSERT INTO file_deletions (file_key)
+			SELECT unnest(ARRAY[image_key, thumbnail_key]) FROM removed`
+		if _, err := tx.Exec(replaceQuery, reviewID); err != nil {
+			discardPhotos()
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save review photos"})
+		}
+		for i, keys := range photos {
+			photoQuery := `INSERT INTO review_photos (review_id, image_key, thumbnail_key, sort_order) VALUES ($1, $2, $3, $4)`
+			if _, err := tx.Exec(photoQuery, reviewID, keys.image, keys.thumbnail, i); err != nil {
+				discardPhotos()
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save review photos"})
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		discardPhotos()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save review"})
+	}
+
+	// An edited review leaves the approved set until it is moderated again.
+	if err := models.RefreshProductRating(productID); err != nil {
+		log.Printf("Failed to refresh rating for product %d: %v", productID, err)
+	}
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message":   "Review submitted and awaiting moderation",
+		"review_id": reviewID,
+	})
+}
+
+func ViewProductReviews(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var orderBy string
+	switch c.Query("sort_by", "helpful") {
+	case "recent":
+		orderBy = "ORDER BY r.created_at DESC"
+	case "rating_desc":
+		orderBy = "ORDER BY r.rating DESC, r.created_at DESC"
+	case "rating_asc":
+		orderBy = "ORDER BY r.rating ASC, r.created_at DESC"
+	default:
+		orderBy = "ORDER BY r.helpful_count DESC, r.created_at DESC"
+	}
+
+	reviews := []models.Review{}
+	query := `
+		SELECT r.id, r.product_id, r.user_id, u.name AS user_name, r.rating, COALESCE(r.title, '') AS title,
+		       COALESCE(r.body, '') AS body, r.status, r.helpful_count, r.created_at
+		FROM product_reviews r
+		JOIN users u ON r.user_id = u.id
+		WHERE r.product_id = $1 AND r.status = 'Approved'
+	` + orderBy
+	if err := config.DB.Select(&reviews, query, productID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch reviews"})
+	}
+	if err := models.AttachReviewPhotos(reviews); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch review photos"})
+	}
+
+	var summary struct {
+		AvgRating   float64 `db:"avg_rating"`
+		RatingCount int     `db:"rating_count"`
+	}
+	if err := config.DB.Get(&summary, `SELECT avg_rating, rating_count FROM products WHERE id = $1`, productID); err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found"})
+	}
+
+	return c.JSON(fiber.Map{
+		"avg_rating":   summary.AvgRating,
+		"rating_count": summary.RatingCount,
+		"reviews":      reviews,
+	})
+}
+
+func MarkReviewHelpful(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	reviewID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid review ID"})
+	}
+
+	var authorID int
+	err = config.DB.QueryRow(`SELECT user_id FROM product_reviews WHERE id = $1 AND status = 'Approved'`, reviewID).Scan(&authorID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Review not found"})
+	}
+	if authorID == userID {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "You cannot vote on your own review"})
+	}
+
+	query := `
+		WITH vote AS (
+			INSERT INTO review_votes (review_id, user_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+			RETURNING review_id
+		)
+		UPDATE product_reviews SET helpful_count = helpful_count + 1 WHERE id IN (SELECT review_id FROM vote)`
+	if _, err := config.DB.Exec(query, reviewID, userID); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to record vote"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Marked as helpful"})
+}
+
+func UnmarkReviewHelpful(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	reviewID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid review ID"})
+	}
+
+	query := `
+		WITH vote AS (
+			DELETE FROM review_votes WHERE review_id = $1 AND user_id = $2
+			RETURNING review_id
+		)
+		UPDATE product_reviews SET helpful_count = helpful_count - 1 WHERE id IN (SELECT review_id FROM vote)`
+	result, err := config.DB.Exec(query, reviewID, userID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove vote"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No vote found for this review"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Vote removed"})
+}
@@ -0,0 +1,53 @@
+package users
+
+import (
+	"horizon/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SubscribeStockNotification asks to be emailed once an out-of-stock product
+// is available again. Subscribing again after a notification re-arms it.
+func SubscribeStockNotification(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	var stock int
+	if err := config.DB.QueryRow(`SELECT stock FROM products WHERE id = $1 AND deleted = false`, productID).Scan(&stock); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Product not found"})
+	}
+	if stock > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Product is already in stock"})
+	}
+
+	query := `
+		INSERT INTO stock_subscriptions (user_id, product_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, product_id) DO UPDATE SET notified_at = NULL, created_at = NOW()`
+	if _, err := config.DB.Exec(query, userID, productID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to subscribe"})
+	}
+
+	return c.JSON(fiber.Map{"message": "We will email you when this product is back in stock"})
+}
+
+func UnsubscribeStockNotification(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	result, err := config.DB.Exec(`DELETE FROM stock_subscriptions WHERE user_id = $1 AND product_id = $2 AND notified_at IS NULL`, userID, productID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unsubscribe"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No pending notification for this product"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Back-in-stock notification cancelled"})
+}
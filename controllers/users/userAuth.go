@@ -1,11 +1,11 @@
 package users
 
 import (
-	"fmt"
 	"horizon/config"
 	middleware "horizon/middlewares"
 	"horizon/models"
 	"horizon/utils"
+	"log"
 	"net/http"
 	"strings"
 
@@ -19,6 +19,13 @@ func Signup(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
+	var referral struct {
+		Code string `json:"referral_code"`
+	}
+	if err := c.BodyParser(&referral); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
 	user.Name = strings.TrimSpace(user.Name)
 	if len(user.Name) < 3 || len(user.Name) == 0 {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Name must be at least 3 characters and cannot be empty or spaces"})
@@ -46,6 +53,12 @@ func Signup(c *fiber.Ctx) error {
 		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Email or phone number already exists"})
 	}
 
+	if referral.Code != "" {
+		if _, err := models.FindReferrer(config.DB, referral.Code); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid referral code"})
+		}
+	}
+
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to process password"})
@@ -56,12 +69,17 @@ func Signup(c *fiber.Ctx) error {
 	if err := config.DB.QueryRow(query, user.Name, user.Email, user.Phone, hashedPassword, false).Scan(&userID); err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user"})
 	}
+	deviceID := c.Get(deviceHeader)
+	applyReferral(userID, referral.Code, deviceID)
+	recordDevice(userID, deviceID)
 
-	otp := utils.GenerateOTP()
+	otp, err := utils.IssueOTP(user.Email, utils.OTPPurposeSignup, c.IP())
+	if err != nil {
+		log.Printf("Failed to issue signup OTP: %v", err)
+		return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Account created. Request a new OTP to verify your email."})
+	}
 	go utils.SendEmail(user.Email, "Horizon Ecommerce ", "Get Your Account verified by using OTP: "+otp)
 
-	utils.StoreOTP(user.Email, otp)
-	fmt.Println(otp)
 	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "OTP has been sent to your email!"})
 }
 
@@ -96,6 +114,7 @@ func Login(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
 	}
+	recordDevice(user.ID, c.Get(deviceHeader))
 
-	return c.JSON(fiber.Map{"message": "Login successful", "token": token})
+	return c.JSON(loginResponse(c, user.ID, fiber.Map{"message": "Login successful", "token": token}))
 }
@@ -1,13 +1,20 @@
 package users
 
 import (
+	"database/sql"
 	"fmt"
 	"horizon/config"
 	"horizon/models"
 	responsemodels "horizon/models/responsemodels"
+	queries "horizon/sql"
+	"horizon/utils"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
 )
 
 type ProductView struct {
@@ -17,12 +24,25 @@ type ProductView struct {
 	Price              float64  `json:"price"`
 	FinalPrice         float64  `json:"final_price"`
 	DiscountPercentage *float64 `json:"discount_percentage,omitempty"`
+	OfferScope         *string  `json:"offer_scope,omitempty"`
 	CategoryName       string   `json:"category_name"`
+	BrandID            *int     `json:"brand_id"`
+	BrandName          string   `json:"brand_name,omitempty"`
 	Status             string   `json:"status"`
+	AvgRating          float64  `json:"avg_rating"`
+	RatingCount        int      `json:"rating_count"`
+	ImageURL           string   `json:"image_url,omitempty"`
+	ThumbnailURL       string   `json:"thumbnail_url,omitempty"`
+
+	CategoryID int                       `json:"-"`
+	FlashSale  *models.FlashSaleLine     `json:"flash_sale,omitempty"`
+	Promotions []models.AppliedPromotion `json:"promotions,omitempty"`
 }
 
-func ViewProducts(c *fiber.Ctx) error {
-	query := `
+// productViewQuery lists live products with their current offer applied;
+// fetchProductViews then applies promotions to final_price. Callers append
+// further conditions to the WHERE clause.
+var productViewQuery = `
 		SELECT 
 			p.id, 
 			p.name, 
@@ -35,34 +55,110 @@ func ViewProducts(c *fiber.Ctx) error {
 				END, p.price
 			) AS final_price,
 			o.discount_percentage,
+			o.scope AS offer_scope,
 			c.name AS category_name, 
+			p.category_id,
+			b.id AS brand_id,
+			COALESCE(b.name, '') AS brand_name,
 			CASE 
 				WHEN p.stock > 0 THEN 'Available'
 				ELSE 'Out of Stock' 
-			END AS status
-		FROM products p
-		LEFT JOIN offers o ON p.id = o.product_id AND o.start_date <= NOW() AND o.end_date >= NOW()
+			END AS status,
+			p.avg_rating,
+			p.rating_count,
+			pi.medium_key,
+			pi.thumbnail_key
+		FROM products p` + queries.ActiveOfferJoin + `
 		JOIN categories c ON p.category_id = c.id
+		LEFT JOIN brands b ON p.brand_id = b.id AND b.deleted = false
+		LEFT JOIN product_images pi ON pi.product_id = p.id AND pi.is_primary
 		WHERE p.deleted = false`
 
-	rows, err := config.DB.Query(query)
+func fetchProductViews(filter string, args ...interface{}) ([]ProductView, error) {
+	rows, err := config.DB.Query(productViewQuery+filter, args...)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch products",
-		})
+		return nil, err
 	}
 	defer rows.Close()
 
+	store := utils.Storage()
 	var products []ProductView
 	for rows.Next() {
 		var product ProductView
-		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.FinalPrice, &product.DiscountPercentage, &product.CategoryName, &product.Status); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to parse products",
-			})
+		var mediumKey, thumbnailKey sql.NullString
+		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.FinalPrice, &product.DiscountPercentage, &product.OfferScope, &product.CategoryName, &product.CategoryID, &product.BrandID, &product.BrandName, &product.Status, &product.AvgRating, &product.RatingCount, &mediumKey, &thumbnailKey); err != nil {
+			return nil, err
 		}
+		product.ImageURL = store.URL(mediumKey.String)
+		product.ThumbnailURL = store.URL(thumbnailKey.String)
 		products = append(products, product)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return products, applyListingPromotions(products)
+}
+
+// applyListingPromotions prices one unit of each product as an anonymous
+// shopper would see it, so listings only show flash sales and promotions
+// anyone can get. Promotions that need a customer segment, a first order or
+// a minimum cart are left for the cart and checkout.
+func applyListingPromotions(products []ProductView) error {
+	if len(products) == 0 {
+		return nil
+	}
+	promotions, err := models.LoadLivePromotions(config.DB)
+	if err != nil {
+		return err
+	}
+	productIDs := make([]int, len(products))
+	for i, product := range products {
+		productIDs[i] = product.ID
+	}
+	flashSales, err := models.LiveFlashSaleLines(config.DB, productIDs)
+	if err != nil {
+		return err
+	}
+	if len(promotions) == 0 && len(flashSales) == 0 {
+		return nil
+	}
+	ancestry, err := models.CategoryAncestry(config.DB)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range products {
+		product := &products[i]
+		line := models.PricingLine{
+			ProductID:       product.ID,
+			Name:            product.Name,
+			CategoryIDs:     ancestry[product.CategoryID],
+			BrandID:         product.BrandID,
+			Quantity:        1,
+			UnitPrice:       product.Price,
+			OfferPercentage: product.DiscountPercentage,
+			FlashSale:       flashSales[product.ID],
+		}
+		pricing := models.PriceCart([]models.PricingLine{line}, models.PricingCustomer{}, promotions, now)
+		if pricing.Lines[0].FlashSaleUnits > 0 {
+			product.FlashSale = line.FlashSale
+		}
+		product.FinalPrice = pricing.Total
+		if applied := pricing.Lines[0].Promotions; len(applied) > 0 {
+			product.Promotions = applied
+		}
+	}
+	return nil
+}
+
+func ViewProducts(c *fiber.Ctx) error {
+	products, err := fetchProductViews("")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch products",
+		})
+	}
 
 	return c.JSON(fiber.Map{
 		"message":  "Products fetched successfully",
@@ -70,8 +166,22 @@ func ViewProducts(c *fiber.Ctx) error {
 	})
 }
 
+func ProductImages(c *fiber.Ctx) error {
+	productID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	images, err := models.FetchProductImages(productID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch product images"})
+	}
+
+	return c.JSON(fiber.Map{"images": images})
+}
+
 func ViewCategories(c *fiber.Ctx) error {
-	query := `SELECT  name, description FROM categories WHERE deleted=false`
+	query := `SELECT id, parent_id, name, COALESCE(description, ''), COALESCE(slug, ''), sort_order, COALESCE(image_url, '') FROM categories WHERE deleted=false ORDER BY sort_order, name`
 	rows, err := config.DB.Query(query)
 	if err != nil {
 		fmt.Println(err)
@@ -82,7 +192,7 @@ func ViewCategories(c *fiber.Ctx) error {
 	var categories []responsemodels.ViewCategory
 	for rows.Next() {
 		var category responsemodels.ViewCategory
-		if err := rows.Scan(&category.Name, &category.Description); err != nil {
+		if err := rows.Scan(&category.ID, &category.ParentID, &category.Name, &category.Description, &category.Slug, &category.SortOrder, &category.ImageURL); err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to parse categories"})
 		}
 
@@ -106,14 +216,43 @@ func SearchProducts(c *fiber.Ctx) error {
 		orderBy = "ORDER BY name ASC"
 	case "name_desc":
 		orderBy = "ORDER BY name DESC"
+	case "rating_desc":
+		orderBy = "ORDER BY avg_rating DESC, rating_count DESC"
+	case "rating_asc":
+		orderBy = "ORDER BY avg_rating ASC, rating_count DESC"
 	default:
 		orderBy = "ORDER BY price ASC" // Default sorting: price low to high
 	}
 
-	// Fetch products based on the sorting criteria
-	query := `SELECT id, name, description, price, category_id, stock, deleted FROM products WHERE deleted = false ` + orderBy
+	filters, args, msg := attributeFilters(c, nil)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
 
-	rows, err := config.DB.Query(query)
+	// Brand facets count matches under every other filter, so picking one
+	// brand still shows how many products the other brands have.
+	brands, err := brandFacets(filters, args)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch brand facets"})
+	}
+
+	if brandParam := c.Query("brand_id"); brandParam != "" {
+		var brandIDs []int64
+		for _, part := range strings.Split(brandParam, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "brand_id must be a comma-separated list of ids"})
+			}
+			brandIDs = append(brandIDs, id)
+		}
+		args = append(args, pq.Array(brandIDs))
+		filters += fmt.Sprintf(" AND brand_id = ANY($%d)", len(args))
+	}
+
+	// Fetch products based on the filters and sorting criteria
+	query := `SELECT id, name, description, price, category_id, brand_id, stock, deleted, avg_rating, rating_count FROM products WHERE deleted = false ` + filters + " " + orderBy
+
+	rows, err := config.DB.Query(query, args...)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch products"})
 	}
@@ -122,7 +261,7 @@ func SearchProducts(c *fiber.Ctx) error {
 	var products []models.Product
 	for rows.Next() {
 		var product models.Product
-		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryID, &product.Stock, &product.Deleted); err != nil {
+		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryID, &product.BrandID, &product.Stock, &product.Deleted, &product.AvgRating, &product.RatingCount); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to scan product"})
 		}
 		products = append(products, product)
@@ -131,5 +270,25 @@ func SearchProducts(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"message":  "Products fetched successfully",
 		"products": products,
+		"facets":   fiber.Map{"brands": brands},
 	})
 }
+
+type brandFacet struct {
+	ID    int    `json:"id" db:"id"`
+	Name  string `json:"name" db:"name"`
+	Count int    `json:"count" db:"count"`
+}
+
+func brandFacets(filters string, args []interface{}) ([]brandFacet, error) {
+	facets := []brandFacet{}
+	query := `
+		SELECT b.id, b.name, COUNT(*) AS count
+		FROM products
+		JOIN brands b ON products.brand_id = b.id AND b.deleted = false
+		WHERE products.deleted = false ` + filters + `
+		GROUP BY b.id, b.name
+		ORDER BY count DESC, b.name`
+	err := config.DB.Select(&facets, query, args...)
+	return facets, err
+}
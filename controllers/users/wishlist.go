@@ -4,6 +4,7 @@ import (
 	"horizon/config"
 	"horizon/models"
 	responsemodels "horizon/models/responsemodels"
+	"horizon/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -58,10 +59,12 @@ func ViewWishlist(c *fiber.Ctx) error {
 	var wishlist []responsemodels.ViewProducts
 
 	query := `SELECT p.id, p.name, p.description, p.price, c.name AS category_name, 
-              CASE WHEN p.stock > 0 THEN 'Available' ELSE 'Out of Stock' END AS status
+              CASE WHEN p.stock > 0 THEN 'Available' ELSE 'Out of Stock' END AS status,
+              COALESCE(pi.thumbnail_key, '')
               FROM wishlists w
               JOIN products p ON w.product_id = p.id
               JOIN categories c ON p.category_id = c.id
+              LEFT JOIN product_images pi ON pi.product_id = p.id AND pi.is_primary
               WHERE w.user_id=$1`
 	rows, err := config.DB.Query(query, userID)
 	if err != nil {
@@ -71,9 +74,11 @@ func ViewWishlist(c *fiber.Ctx) error {
 
 	for rows.Next() {
 		var product responsemodels.ViewProducts
-		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryName, &product.Status); err != nil {
+		var thumbnailKey string
+		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryName, &product.Status, &thumbnailKey); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to scan product"})
 		}
+		product.ThumbnailURL = utils.Storage().URL(thumbnailKey)
 		wishlist = append(wishlist, product)
 	}
 
@@ -0,0 +1,200 @@
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
+	"log"
+	"strings"
+	"time"
+)
+
+// dueReminder is an abandoned cart claimed for its next reminder.
+type dueReminder struct {
+	ID            int           `db:"id"`
+	UserID        int           `db:"user_id"`
+	RemindersSent int           `db:"reminders_sent"`
+	CouponID      sql.NullInt64 `db:"coupon_id"`
+}
+
+// ProcessAbandonedCarts closes abandoned carts that were emptied or have run
+// out of reminders, picks up carts of verified customers that have gone idle
+// and sends the reminders that are due.
+func ProcessAbandonedCarts() error {
+	settings, err := models.LoadCartRecoverySettings(config.DB)
+	if err != nil {
+		return err
+	}
+	if !settings.Active {
+		return nil
+	}
+
+	// An emptied cart waiting on a PayPal payment stays open so the payment
+	// can still recover it.
+	closeQuery := `
+		UPDATE abandoned_carts a
+		SET status = 'Lost', closed_at = NOW()
+		WHERE a.status = 'Open' AND (
+			(NOT EXISTS (SELECT 1 FROM cart c WHERE c.user_id = a.user_id)
+			 AND NOT EXISTS (
+				SELECT 1 FROM orders o
+				WHERE o.user_id = a.user_id AND o.payment_method = 'paypal' AND o.payment_status = 'Processing'
+				  AND o.status NOT IN ('Cancelled', 'Returned') AND o.order_date >= a.detected_at
+				  AND o.order_date > NOW() - make_interval(days => $2)
+			 ))
+			OR (a.reminders_sent >= $1 AND COALESCE(a.last_reminded_at, a.detected_at) < NOW() - make_interval(days => $2))
+		)`
+	if _, err := config.DB.Exec(closeQuery, settings.MaxReminders, settings.AttributionDays); err != nil {
+		return err
+	}
+
+	// A cart already detected at its current state is not picked up again
+	// until the customer changes it.
+	detectQuery := `
+		WITH carts AS (
+			SELECT c.user_id, MAX(c.updated_at) AS last_activity_at, SUM(c.quantity) AS item_count,
+			       SUM(c.quantity * p.price) AS cart_value
+			FROM cart c
+			JOIN users u ON u.id = c.user_id
+			JOIN products p ON p.id = c.product_id
+			WHERE u.verified AND NOT u.blocked
+			GROUP BY c.user_id
+		)
+		INSERT INTO abandoned_carts (user_id, last_activity_at, item_count, cart_value)
+		SELECT user_id, last_activity_at, item_count, cart_value
+		FROM carts
+		WHERE last_activity_at < NOW() - make_interval(hours => $1)
+		  AND NOT EXISTS (
+			SELECT 1 FROM abandoned_carts a
+			WHERE a.user_id = carts.user_id AND (a.status = 'Open' OR a.last_activity_at >= carts.last_activity_at)
+		  )
+		ON CONFLICT (user_id) WHERE status = 'Open' DO NOTHING`
+	if _, err := config.DB.Exec(detectQuery, settings.IdleHours); err != nil {
+		return err
+	}
+
+	// Claiming a reminder counts it before the email goes out, so a cart
+	// never gets more than max_reminders even if sending fails. Customers
+	// who have touched their cart since are left alone.
+	var due []dueReminder
+	claimQuery := `
+		WITH carts AS (
+			SELECT c.user_id, MAX(c.updated_at) AS last_activity_at, SUM(c.quantity) AS item_count,
+			       SUM(c.quantity * p.price) AS cart_value
+			FROM cart c
+			JOIN products p ON p.id = c.product_id
+			WHERE c.user_id IN (SELECT user_id FROM abandoned_carts WHERE status = 'Open')
+			GROUP BY c.user_id
+		), claimable AS (
+			SELECT id FROM abandoned_carts
+			WHERE status = 'Open' AND reminders_sent < $1
+			  AND (last_reminded_at IS NULL OR last_reminded_at <= NOW() - make_interval(hours => $2))
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE abandoned_carts a
+		SET reminders_sent = a.reminders_sent + 1, last_reminded_at = NOW(),
+		    item_count = carts.item_count, cart_value = carts.cart_value
+		FROM carts, claimable
+		WHERE a.id = claimable.id AND carts.user_id = a.user_id
+		  AND carts.last_activity_at < NOW() - make_interval(hours => $3)
+		RETURNING a.id, a.user_id, a.reminders_sent, a.coupon_id`
+	if err := config.DB.Select(&due, claimQuery, settings.MaxReminders, settings.ReminderIntervalHours, settings.IdleHours); err != nil {
+		return err
+	}
+
+	for _, reminder := range due {
+		if err := sendCartReminder(settings, reminder); err != nil {
+			log.Printf("Failed to send cart reminder %d: %v", reminder.ID, err)
+		}
+	}
+	return nil
+}
+
+func sendCartReminder(settings models.CartRecoverySettings, reminder dueReminder) error {
+	var name, email string
+	if err := config.DB.QueryRow(`SELECT name, email FROM users WHERE id = $1`, reminder.UserID).Scan(&name, &email); err != nil {
+		return err
+	}
+
+	var items []struct {
+		Name     string `db:"name"`
+		Quantity int    `db:"quantity"`
+	}
+	itemsQuery := `
+		SELECT p.name, c.quantity FROM cart c JOIN products p ON p.id = c.product_id
+		WHERE c.user_id = $1 ORDER BY c.updated_at DESC`
+	if err := config.DB.Select(&items, itemsQuery, reminder.UserID); err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\nYou left these in your cart:\n\n", name)
+	for _, item := range items {
+		fmt.Fprintf(&body, "  - %s x %d\n", item.Name, item.Quantity)
+	}
+	fmt.Fprintf(&body, "\nPick up where you left off: %s/cart\n", config.AppBaseURL())
+
+	// The coupon goes out with the first reminder; later reminders repeat
+	// it while it is still valid.
+	var code string
+	var percentage, maxDiscount float64
+	var expires time.Time
+	var err error
+	switch {
+	case reminder.CouponID.Valid:
+		err = config.DB.QueryRow(`SELECT code, discount_percentage, max_discount_amount, end_date FROM coupons WHERE id = $1 AND end_date > NOW() AND used_count < usage_limit`,
+			reminder.CouponID.Int64).Scan(&code, &percentage, &maxDiscount, &expires)
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+	case settings.CouponEnabled && reminder.RemindersSent == 1:
+		code, err = issueRecoveryCoupon(settings, reminder)
+		percentage, maxDiscount = settings.CouponPercentage, settings.CouponMaxDiscount
+		expires = time.Now().Add(time.Duration(settings.CouponValidityHours) * time.Hour)
+	}
+	if err != nil {
+		return err
+	}
+	if code != "" {
+		fmt.Fprintf(&body, "\nUse code %s at checkout for %.0f%% off (up to %.2f), valid until %s.\n",
+			code, percentage, maxDiscount, expires.Format("02 Jan 2006 15:04"))
+	}
+
+	return utils.SendEmail(email, "You left something in your cart", body.String())
+}
+
+// issueRecoveryCoupon creates a single-use coupon only the cart's owner can
+// redeem and attaches it to the abandoned cart.
+func issueRecoveryCoupon(settings models.CartRecoverySettings, reminder dueReminder) (string, error) {
+	code, err := utils.GenerateCouponCode("CART", 8)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var couponID int
+	query := `
+		INSERT INTO coupons (code, discount_percentage, max_discount_amount, min_order_amount, start_date, end_date, usage_limit, per_user_limit)
+		VALUES ($1, $2, $3, 0, NOW(), NOW() + make_interval(hours => $4), 1, 1)
+		RETURNING id`
+	if err := tx.QueryRow(query, code, settings.CouponPercentage, settings.CouponMaxDiscount, settings.CouponValidityHours).Scan(&couponID); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`INSERT INTO coupon_users (coupon_id, user_id) VALUES ($1, $2)`, couponID, reminder.UserID); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`UPDATE abandoned_carts SET coupon_id = $1 WHERE id = $2`, couponID, reminder.ID); err != nil {
+		return "", err
+	}
+	return code, tx.Commit()
+}
@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"horizon/config"
+	"horizon/models"
+	"horizon/utils"
+	"log"
+)
+
+// CancelAbandonedOrders cancels PayPal orders left unpaid for longer than
+// PayPal keeps a checkout open, giving back their stock, flash sale units,
+// coupons and points the way a customer's cancellation does.
+func CancelAbandonedOrders() error {
+	var orderIDs []int
+	query := `
+		SELECT id FROM orders
+		WHERE payment_method = 'paypal' AND payment_status = 'Processing' AND status = 'Pending'
+		  AND order_date < NOW() - INTERVAL '6 hours'
+		ORDER BY id`
+	if err := config.DB.Select(&orderIDs, query); err != nil {
+		return err
+	}
+
+	for _, orderID := range orderIDs {
+		if err := cancelAbandonedOrder(orderID); err != nil {
+			log.Printf("Failed to cancel abandoned order %d: %v", orderID, err)
+		}
+	}
+	return nil
+}
+
+func cancelAbandonedOrder(orderID int) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	productIDs, cancelled, err := models.CancelUnpaidOrder(tx, orderID)
+	if err != nil || !cancelled {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	utils.StockChanged(productIDs...)
+	return nil
+}
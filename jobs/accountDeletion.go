@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"fmt"
+	"horizon/config"
+	queries "horizon/sql"
+	"log"
+	"strconv"
+)
+
+// ProcessAccountDeletions anonymizes accounts whose deletion grace period has
+// ended. Orders keep their amounts for accounting but lose the delivery
+// address, and the user row is kept so order foreign keys stay valid.
+// Accounts with orders still on their way wait until those are finished, so
+// they can be delivered. The wallet balance stays on the user row and shows
+// on the admin deletion requests to be refunded.
+func ProcessAccountDeletions() error {
+	var userIDs []int
+	query := `
+		SELECT user_id FROM account_deletion_requests
+		WHERE status = 'Pending' AND scheduled_for <= NOW()
+	`
+	if err := config.DB.Select(&userIDs, query); err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if err := anonymizeUser(userID); err != nil {
+			log.Printf("Failed to delete account %d: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+func anonymizeUser(userID int) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var email string
+	lockQuery := `
+		SELECT u.email FROM account_deletion_requests r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.user_id = $1 AND r.status = 'Pending' AND r.scheduled_for <= NOW()
+		FOR UPDATE OF r SKIP LOCKED
+	`
+	if err := tx.QueryRow(lockQuery, userID).Scan(&email); err != nil {
+		// Cancelled in the meantime or claimed by another instance.
+		return nil
+	}
+
+	var inFlight int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM orders o WHERE o.user_id = $1 AND `+queries.OrderInFlightCondition, userID).Scan(&inFlight); err != nil {
+		return err
+	}
+	if inFlight > 0 {
+		return nil
+	}
+
+	var walletBalance float64
+	if err := tx.QueryRow(`SELECT COALESCE(wallet_balance, 0) FROM users WHERE id = $1`, userID).Scan(&walletBalance); err != nil {
+		return err
+	}
+	if walletBalance > 0 {
+		log.Printf("Deleting account %d with wallet balance %.2f to refund", userID, walletBalance)
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE users SET name = 'Deleted User', email = $2, phone = NULL, password = NULL,
+			verified = false, blocked = true, updated_at = NOW() WHERE id = $1`,
+			[]interface{}{userID, fmt.Sprintf("deleted-%d@deleted.invalid", userID)}},
+		{`UPDATE orders o SET address_line = 'REDACTED', city = 'REDACTED', zip_code = 'REDACTED'
+			WHERE o.user_id = $1 AND NOT (` + queries.OrderInFlightCondition + `)`, []interface{}{userID}},
+		{`DELETE FROM addresses WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM wishlists WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM stock_subscriptions WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM coupon_users WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM user_devices WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM cart WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM user_identities WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM otp_codes WHERE email = $1`, []interface{}{email}},
+		{`DELETE FROM login_lockouts WHERE lock_key IN ('user:' || LOWER($1), 'otp:' || LOWER($1))`, []interface{}{email}},
+		{`DELETE FROM login_lockouts WHERE lock_key = 'google_link:' || $1`, []interface{}{strconv.Itoa(userID)}},
+		{`UPDATE account_deletion_requests SET status = 'Completed', completed_at = NOW(), reason = NULL WHERE user_id = $1`, []interface{}{userID}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"horizon/config"
+	"horizon/utils"
+	"log"
+)
+
+// productImageRetention is how long images of a soft-deleted product are kept
+// so that recovering the product brings them back.
+const productImageRetention = "30 days"
+
+// CleanupOrphanedFiles queues the images of products that have stayed deleted
+// past the retention period, then removes queued files from storage.
+func CleanupOrphanedFiles() error {
+	orphanQuery := `
+		WITH orphaned AS (
+			DELETE FROM product_images pi
+			USING products p
+			WHERE pi.product_id = p.id AND p.deleted AND p.deleted_at < NOW() - INTERVAL '` + productImageRetention + `'
+			RETURNING pi.original_key, pi.medium_key, pi.thumbnail_key
+		)
+		INSERT INTO file_deletions (file_key)
+		SELECT unnest(ARRAY[original_key, medium_key, thumbnail_key]) FROM orphaned
+	`
+	if _, err := config.DB.Exec(orphanQuery); err != nil {
+		return err
+	}
+
+	tx, err := config.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var pending []struct {
+		ID  int    `db:"id"`
+		Key string `db:"file_key"`
+	}
+	batchQuery := `SELECT id, file_key FROM file_deletions ORDER BY id LIMIT 500 FOR UPDATE SKIP LOCKED`
+	if err := tx.Select(&pending, batchQuery); err != nil {
+		return err
+	}
+
+	store := utils.Storage()
+	for _, file := range pending {
+		if err := store.Delete(file.Key); err != nil {
+			log.Printf("Failed to delete file %s: %v", file.Key, err)
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM file_deletions WHERE id = $1`, file.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,17 @@
+package jobs
+
+import "horizon/config"
+
+// PurgeGuestCarts deletes guest carts nobody has added to for 30 days. Their
+// tokens are signed for 30 days from the last add, so nobody can reach them
+// any more.
+func PurgeGuestCarts() error {
+	_, err := config.DB.Exec(`
+		DELETE FROM guest_cart_items
+		WHERE guest_id IN (
+			SELECT guest_id FROM guest_cart_items
+			GROUP BY guest_id
+			HAVING MAX(updated_at) < NOW() - INTERVAL '30 days'
+		)`)
+	return err
+}
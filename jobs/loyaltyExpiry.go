@@ -0,0 +1,26 @@
+package jobs
+
+import "horizon/config"
+
+// ExpireLoyaltyPoints writes off what is left of credits past their expiry
+// date, recording one expire entry per customer.
+func ExpireLoyaltyPoints() error {
+	query := `
+		WITH expired AS (
+			SELECT id, user_id, remaining
+			FROM loyalty_ledger
+			WHERE remaining > 0 AND expires_at <= NOW()
+			FOR UPDATE SKIP LOCKED
+		), cleared AS (
+			UPDATE loyalty_ledger l SET remaining = 0
+			FROM expired e
+			WHERE l.id = e.id
+		)
+		INSERT INTO loyalty_ledger (user_id, entry_type, points, note)
+		SELECT user_id, 'expire', -SUM(remaining), 'Points expired'
+		FROM expired
+		GROUP BY user_id
+	`
+	_, err := config.DB.Exec(query)
+	return err
+}
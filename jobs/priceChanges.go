@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"horizon/config"
+	"horizon/models"
+)
+
+// ApplyScheduledPrices applies every pending price change whose time has
+// come, oldest first, so the latest due change for a product wins.
+func ApplyScheduledPrices() error {
+	tx, err := config.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var due []models.ScheduledPriceChange
+	query := `
+		SELECT s.id, s.product_id, s.new_price, s.effective_at, s.status, s.created_at, s.applied_at
+		FROM scheduled_price_changes s
+		JOIN products p ON p.id = s.product_id
+		WHERE s.status = 'Pending' AND s.effective_at <= NOW() AND p.deleted = false
+		ORDER BY s.effective_at, s.id
+		FOR UPDATE OF s SKIP LOCKED
+	`
+	if err := tx.Select(&due, query); err != nil {
+		return err
+	}
+
+	for _, change := range due {
+		if _, err := tx.Exec(`UPDATE products SET price = $1, updated_at = NOW() WHERE id = $2`, change.NewPrice, change.ProductID); err != nil {
+			return err
+		}
+		effectiveAt := change.EffectiveAt
+		if err := models.RecordPrice(tx, change.ProductID, change.NewPrice, &effectiveAt, models.PriceSourceScheduled); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE scheduled_price_changes SET status = 'Applied', applied_at = NOW() WHERE id = $1`, change.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
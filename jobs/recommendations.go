@@ -0,0 +1,61 @@
+package jobs
+
+import "horizon/config"
+
+// cooccurrenceLockKey identifies the advisory lock that keeps instances from
+// rebuilding the co-occurrence table at the same time.
+const cooccurrenceLockKey = 36001
+
+// cooccurrencePerProduct caps how many companions are kept for each product.
+const cooccurrencePerProduct = 10
+
+// RefreshCooccurrence rebuilds the "frequently bought together" scores: for
+// every pair of products, the number of non-cancelled orders in the last
+// 180 days that contained both.
+func RefreshCooccurrence() error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1)`, cooccurrenceLockKey).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM product_cooccurrence`); err != nil {
+		return err
+	}
+
+	query := `
+		WITH recent AS (
+			SELECT DISTINCT oi.order_id, oi.product_id
+			FROM order_items oi
+			JOIN orders o ON o.id = oi.order_id
+			WHERE o.status NOT IN ('Cancelled', 'Canceled') AND o.order_date >= NOW() - INTERVAL '180 days'
+		),
+		pairs AS (
+			SELECT a.product_id, b.product_id AS related_product_id, COUNT(*) AS score
+			FROM recent a
+			JOIN recent b ON a.order_id = b.order_id AND a.product_id <> b.product_id
+			GROUP BY a.product_id, b.product_id
+		),
+		ranked AS (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY score DESC, related_product_id) AS rank
+			FROM pairs
+		)
+		INSERT INTO product_cooccurrence (product_id, related_product_id, score, updated_at)
+		SELECT product_id, related_product_id, score, NOW()
+		FROM ranked
+		WHERE rank <= $1
+	`
+	if _, err := tx.Exec(query, cooccurrencePerProduct); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"log"
+	"time"
+)
+
+// Start launches the periodic background jobs. Jobs lock the rows they work
+// on, so it is safe to run them on every instance.
+func Start() {
+	go runEvery("account deletions", time.Hour, ProcessAccountDeletions)
+	go runEvery("orphaned file cleanup", 6*time.Hour, CleanupOrphanedFiles)
+	go runEvery("frequently bought together", 6*time.Hour, RefreshCooccurrence)
+	go runEvery("scheduled price changes", time.Minute, ApplyScheduledPrices)
+	go runEvery("loyalty point expiry", time.Hour, ExpireLoyaltyPoints)
+	go runEvery("abandoned carts", 15*time.Minute, ProcessAbandonedCarts)
+	go runEvery("guest cart purge", 6*time.Hour, PurgeGuestCarts)
+	go runEvery("abandoned orders", 15*time.Minute, CancelAbandonedOrders)
+}
+
+func runEvery(name string, interval time.Duration, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(); err != nil {
+			log.Printf("Job %s failed: %v", name, err)
+		}
+		<-ticker.C
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"os"
 
 	"horizon/config"
+	"horizon/jobs"
 	"horizon/routes"
+	"horizon/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -20,9 +22,14 @@ func main() {
 
 	config.InitDB()
 
-	app := fiber.New()
+	uploads := utils.NewLocalStorage()
+	utils.SetStorage(uploads)
+
+	// Product image uploads accept several files per request.
+	app := fiber.New(fiber.Config{BodyLimit: 25 << 20})
 
 	app.Static("/assets", "./portfolio/assets")
+	app.Static(uploads.BaseURL, uploads.Root)
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.SendFile("./portfolio/index.html")
 	})
@@ -30,7 +37,7 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
 		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Content-Type,Authorization",
+		AllowHeaders: "Content-Type,Authorization,X-Guest-Cart",
 	}))
 
 	routes.UserRoutes(app)
@@ -38,6 +45,8 @@ func main() {
 
 	config.InitGoogleOAuth()
 
+	jobs.Start()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
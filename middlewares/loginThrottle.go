@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"database/sql"
+	"fmt"
+	"horizon/config"
+	"horizon/utils"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ThrottleConfig wires LoginThrottle to one credential-checking endpoint.
+// Scope keeps counters for different endpoints apart, AccountKey extracts the
+// account being attempted (empty means throttle by IP only) and OnLockout is
+// called once when an account becomes locked.
+type ThrottleConfig struct {
+	Scope      string
+	AccountKey func(c *fiber.Ctx) string
+	OnLockout  func(account string)
+}
+
+// BodyField returns an AccountKey that reads a field from the request body.
+func BodyField(name string) func(c *fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		body := map[string]interface{}{}
+		if err := c.BodyParser(&body); err != nil {
+			return ""
+		}
+		value, _ := body[name].(string)
+		return value
+	}
+}
+
+// LoginThrottle rejects attempts while the account or client IP is backing
+// off. Every other attempt is counted as a failure before the handler runs,
+// so parallel attempts cannot slip past the limits; it is given back unless
+// the handler answers 401, and a success clears the account counter.
+func LoginThrottle(cfg ThrottleConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var account string
+		if cfg.AccountKey != nil {
+			account = strings.ToLower(strings.TrimSpace(cfg.AccountKey(c)))
+		}
+		ipKey := utils.LoginKey{Key: "ip:" + c.IP(), Policy: utils.IPLockoutPolicy}
+		keys := []utils.LoginKey{ipKey}
+		if account != "" {
+			keys = append(keys, utils.LoginKey{Key: cfg.Scope + ":" + account, Policy: utils.AccountLockoutPolicy})
+		}
+
+		wait, failures, err := utils.ReserveLoginAttempt(keys...)
+		if err != nil {
+			log.Printf("Failed to check login lockout: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to process request"})
+		}
+		if wait > 0 {
+			seconds := int(math.Ceil(wait.Seconds()))
+			c.Set(fiber.HeaderRetryAfter, fmt.Sprintf("%d", seconds))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":       "Too many failed attempts. Please try again later.",
+				"retry_after": seconds,
+			})
+		}
+
+		if err := c.Next(); err != nil {
+			releaseLoginAttempt(keys...)
+			return err
+		}
+
+		switch c.Response().StatusCode() {
+		case fiber.StatusUnauthorized:
+			if len(keys) > 1 && failures[1] == utils.AccountLockoutPolicy.MaxFailures && cfg.OnLockout != nil {
+				go cfg.OnLockout(account)
+			}
+		case fiber.StatusOK:
+			releaseLoginAttempt(ipKey)
+			if len(keys) > 1 {
+				if err := utils.ResetLoginFailures(keys[1].Key); err != nil {
+					log.Printf("Failed to reset login failures: %v", err)
+				}
+			}
+		default:
+			releaseLoginAttempt(keys...)
+		}
+
+		return nil
+	}
+}
+
+func releaseLoginAttempt(keys ...utils.LoginKey) {
+	for _, key := range keys {
+		if err := utils.ReleaseLoginAttempt(key); err != nil {
+			log.Printf("Failed to release login attempt: %v", err)
+		}
+	}
+}
+
+// NotifyAccountLocked emails a customer whose account was locked after
+// repeated failed sign-in attempts. Addresses that do not belong to an
+// account are ignored, so the lockout cannot be used to email strangers.
+func NotifyAccountLocked(email string) {
+	var registered string
+	err := config.DB.QueryRow(`SELECT email FROM users WHERE LOWER(email) = LOWER($1)`, email).Scan(&registered)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up locked account: %v", err)
+		return
+	}
+
+	body := fmt.Sprintf("We detected %d failed sign-in attempts on your Horizon account, so it has been locked for %d minutes. "+
+		"If this wasn't you, we recommend changing your password once the lock expires.",
+		utils.AccountLockoutPolicy.MaxFailures, int(utils.AccountLockoutPolicy.LockoutDuration.Minutes()))
+	if err := utils.SendEmail(registered, "Your Horizon account has been temporarily locked", body); err != nil {
+		log.Printf("Failed to send lockout email: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+const (
+	AbandonedCartOpen      = "Open"
+	AbandonedCartRecovered = "Recovered"
+	AbandonedCartLost      = "Lost"
+)
+
+type CartRecoverySettings struct {
+	Active                bool    `json:"active" db:"active"`
+	IdleHours             int     `json:"idle_hours" db:"idle_hours"`
+	MaxReminders          int     `json:"max_reminders" db:"max_reminders"`
+	ReminderIntervalHours int     `json:"reminder_interval_hours" db:"reminder_interval_hours"`
+	AttributionDays       int     `json:"attribution_days" db:"attribution_days"`
+	CouponEnabled         bool    `json:"coupon_enabled" db:"coupon_enabled"`
+	CouponPercentage      float64 `json:"coupon_percentage" db:"coupon_percentage"`
+	CouponMaxDiscount     float64 `json:"coupon_max_discount" db:"coupon_max_discount"`
+	CouponValidityHours   int     `json:"coupon_validity_hours" db:"coupon_validity_hours"`
+}
+
+// CartRecoverySettingsColumns is the column list, in order, that
+// ScanCartRecoverySettings reads.
+const CartRecoverySettingsColumns = `active, idle_hours, max_reminders, reminder_interval_hours, attribution_days,
+	coupon_enabled, coupon_percentage, coupon_max_discount, coupon_validity_hours`
+
+func LoadCartRecoverySettings(db Querier) (CartRecoverySettings, error) {
+	return ScanCartRecoverySettings(db.QueryRow(`SELECT ` + CartRecoverySettingsColumns + ` FROM cart_recovery_settings`))
+}
+
+// ScanCartRecoverySettings reads settings selected with
+// CartRecoverySettingsColumns.
+func ScanCartRecoverySettings(row rowScanner) (CartRecoverySettings, error) {
+	var s CartRecoverySettings
+	err := row.Scan(&s.Active, &s.IdleHours, &s.MaxReminders, &s.ReminderIntervalHours, &s.AttributionDays,
+		&s.CouponEnabled, &s.CouponPercentage, &s.CouponMaxDiscount, &s.CouponValidityHours)
+	return s, err
+}
+
+type AbandonedCart struct {
+	ID             int        `json:"id" db:"id"`
+	UserID         int        `json:"user_id" db:"user_id"`
+	Name           string     `json:"name" db:"name"`
+	Email          string     `json:"email" db:"email"`
+	Status         string     `json:"status" db:"status"`
+	ItemCount      int        `json:"item_count" db:"item_count"`
+	CartValue      float64    `json:"cart_value" db:"cart_value"`
+	RemindersSent  int        `json:"reminders_sent" db:"reminders_sent"`
+	LastActivityAt time.Time  `json:"last_activity_at" db:"last_activity_at"`
+	LastRemindedAt *time.Time `json:"last_reminded_at,omitempty" db:"last_reminded_at"`
+	CouponCode     *string    `json:"coupon_code,omitempty" db:"coupon_code"`
+	DetectedAt     time.Time  `json:"detected_at" db:"detected_at"`
+}
+
+// MarkCartRecovered credits a placed or paid order to the customer's open
+// abandoned cart, if they have one and were sent a reminder for it.
+func MarkCartRecovered(db Execer, userID, orderID int, value float64) error {
+	_, err := db.Exec(`
+		UPDATE abandoned_carts
+		SET status = 'Recovered', recovered_order_id = $2, recovered_value = $3, closed_at = NOW()
+		WHERE user_id = $1 AND status = 'Open' AND reminders_sent > 0`, userID, orderID, value)
+	return err
+}
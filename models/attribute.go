@@ -0,0 +1,78 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	AttributeText    = "text"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	AttributeEnum    = "enum"
+)
+
+type AttributeDefinition struct {
+	ID            int            `json:"id" db:"id"`
+	CategoryID    int            `json:"category_id" db:"category_id"`
+	Name          string         `json:"name" db:"name"`
+	Code          string         `json:"code" db:"code"`
+	DataType      string         `json:"data_type" db:"data_type"`
+	Unit          string         `json:"unit" db:"unit"`
+	AllowedValues pq.StringArray `json:"allowed_values" db:"allowed_values"`
+	Filterable    bool           `json:"filterable" db:"filterable"`
+	SortOrder     int            `json:"sort_order" db:"sort_order"`
+}
+
+type ProductSpec struct {
+	Name  string `json:"name" db:"name"`
+	Code  string `json:"code" db:"code"`
+	Value string `json:"value" db:"value"`
+	Unit  string `json:"unit,omitempty" db:"unit"`
+}
+
+// NormalizeValue checks a raw JSON value against the attribute's type and
+// returns it in its stored text form, plus the numeric form for numbers.
+func (a AttributeDefinition) NormalizeValue(raw interface{}) (string, *float64, error) {
+	var text string
+	switch v := raw.(type) {
+	case string:
+		text = strings.TrimSpace(v)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		text = strconv.FormatBool(v)
+	default:
+		return "", nil, fmt.Errorf("%s has an unsupported value", a.Name)
+	}
+	if text == "" {
+		return "", nil, fmt.Errorf("%s cannot be empty", a.Name)
+	}
+
+	switch a.DataType {
+	case AttributeNumber:
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s must be a number", a.Name)
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), &number, nil
+	case AttributeBoolean:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s must be true or false", a.Name)
+		}
+		return strconv.FormatBool(b), nil, nil
+	case AttributeEnum:
+		for _, allowed := range a.AllowedValues {
+			if strings.EqualFold(allowed, text) {
+				return allowed, nil, nil
+			}
+		}
+		return "", nil, fmt.Errorf("%s must be one of %s", a.Name, strings.Join(a.AllowedValues, ", "))
+	default:
+		return text, nil, nil
+	}
+}
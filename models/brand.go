@@ -0,0 +1,18 @@
+package models
+
+import "horizon/utils"
+
+type Brand struct {
+	ID          int    `json:"id" db:"id" form:"id"`
+	Name        string `json:"name" db:"name" form:"name"`
+	Slug        string `json:"slug" db:"slug" form:"slug"`
+	Description string `json:"description" db:"description" form:"description"`
+	LogoKey     string `json:"-" db:"logo_key"`
+	LogoURL     string `json:"logo_url,omitempty" db:"-"`
+	Deleted     bool   `json:"deleted" db:"deleted"`
+}
+
+// ResolveLogo fills LogoURL from the stored logo key.
+func (b *Brand) ResolveLogo() {
+	b.LogoURL = utils.Storage().URL(b.LogoKey)
+}
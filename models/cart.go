@@ -9,3 +9,108 @@ type CartItem struct {
 	Price     float64 `json:"price"`
 	Subtotal  float64 `json:"subtotal"`
 }
+
+// MaxQtyPerPerson is the most units of one product a cart may hold.
+const MaxQtyPerPerson = 10
+
+// Why a guest cart line was not merged in full.
+const (
+	CartAdjustedLimit       = "per_person_limit"
+	CartAdjustedStock       = "insufficient_stock"
+	CartAdjustedUnavailable = "unavailable"
+)
+
+// CartAdjustment is a guest cart line that was merged with fewer units than
+// the guest had, or not at all.
+type CartAdjustment struct {
+	ProductID int    `json:"product_id"`
+	Name      string `json:"name"`
+	Requested int    `json:"requested"`
+	Added     int    `json:"added"`
+	Reason    string `json:"reason"`
+}
+
+type CartMerge struct {
+	MergedItems int              `json:"merged_items"`
+	Adjustments []CartAdjustment `json:"adjustments"`
+}
+
+// MergeGuestCart moves a guest cart into a customer's cart. Lines the
+// customer already has are added together, and every line is held to
+// MaxQtyPerPerson and the stock available, as AddToCart would. The guest
+// cart is emptied in the same step, so it is merged only once.
+func MergeGuestCart(db Querier, guestID string, userID int) (CartMerge, error) {
+	merge := CartMerge{Adjustments: []CartAdjustment{}}
+
+	rows, err := db.Query(`DELETE FROM guest_cart_items WHERE guest_id = $1 RETURNING product_id, quantity`, guestID)
+	if err != nil {
+		return merge, err
+	}
+	type guestLine struct{ productID, quantity int }
+	var lines []guestLine
+	for rows.Next() {
+		var line guestLine
+		if err := rows.Scan(&line.productID, &line.quantity); err != nil {
+			rows.Close()
+			return merge, err
+		}
+		lines = append(lines, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return merge, err
+	}
+
+	for _, line := range lines {
+		var name string
+		var stock, current int
+		var deleted bool
+		query := `
+			SELECT p.name, p.stock, p.deleted, COALESCE(c.quantity, 0)
+			FROM products p
+			LEFT JOIN cart c ON c.product_id = p.id AND c.user_id = $2
+			WHERE p.id = $1`
+		if err := db.QueryRow(query, line.productID, userID).Scan(&name, &stock, &deleted, &current); err != nil {
+			return merge, err
+		}
+
+		added, reason := mergedQuantity(line.quantity, current, stock, deleted)
+		if reason != "" {
+			merge.Adjustments = append(merge.Adjustments, CartAdjustment{
+				ProductID: line.productID, Name: name, Requested: line.quantity, Added: added, Reason: reason,
+			})
+		}
+		if added == 0 {
+			continue
+		}
+
+		_, err := db.Exec(`
+			INSERT INTO cart (user_id, product_id, quantity)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, product_id)
+			DO UPDATE SET quantity = cart.quantity + $3, updated_at = NOW()`, userID, line.productID, added)
+		if err != nil {
+			return merge, err
+		}
+		merge.MergedItems++
+	}
+	return merge, nil
+}
+
+// mergedQuantity works out how many of the requested guest units can join a
+// cart line already holding current units, and why fewer were, if so.
+func mergedQuantity(requested, current, stock int, deleted bool) (int, string) {
+	added, reason := requested, ""
+	switch {
+	case deleted || stock <= 0:
+		added, reason = 0, CartAdjustedUnavailable
+	case current+added > MaxQtyPerPerson && MaxQtyPerPerson <= stock:
+		added, reason = MaxQtyPerPerson-current, CartAdjustedLimit
+	case current+added > stock:
+		added, reason = stock-current, CartAdjustedStock
+	}
+	if added < 0 {
+		added = 0
+	}
+	return added, reason
+}
@@ -0,0 +1,33 @@
+package models
+
+import "testing"
+
+func TestMergedQuantity(t *testing.T) {
+	tests := []struct {
+		name       string
+		requested  int
+		current    int
+		stock      int
+		deleted    bool
+		wantAdded  int
+		wantReason string
+	}{
+		{"fits", 3, 2, 20, false, 3, ""},
+		{"new line", 4, 0, 4, false, 4, ""},
+		{"deleted product", 2, 0, 20, true, 0, CartAdjustedUnavailable},
+		{"out of stock", 2, 1, 0, false, 0, CartAdjustedUnavailable},
+		{"over the per person limit", 6, 6, 50, false, MaxQtyPerPerson - 6, CartAdjustedLimit},
+		{"already at the per person limit", 2, MaxQtyPerPerson, 50, false, 0, CartAdjustedLimit},
+		{"over the stock", 5, 1, 4, false, 3, CartAdjustedStock},
+		{"stock below the limit wins", 8, 4, 7, false, 3, CartAdjustedStock},
+		{"cart already holds more than the stock", 2, 5, 3, false, 0, CartAdjustedStock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, reason := mergedQuantity(tt.requested, tt.current, tt.stock, tt.deleted)
+			if added != tt.wantAdded || reason != tt.wantReason {
+				t.Errorf("mergedQuantity() = %d, %q, want %d, %q", added, reason, tt.wantAdded, tt.wantReason)
+			}
+		})
+	}
+}
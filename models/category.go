@@ -4,5 +4,9 @@ type Category struct {
 	ID          int    `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	ParentID    *int   `json:"parent_id"`
+	Slug        string `json:"slug"`
+	SortOrder   int    `json:"sort_order"`
+	ImageURL    string `json:"image_url"`
 	Deleted     bool   `json:"deleted"`
 }
@@ -1,15 +1,264 @@
 package models
 
+import (
+	"errors"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+const (
+	CouponRedeemed   = "Redeemed"
+	CouponRolledBack = "Rolled Back"
+)
+
+var (
+	ErrCouponUsedUp    = errors.New("coupon usage limit reached")
+	ErrCouponUserLimit = errors.New("coupon already used the maximum number of times by this customer")
+)
+
+// Coupon is a discount code. Beyond the global usage_limit, PerUserLimit caps
+// redemptions per customer and the targeting fields restrict who may use it:
+// UserIDs and Segments (either matching is enough when both are set),
+// FirstOrderOnly, and CategoryIDs, which also limits the discount to those
+// categories' items. Codes generated in bulk carry their BatchID.
 type Coupon struct {
-	ID                 int     `json:"id"`
-	Code               string  `json:"code"`
-	DiscountPercentage float64 `json:"discount_percentage"`
-	MaxDiscountAmount  float64 `json:"max_discount_amount"`
-	MinOrderAmount     float64 `json:"min_order_amount"`
-	StartDate          string  `json:"start_date"`
-	EndDate            string  `json:"end_date"`
-	UsageLimit         int     `json:"usage_limit"`
-	UsedCount          int     `json:"used_count"`
-	CreatedAt          string  `json:"created_at"`
-	UpdatedAt          string  `json:"updated_at"`
+	ID                 int      `json:"id"`
+	Code               string   `json:"code"`
+	DiscountPercentage float64  `json:"discount_percentage"`
+	MaxDiscountAmount  float64  `json:"max_discount_amount"`
+	MinOrderAmount     float64  `json:"min_order_amount"`
+	StartDate          string   `json:"start_date"`
+	EndDate            string   `json:"end_date"`
+	UsageLimit         int      `json:"usage_limit"`
+	UsedCount          int      `json:"used_count"`
+	CreatedAt          string   `json:"created_at"`
+	UpdatedAt          string   `json:"updated_at"`
+	PerUserLimit       *int     `json:"per_user_limit"`
+	FirstOrderOnly     bool     `json:"first_order_only"`
+	Segments           []string `json:"segments"`
+	CategoryIDs        []int64  `json:"category_ids"`
+	UserIDs            []int64  `json:"user_ids,omitempty"`
+	BatchID            *int     `json:"batch_id,omitempty"`
+}
+
+// CouponColumns is the column list ScanCoupon expects, selected from coupons.
+const CouponColumns = `id, code, discount_percentage, max_discount_amount, min_order_amount, start_date, end_date,
+	usage_limit, used_count, created_at, updated_at, per_user_limit, first_order_only, segments, category_ids, batch_id,
+	ARRAY(SELECT cu.user_id FROM coupon_users cu WHERE cu.coupon_id = coupons.id ORDER BY cu.user_id)`
+
+// ScanCoupon reads a coupon selected with CouponColumns.
+func ScanCoupon(row rowScanner) (Coupon, error) {
+	var coupon Coupon
+	err := row.Scan(&coupon.ID, &coupon.Code, &coupon.DiscountPercentage, &coupon.MaxDiscountAmount, &coupon.MinOrderAmount,
+		&coupon.StartDate, &coupon.EndDate, &coupon.UsageLimit, &coupon.UsedCount, &coupon.CreatedAt, &coupon.UpdatedAt,
+		&coupon.PerUserLimit, &coupon.FirstOrderOnly, pq.Array(&coupon.Segments), pq.Array(&coupon.CategoryIDs), &coupon.BatchID,
+		pq.Array(&coupon.UserIDs))
+	return coupon, err
+}
+
+// LoadLiveCoupon looks up a coupon by code if it is running now.
+func LoadLiveCoupon(db Querier, code string) (Coupon, error) {
+	query := `SELECT ` + CouponColumns + ` FROM coupons WHERE code = $1 AND CURRENT_TIMESTAMP BETWEEN start_date AND end_date`
+	return ScanCoupon(db.QueryRow(query, code))
+}
+
+// EvaluateCoupon works out what a coupon takes off a priced cart for a
+// customer. The discount is a percentage of the eligible items' price before
+// offers and promotions, capped at MaxDiscountAmount. When the customer
+// cannot use the coupon it returns the reason instead.
+func EvaluateCoupon(db Querier, coupon Coupon, userID int, pricing CartPricing, customer PricingCustomer) (float64, string, error) {
+	if coupon.UsedCount >= coupon.UsageLimit {
+		return 0, "Coupon usage limit reached", nil
+	}
+
+	targeted := len(coupon.UserIDs) > 0 || len(coupon.Segments) > 0
+	if targeted && !containsInt64(coupon.UserIDs, int64(userID)) && !sharesSegment(coupon.Segments, customer.Segments) {
+		return 0, "This coupon is not available for your account", nil
+	}
+	if coupon.FirstOrderOnly && !customer.FirstOrder {
+		return 0, "This coupon is only valid on your first order", nil
+	}
+
+	if coupon.PerUserLimit != nil {
+		used, err := CouponRedemptionsByUser(db, coupon.ID, userID)
+		if err != nil {
+			return 0, "", err
+		}
+		if used >= *coupon.PerUserLimit {
+			return 0, "You have already used this coupon the maximum number of times", nil
+		}
+	}
+
+	var eligible float64
+	for _, line := range pricing.Lines {
+		if couponCoversLine(coupon, line.PricingLine) {
+			eligible += line.Subtotal
+		}
+	}
+	if eligible == 0 {
+		return 0, "No items in your cart are eligible for this coupon", nil
+	}
+	if eligible < coupon.MinOrderAmount {
+		return 0, "Order total does not meet the minimum amount required for this coupon", nil
+	}
+
+	discount := eligible * coupon.DiscountPercentage / 100
+	if discount > coupon.MaxDiscountAmount {
+		discount = coupon.MaxDiscountAmount
+	}
+	return roundMoney(discount), "", nil
+}
+
+func couponCoversLine(coupon Coupon, line PricingLine) bool {
+	if len(coupon.CategoryIDs) == 0 {
+		return true
+	}
+	for _, id := range line.CategoryIDs {
+		if containsInt64(coupon.CategoryIDs, int64(id)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CouponRedemptionsByUser counts a customer's standing redemptions of a coupon.
+func CouponRedemptionsByUser(db Querier, couponID, userID int) (int, error) {
+	var used int
+	query := `SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = $1 AND user_id = $2 AND status = 'Redeemed'`
+	err := db.QueryRow(query, couponID, userID).Scan(&used)
+	return used, err
+}
+
+// RedeemCoupon records a coupon's use on an order. It takes the coupon row
+// first, so concurrent checkouts cannot both slip under the global or the
+// per-customer limit.
+func RedeemCoupon(db Querier, coupon Coupon, userID, orderID int, discount float64) error {
+	result, err := db.Exec(`UPDATE coupons SET used_count = used_count + 1 WHERE id = $1 AND used_count < usage_limit`, coupon.ID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrCouponUsedUp
+	}
+
+	if coupon.PerUserLimit != nil {
+		used, err := CouponRedemptionsByUser(db, coupon.ID, userID)
+		if err != nil {
+			return err
+		}
+		if used >= *coupon.PerUserLimit {
+			return ErrCouponUserLimit
+		}
+	}
+
+	_, err = db.Exec(`INSERT INTO coupon_redemptions (coupon_id, user_id, order_id, discount) VALUES ($1, $2, $3, $4)`,
+		coupon.ID, userID, orderID, discount)
+	return err
+}
+
+// RollbackOrderCoupons releases the coupons redeemed on a cancelled order so
+// they count neither against the coupon's usage limit nor the customer's.
+func RollbackOrderCoupons(db Execer, orderID int) error {
+	_, err := db.Exec(`
+		WITH released AS (
+			UPDATE coupon_redemptions
+			SET status = 'Rolled Back', rolled_back_at = NOW()
+			WHERE order_id = $1 AND status = 'Redeemed'
+			RETURNING coupon_id
+		)
+		UPDATE coupons c
+		SET used_count = GREATEST(c.used_count - r.released, 0)
+		FROM (SELECT coupon_id, COUNT(*) AS released FROM released GROUP BY coupon_id) r
+		WHERE c.id = r.coupon_id`, orderID)
+	return err
+}
+
+func containsInt64(values []int64, v int64) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func sharesSegment(wanted, segments []string) bool {
+	for _, w := range wanted {
+		for _, segment := range segments {
+			if w == segment {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LoadCouponsOpenTo returns the coupons a customer may see: not single-use
+// batch codes, and not coupons reserved for other customers. With liveOnly,
+// coupons that have not started yet are left out too.
+func LoadCouponsOpenTo(db Querier, userID int, liveOnly bool) ([]Coupon, error) {
+	query := `
+		SELECT ` + CouponColumns + `
+		FROM coupons
+		WHERE end_date >= NOW() AND (start_date <= NOW() OR NOT $2) AND batch_id IS NULL
+		  AND (NOT EXISTS (SELECT 1 FROM coupon_users cu WHERE cu.coupon_id = coupons.id)
+		       OR EXISTS (SELECT 1 FROM coupon_users cu WHERE cu.coupon_id = coupons.id AND cu.user_id = $1))
+		ORDER BY id`
+	rows, err := db.Query(query, userID, liveOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var coupons []Coupon
+	for rows.Next() {
+		coupon, err := ScanCoupon(rows)
+		if err != nil {
+			return nil, err
+		}
+		coupon.UserIDs = nil
+		coupons = append(coupons, coupon)
+	}
+	return coupons, rows.Err()
+}
+
+// CouponEvaluation is a coupon checked against a customer's cart: what it
+// would save, or why it cannot be used.
+type CouponEvaluation struct {
+	Coupon   Coupon  `json:"coupon"`
+	Eligible bool    `json:"eligible"`
+	Savings  float64 `json:"savings"`
+	Reason   string  `json:"reason,omitempty"`
+}
+
+// RankCoupons evaluates every running coupon open to the customer against
+// their priced cart. Usable coupons come first, largest saving first.
+func RankCoupons(db Querier, userID int, pricing CartPricing, customer PricingCustomer) ([]CouponEvaluation, error) {
+	coupons, err := LoadCouponsOpenTo(db, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluations := make([]CouponEvaluation, 0, len(coupons))
+	for _, coupon := range coupons {
+		savings, reason, err := EvaluateCoupon(db, coupon, userID, pricing, customer)
+		if err != nil {
+			return nil, err
+		}
+		evaluations = append(evaluations, CouponEvaluation{Coupon: coupon, Eligible: reason == "", Savings: savings, Reason: reason})
+	}
+	sortCouponEvaluations(evaluations)
+	return evaluations, nil
+}
+
+// sortCouponEvaluations puts usable coupons first, largest saving first,
+// keeping the load order among equals.
+func sortCouponEvaluations(evaluations []CouponEvaluation) {
+	sort.SliceStable(evaluations, func(i, j int) bool {
+		if evaluations[i].Eligible != evaluations[j].Eligible {
+			return evaluations[i].Eligible
+		}
+		return evaluations[i].Savings > evaluations[j].Savings
+	})
 }
@@ -0,0 +1,93 @@
+package models
+
+import "testing"
+
+func TestEvaluateCoupon(t *testing.T) {
+	pricing := CartPricing{Lines: []PricedLine{
+		{PricingLine: PricingLine{ProductID: 1, CategoryIDs: []int{4, 1}}, Subtotal: 600},
+		{PricingLine: PricingLine{ProductID: 2, CategoryIDs: []int{2}}, Subtotal: 400},
+	}}
+	coupon := func(c Coupon) Coupon {
+		c.ID, c.Code = 1, "SAVE"
+		if c.UsageLimit == 0 {
+			c.UsageLimit = 10
+		}
+		if c.DiscountPercentage == 0 {
+			c.DiscountPercentage = 10
+		}
+		if c.MaxDiscountAmount == 0 {
+			c.MaxDiscountAmount = 1000
+		}
+		return c
+	}
+
+	// Coupons without a per-customer limit never reach the database.
+	tests := []struct {
+		name        string
+		coupon      Coupon
+		userID      int
+		customer    PricingCustomer
+		wantSavings float64
+		wantReason  string
+	}{
+		{"whole cart", coupon(Coupon{}), 5, PricingCustomer{}, 100, ""},
+		{"capped at the maximum discount", coupon(Coupon{MaxDiscountAmount: 50}), 5, PricingCustomer{}, 50, ""},
+		{"usage limit reached", coupon(Coupon{UsageLimit: 3, UsedCount: 3}), 5, PricingCustomer{}, 0, "Coupon usage limit reached"},
+		{"reserved for the customer", coupon(Coupon{UserIDs: []int64{5}}), 5, PricingCustomer{}, 100, ""},
+		{"reserved for someone else", coupon(Coupon{UserIDs: []int64{6}}), 5, PricingCustomer{},
+			0, "This coupon is not available for your account"},
+		{"segment matches when the user is not listed", coupon(Coupon{UserIDs: []int64{6}, Segments: []string{SegmentVIP}}), 5,
+			PricingCustomer{Segments: []string{SegmentReturning, SegmentVIP}}, 100, ""},
+		{"segment does not match", coupon(Coupon{Segments: []string{SegmentNew}}), 5, PricingCustomer{Segments: []string{SegmentReturning}},
+			0, "This coupon is not available for your account"},
+		{"first order only on a repeat order", coupon(Coupon{FirstOrderOnly: true}), 5, PricingCustomer{},
+			0, "This coupon is only valid on your first order"},
+		{"first order only on a first order", coupon(Coupon{FirstOrderOnly: true}), 5, PricingCustomer{FirstOrder: true}, 100, ""},
+		{"category limits the discount to its items", coupon(Coupon{CategoryIDs: []int64{1}}), 5, PricingCustomer{}, 60, ""},
+		{"no items in the category", coupon(Coupon{CategoryIDs: []int64{9}}), 5, PricingCustomer{},
+			0, "No items in your cart are eligible for this coupon"},
+		{"minimum counts only eligible items", coupon(Coupon{CategoryIDs: []int64{2}, MinOrderAmount: 500}), 5, PricingCustomer{},
+			0, "Order total does not meet the minimum amount required for this coupon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			savings, reason, err := EvaluateCoupon(nil, tt.coupon, tt.userID, pricing, tt.customer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if savings != tt.wantSavings || reason != tt.wantReason {
+				t.Errorf("EvaluateCoupon() = %v, %q, want %v, %q", savings, reason, tt.wantSavings, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestSortCouponEvaluations(t *testing.T) {
+	evaluation := func(id int, eligible bool, savings float64) CouponEvaluation {
+		return CouponEvaluation{Coupon: Coupon{ID: id}, Eligible: eligible, Savings: savings}
+	}
+
+	tests := []struct {
+		name        string
+		evaluations []CouponEvaluation
+		want        []int
+	}{
+		{"largest saving first", []CouponEvaluation{evaluation(1, true, 50), evaluation(2, true, 120), evaluation(3, true, 80)}, []int{2, 3, 1}},
+		{"usable before unusable", []CouponEvaluation{evaluation(1, false, 0), evaluation(2, true, 10), evaluation(3, false, 0), evaluation(4, true, 5)}, []int{2, 4, 1, 3}},
+		{"ties keep their order", []CouponEvaluation{evaluation(3, true, 40), evaluation(1, true, 40), evaluation(2, false, 0)}, []int{3, 1, 2}},
+		{"empty", []CouponEvaluation{}, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sortCouponEvaluations(tt.evaluations)
+			if len(tt.evaluations) != len(tt.want) {
+				t.Fatalf("got %d evaluations, want %d", len(tt.evaluations), len(tt.want))
+			}
+			for i, id := range tt.want {
+				if got := tt.evaluations[i].Coupon.ID; got != id {
+					t.Errorf("position %d = coupon %d, want %d", i, got, id)
+				}
+			}
+		})
+	}
+}
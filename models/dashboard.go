@@ -10,10 +10,12 @@ type DashboardData struct {
 	CompletedOrders   int
 	CancelledOrders   int
 	ReturnedOrders    int
+	LowStockProducts  int
 }
 type DashboardReport struct {
 	TopProducts   []ProductReport
 	TopCategories []CategoryReport
+	TopBrands     []BrandReport
 }
 
 type ProductReport struct {
@@ -26,3 +28,8 @@ type CategoryReport struct {
 	CategoryName string `db:"category_name"`
 	TotalSold    int    `db:"total_sold"`
 }
+
+type BrandReport struct {
+	BrandName string `db:"brand_name"`
+	TotalSold int    `db:"total_sold"`
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"errors"
+	"horizon/config"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	FlashSaleLive     = "live"
+	FlashSaleUpcoming = "upcoming"
+	FlashSaleEnded    = "ended"
+)
+
+var (
+	ErrFlashSaleUnavailable   = errors.New("flash sale units are no longer available")
+	ErrFlashSaleCustomerLimit = errors.New("flash sale limit per customer reached")
+)
+
+type FlashSaleItem struct {
+	ID                 int     `json:"id" db:"id"`
+	FlashSaleID        int     `json:"flash_sale_id" db:"flash_sale_id"`
+	ProductID          int     `json:"product_id" db:"product_id"`
+	ProductName        string  `json:"product_name" db:"product_name"`
+	Price              float64 `json:"price" db:"price"`
+	DiscountPercentage float64 `json:"discount_percentage" db:"discount_percentage"`
+	SalePrice          float64 `json:"sale_price" db:"sale_price"`
+	Quantity           int     `json:"quantity" db:"quantity"`
+	Claimed            int     `json:"claimed" db:"claimed"`
+	Remaining          int     `json:"remaining" db:"remaining"`
+	PerCustomerLimit   int     `json:"per_customer_limit" db:"per_customer_limit"`
+}
+
+// FlashSale is a sale event with the seconds until it starts and ends, for
+// storefront countdowns. Both are zero once passed.
+type FlashSale struct {
+	ID        int             `json:"id" db:"id"`
+	Name      string          `json:"name" db:"name"`
+	StartTime time.Time       `json:"start_time" db:"start_time"`
+	EndTime   time.Time       `json:"end_time" db:"end_time"`
+	Active    bool            `json:"active" db:"active"`
+	Status    string          `json:"status" db:"-"`
+	StartsIn  int64           `json:"starts_in_seconds" db:"-"`
+	EndsIn    int64           `json:"ends_in_seconds" db:"-"`
+	Items     []FlashSaleItem `json:"items" db:"-"`
+}
+
+// SetCountdown fills in the sale's status and countdowns as of now.
+func (s *FlashSale) SetCountdown(now time.Time) {
+	switch {
+	case now.Before(s.StartTime):
+		s.Status = FlashSaleUpcoming
+		s.StartsIn = int64(s.StartTime.Sub(now).Seconds())
+		s.EndsIn = int64(s.EndTime.Sub(now).Seconds())
+	case now.Before(s.EndTime):
+		s.Status = FlashSaleLive
+		s.EndsIn = int64(s.EndTime.Sub(now).Seconds())
+	default:
+		s.Status = FlashSaleEnded
+	}
+}
+
+// AttachFlashSaleItems loads the items of each sale, with the units left,
+// and sets the sales' countdowns.
+func AttachFlashSaleItems(sales []FlashSale) error {
+	if len(sales) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(sales))
+	for i, sale := range sales {
+		ids[i] = int64(sale.ID)
+	}
+
+	var items []FlashSaleItem
+	query := `
+		SELECT i.id, i.flash_sale_id, i.product_id, p.name AS product_name, p.price, i.discount_percentage,
+		       ROUND(p.price * (100 - i.discount_percentage) / 100, 2) AS sale_price,
+		       i.quantity, i.claimed, i.quantity - i.claimed AS remaining, i.per_customer_limit
+		FROM flash_sale_items i
+		JOIN products p ON p.id = i.product_id
+		WHERE i.flash_sale_id = ANY($1)
+		ORDER BY i.id`
+	if err := config.DB.Select(&items, query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	bySale := map[int][]FlashSaleItem{}
+	for _, item := range items {
+		bySale[item.FlashSaleID] = append(bySale[item.FlashSaleID], item)
+	}
+	now := time.Now()
+	for i := range sales {
+		sales[i].Items = bySale[sales[i].ID]
+		if sales[i].Items == nil {
+			sales[i].Items = []FlashSaleItem{}
+		}
+		sales[i].SetCountdown(now)
+	}
+	return nil
+}
+
+// LiveFlashSaleLines returns the live flash sale on each of the products as
+// a shopper who has bought none of it yet would get it, for pricing outside a
+// cart. Like LoadCartPricingLines it picks the deepest discount should sales
+// overlap.
+func LiveFlashSaleLines(db Querier, productIDs []int) (map[int]*FlashSaleLine, error) {
+	sales := map[int]*FlashSaleLine{}
+	if len(productIDs) == 0 {
+		return sales, nil
+	}
+	ids := make([]int64, len(productIDs))
+	for i, id := range productIDs {
+		ids[i] = int64(id)
+	}
+
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (i.product_id) i.product_id, i.id, i.discount_percentage,
+		       LEAST(i.quantity - i.claimed, i.per_customer_limit)
+		FROM flash_sale_items i
+		JOIN flash_sales s ON s.id = i.flash_sale_id
+		WHERE i.product_id = ANY($1) AND s.active AND s.start_time <= NOW() AND s.end_time > NOW()
+		ORDER BY i.product_id, i.discount_percentage DESC`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int
+		var sale FlashSaleLine
+		if err := rows.Scan(&productID, &sale.ItemID, &sale.Percentage, &sale.Units); err != nil {
+			return nil, err
+		}
+		sales[productID] = &sale
+	}
+	return sales, rows.Err()
+}
+
+// LockCartFlashSales locks the live flash sale items in a customer's cart
+// until the transaction ends, so that the units priced at checkout are still
+// there when the order claims them. Items are locked in id order so that
+// concurrent checkouts cannot deadlock.
+func LockCartFlashSales(db Execer, userID int) error {
+	_, err := db.Exec(`
+		SELECT i.id
+		FROM flash_sale_items i
+		JOIN flash_sales s ON s.id = i.flash_sale_id
+		JOIN cart c ON c.product_id = i.product_id AND c.user_id = $1
+		WHERE s.active AND s.start_time <= NOW() AND s.end_time > NOW()
+		ORDER BY i.id
+		FOR UPDATE OF i`, userID)
+	return err
+}
+
+// ClaimFlashSaleUnits takes the flash sale units an order was priced with.
+// The guarded increment is what keeps a sale from overselling: it only
+// succeeds while the sale is live and has the units left, and holds the
+// item's row lock until the transaction ends, which also serialises the
+// per-customer check.
+func ClaimFlashSaleUnits(db Querier, userID, orderID int, lines []PricedLine) error {
+	for _, line := range lines {
+		if line.FlashSale == nil || line.FlashSaleUnits <= 0 {
+			continue
+		}
+		itemID, units := line.FlashSale.ItemID, line.FlashSaleUnits
+
+		result, err := db.Exec(`
+			UPDATE flash_sale_items i
+			SET claimed = claimed + $1
+			FROM flash_sales s
+			WHERE i.id = $2 AND s.id = i.flash_sale_id
+			  AND s.active AND s.start_time <= NOW() AND s.end_time > NOW()
+			  AND i.claimed + $1 <= i.quantity`, units, itemID)
+		if err != nil {
+			return err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return ErrFlashSaleUnavailable
+		}
+
+		var limit, claimed int
+		query := `
+			SELECT i.per_customer_limit, COALESCE(SUM(fc.quantity), 0)
+			FROM flash_sale_items i
+			LEFT JOIN flash_sale_claims fc ON fc.flash_sale_item_id = i.id AND fc.user_id = $2 AND fc.status = 'Claimed'
+			WHERE i.id = $1
+			GROUP BY i.per_customer_limit`
+		if err := db.QueryRow(query, itemID, userID).Scan(&limit, &claimed); err != nil {
+			return err
+		}
+		if claimed+units > limit {
+			return ErrFlashSaleCustomerLimit
+		}
+
+		_, err = db.Exec(`INSERT INTO flash_sale_claims (flash_sale_item_id, user_id, order_id, quantity) VALUES ($1, $2, $3, $4)`,
+			itemID, userID, orderID, units)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseFlashSaleClaims gives a cancelled order's flash sale units back to
+// their sales, and back to the customer's allowance.
+func ReleaseFlashSaleClaims(db Execer, orderID int) error {
+	_, err := db.Exec(`
+		WITH released AS (
+			UPDATE flash_sale_claims
+			SET status = 'Released', released_at = NOW()
+			WHERE order_id = $1 AND status = 'Claimed'
+			RETURNING flash_sale_item_id, quantity
+		)
+		UPDATE flash_sale_items i
+		SET claimed = GREATEST(i.claimed - r.released, 0)
+		FROM (SELECT flash_sale_item_id, SUM(quantity) AS released FROM released GROUP BY flash_sale_item_id) r
+		WHERE i.id = r.flash_sale_item_id`, orderID)
+	return err
+}
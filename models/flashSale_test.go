@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlashSaleSetCountdown(t *testing.T) {
+	start := time.Date(2026, 6, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+
+	tests := []struct {
+		name         string
+		now          time.Time
+		wantStatus   string
+		wantStartsIn int64
+		wantEndsIn   int64
+	}{
+		{"upcoming", start.Add(-90 * time.Second), FlashSaleUpcoming, 90, 7290},
+		{"just started", start, FlashSaleLive, 0, 7200},
+		{"live", start.Add(time.Hour), FlashSaleLive, 0, 3600},
+		{"just ended", end, FlashSaleEnded, 0, 0},
+		{"ended", end.Add(time.Hour), FlashSaleEnded, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sale := FlashSale{StartTime: start, EndTime: end}
+			sale.SetCountdown(tt.now)
+			if sale.Status != tt.wantStatus || sale.StartsIn != tt.wantStartsIn || sale.EndsIn != tt.wantEndsIn {
+				t.Errorf("SetCountdown() = %s, %d, %d, want %s, %d, %d",
+					sale.Status, sale.StartsIn, sale.EndsIn, tt.wantStatus, tt.wantStartsIn, tt.wantEndsIn)
+			}
+		})
+	}
+}
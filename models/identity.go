@@ -0,0 +1,22 @@
+package models
+
+import (
+	"horizon/config"
+)
+
+type UserIdentity struct {
+	ID             int    `db:"id" json:"id"`
+	UserID         int    `db:"user_id" json:"user_id"`
+	Provider       string `db:"provider" json:"provider"`
+	ProviderUserID string `db:"provider_user_id" json:"provider_user_id"`
+	Email          string `db:"email" json:"email"`
+}
+
+func (i *UserIdentity) FindByProvider(provider, providerUserID string) error {
+	query := "SELECT id, user_id, provider, provider_user_id, COALESCE(email, '') AS email FROM user_identities WHERE provider = $1 AND provider_user_id = $2"
+	return config.DB.Get(i, query, provider, providerUserID)
+}
+func (i *UserIdentity) Create() error {
+	query := "INSERT INTO user_identities (user_id, provider, provider_user_id, email) VALUES ($1, $2, $3, $4) RETURNING id"
+	return config.DB.QueryRow(query, i.UserID, i.Provider, i.ProviderUserID, i.Email).Scan(&i.ID)
+}
@@ -24,4 +24,5 @@ type InvoiceItem struct {
 	ProductDesc  string  `json:"product_desc"`
 	PricePerUnit float64 `json:"price_per_unit"`
 	Subtotal     float64 `json:"subtotal"`
+	ThumbnailKey string  `json:"-"`
 }
@@ -0,0 +1,275 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Loyalty ledger entry types. earn, review_bonus and redeem_refund credit
+// points; redeem, reversal and expire debit them.
+const (
+	LoyaltyEarn         = "earn"
+	LoyaltyReviewBonus  = "review_bonus"
+	LoyaltyRedeem       = "redeem"
+	LoyaltyRedeemRefund = "redeem_refund"
+	LoyaltyReversal     = "reversal"
+	LoyaltyExpire       = "expire"
+)
+
+const (
+	TierMember = "member"
+	TierSilver = "silver"
+	TierGold   = "gold"
+)
+
+var ErrInsufficientPoints = errors.New("not enough loyalty points")
+
+type LoyaltySettings struct {
+	PointsPerRupee          float64 `json:"points_per_rupee" db:"points_per_rupee"`
+	RupeesPerPoint          float64 `json:"rupees_per_point" db:"rupees_per_point"`
+	MaxRedemptionPercentage float64 `json:"max_redemption_percentage" db:"max_redemption_percentage"`
+	ReviewBonusPoints       int     `json:"review_bonus_points" db:"review_bonus_points"`
+	ValidityDays            int     `json:"validity_days" db:"validity_days"`
+	SilverThreshold         float64 `json:"silver_threshold" db:"silver_threshold"`
+	GoldThreshold           float64 `json:"gold_threshold" db:"gold_threshold"`
+	SilverMultiplier        float64 `json:"silver_multiplier" db:"silver_multiplier"`
+	GoldMultiplier          float64 `json:"gold_multiplier" db:"gold_multiplier"`
+}
+
+type LoyaltyEntry struct {
+	ID        int        `json:"id" db:"id"`
+	EntryType string     `json:"entry_type" db:"entry_type"`
+	Points    int        `json:"points" db:"points"`
+	OrderID   *int       `json:"order_id,omitempty" db:"order_id"`
+	Note      *string    `json:"note,omitempty" db:"note"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// LoyaltySettingsColumns is the column list, in order, that
+// LoadLoyaltySettings reads.
+const LoyaltySettingsColumns = `points_per_rupee, rupees_per_point, max_redemption_percentage, review_bonus_points,
+	validity_days, silver_threshold, gold_threshold, silver_multiplier, gold_multiplier`
+
+func LoadLoyaltySettings(db Querier) (LoyaltySettings, error) {
+	return ScanLoyaltySettings(db.QueryRow(`SELECT ` + LoyaltySettingsColumns + ` FROM loyalty_settings`))
+}
+
+// ScanLoyaltySettings reads settings selected with LoyaltySettingsColumns.
+func ScanLoyaltySettings(row rowScanner) (LoyaltySettings, error) {
+	var s LoyaltySettings
+	err := row.Scan(&s.PointsPerRupee, &s.RupeesPerPoint, &s.MaxRedemptionPercentage, &s.ReviewBonusPoints,
+		&s.ValidityDays, &s.SilverThreshold, &s.GoldThreshold, &s.SilverMultiplier, &s.GoldMultiplier)
+	return s, err
+}
+
+// Tier places a 12-month spend in a tier and gives its earning multiplier.
+func (s LoyaltySettings) Tier(spend float64) (string, float64) {
+	switch {
+	case spend >= s.GoldThreshold:
+		return TierGold, s.GoldMultiplier
+	case spend >= s.SilverThreshold:
+		return TierSilver, s.SilverMultiplier
+	default:
+		return TierMember, 1
+	}
+}
+
+// Redemption caps the points a customer asked to redeem on an order at
+// MaxRedemptionPercentage of its total and returns the points that will be
+// used and the discount they give.
+func (s LoyaltySettings) Redemption(points int, orderTotal float64) (int, float64) {
+	if points <= 0 || s.RupeesPerPoint <= 0 || orderTotal <= 0 {
+		return 0, 0
+	}
+	limit := orderTotal * s.MaxRedemptionPercentage / 100
+	if max := int(math.Floor(limit / s.RupeesPerPoint)); points > max {
+		points = max
+	}
+	return points, roundMoney(float64(points) * s.RupeesPerPoint)
+}
+
+// LoyaltyBalance is the sum of a customer's unexpired credits.
+func LoyaltyBalance(db Querier, userID int) (int, error) {
+	var balance int
+	query := `SELECT COALESCE(SUM(remaining), 0) FROM loyalty_ledger WHERE user_id = $1 AND remaining > 0 AND expires_at > NOW()`
+	err := db.QueryRow(query, userID).Scan(&balance)
+	return balance, err
+}
+
+// RollingSpend is what a customer paid for orders delivered over the last
+// 12 months.
+func RollingSpend(db Querier, userID int) (float64, error) {
+	var spend float64
+	query := `
+		SELECT COALESCE(SUM(total_amount), 0) FROM orders
+		WHERE user_id = $1 AND status = 'Delivered' AND order_date >= NOW() - INTERVAL '12 months'`
+	err := db.QueryRow(query, userID).Scan(&spend)
+	return spend, err
+}
+
+// creditPoints adds points that can be spent until the validity period runs
+// out. A credit already given for the same order or review is not repeated.
+func creditPoints(db Querier, userID int, entryType string, points int, orderID, reviewID *int, note string, validityDays int) (bool, error) {
+	if points <= 0 {
+		return false, nil
+	}
+	expiresAt := time.Now().AddDate(0, 0, validityDays)
+	result, err := db.Exec(`
+		INSERT INTO loyalty_ledger (user_id, entry_type, points, remaining, order_id, review_id, note, expires_at)
+		VALUES ($1, $2, $3, $3, $4, $5, $6, $7)
+		ON CONFLICT DO NOTHING`, userID, entryType, points, orderID, reviewID, note, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// debitPoints takes up to points from a customer's unexpired credits, those
+// expiring soonest first (or the credit preferID first, when given), and
+// records the debit. It returns how many points were taken.
+func debitPoints(db Querier, userID int, entryType string, points int, orderID *int, note string, preferID int) (int, error) {
+	rows, err := db.Query(`
+		SELECT id, remaining FROM loyalty_ledger
+		WHERE user_id = $1 AND remaining > 0 AND expires_at > NOW()
+		ORDER BY (id = $2) DESC, expires_at, id
+		FOR UPDATE`, userID, preferID)
+	if err != nil {
+		return 0, err
+	}
+	type credit struct{ id, remaining int }
+	var credits []credit
+	for rows.Next() {
+		var cr credit
+		if err := rows.Scan(&cr.id, &cr.remaining); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		credits = append(credits, cr)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	taken := 0
+	for _, cr := range credits {
+		if taken == points {
+			break
+		}
+		take := cr.remaining
+		if take > points-taken {
+			take = points - taken
+		}
+		if _, err := db.Exec(`UPDATE loyalty_ledger SET remaining = remaining - $1 WHERE id = $2`, take, cr.id); err != nil {
+			return 0, err
+		}
+		taken += take
+	}
+	if taken == 0 {
+		return 0, nil
+	}
+
+	_, err = db.Exec(`INSERT INTO loyalty_ledger (user_id, entry_type, points, order_id, note) VALUES ($1, $2, $3, $4, $5)`,
+		userID, entryType, -taken, orderID, note)
+	return taken, err
+}
+
+// AwardOrderPoints credits the points a delivered order earns, scaled by the
+// customer's tier.
+func AwardOrderPoints(db Querier, userID, orderID int) (int, error) {
+	settings, err := LoadLoyaltySettings(db)
+	if err != nil {
+		return 0, err
+	}
+	spend, err := RollingSpend(db, userID)
+	if err != nil {
+		return 0, err
+	}
+	var paid float64
+	if err := db.QueryRow(`SELECT total_amount FROM orders WHERE id = $1`, orderID).Scan(&paid); err != nil {
+		return 0, err
+	}
+
+	tier, multiplier := settings.Tier(spend)
+	points := int(math.Floor(paid * settings.PointsPerRupee * multiplier))
+	note := fmt.Sprintf("Order %d delivered (%s tier)", orderID, tier)
+	credited, err := creditPoints(db, userID, LoyaltyEarn, points, &orderID, nil, note, settings.ValidityDays)
+	if err != nil || !credited {
+		return 0, err
+	}
+	return points, nil
+}
+
+// ReverseOrderPoints takes back what a returned order earned, as far as the
+// customer still has the points.
+func ReverseOrderPoints(db Querier, userID, orderID int) error {
+	var earnID, earned, reversed int
+	query := `
+		SELECT e.id, e.points,
+		       COALESCE((SELECT -SUM(r.points) FROM loyalty_ledger r WHERE r.order_id = e.order_id AND r.entry_type = 'reversal'), 0)
+		FROM loyalty_ledger e
+		WHERE e.order_id = $1 AND e.entry_type = 'earn'`
+	err := db.QueryRow(query, orderID).Scan(&earnID, &earned, &reversed)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if earned <= reversed {
+		return nil
+	}
+	_, err = debitPoints(db, userID, LoyaltyReversal, earned-reversed, &orderID, fmt.Sprintf("Order %d returned", orderID), earnID)
+	return err
+}
+
+// RedeemPoints spends points on an order.
+func RedeemPoints(db Querier, userID, orderID, points int) error {
+	taken, err := debitPoints(db, userID, LoyaltyRedeem, points, &orderID, fmt.Sprintf("Redeemed on order %d", orderID), 0)
+	if err != nil {
+		return err
+	}
+	if taken < points {
+		return ErrInsufficientPoints
+	}
+	return nil
+}
+
+// RefundRedeemedPoints gives back the points spent on an order that was
+// cancelled or returned, with a fresh validity period.
+func RefundRedeemedPoints(db Querier, userID, orderID int) error {
+	var redeemed, refunded int
+	query := `
+		SELECT COALESCE(-SUM(points) FILTER (WHERE entry_type = 'redeem'), 0),
+		       COALESCE(SUM(points) FILTER (WHERE entry_type = 'redeem_refund'), 0)
+		FROM loyalty_ledger WHERE order_id = $1`
+	if err := db.QueryRow(query, orderID).Scan(&redeemed, &refunded); err != nil {
+		return err
+	}
+	if redeemed <= refunded {
+		return nil
+	}
+	settings, err := LoadLoyaltySettings(db)
+	if err != nil {
+		return err
+	}
+	note := fmt.Sprintf("Order %d refunded", orderID)
+	_, err = creditPoints(db, userID, LoyaltyRedeemRefund, redeemed-refunded, &orderID, nil, note, settings.ValidityDays)
+	return err
+}
+
+// AwardReviewBonus credits the bonus for a review once it is approved. A
+// review earns its bonus only once.
+func AwardReviewBonus(db Querier, userID, reviewID int) error {
+	settings, err := LoadLoyaltySettings(db)
+	if err != nil {
+		return err
+	}
+	_, err = creditPoints(db, userID, LoyaltyReviewBonus, settings.ReviewBonusPoints, nil, &reviewID, "Review approved", settings.ValidityDays)
+	return err
+}
@@ -0,0 +1,61 @@
+package models
+
+import "testing"
+
+var testLoyaltySettings = LoyaltySettings{
+	PointsPerRupee:          0.1,
+	RupeesPerPoint:          0.5,
+	MaxRedemptionPercentage: 20,
+	SilverThreshold:         10000,
+	GoldThreshold:           50000,
+	SilverMultiplier:        1.25,
+	GoldMultiplier:          1.5,
+}
+
+func TestLoyaltyTier(t *testing.T) {
+	tests := []struct {
+		spend          float64
+		wantTier       string
+		wantMultiplier float64
+	}{
+		{0, TierMember, 1},
+		{9999.99, TierMember, 1},
+		{10000, TierSilver, 1.25},
+		{49999, TierSilver, 1.25},
+		{50000, TierGold, 1.5},
+		{120000, TierGold, 1.5},
+	}
+	for _, tt := range tests {
+		tier, multiplier := testLoyaltySettings.Tier(tt.spend)
+		if tier != tt.wantTier || multiplier != tt.wantMultiplier {
+			t.Errorf("Tier(%v) = %s, %v, want %s, %v", tt.spend, tier, multiplier, tt.wantTier, tt.wantMultiplier)
+		}
+	}
+}
+
+func TestLoyaltyRedemption(t *testing.T) {
+	tests := []struct {
+		name         string
+		settings     LoyaltySettings
+		points       int
+		orderTotal   float64
+		wantPoints   int
+		wantDiscount float64
+	}{
+		{"under the cap", testLoyaltySettings, 100, 1000, 100, 50},
+		{"capped at the maximum percentage", testLoyaltySettings, 1000, 1000, 400, 200},
+		{"cap rounds down to whole points", testLoyaltySettings, 100, 101.2, 40, 20},
+		{"no points", testLoyaltySettings, 0, 1000, 0, 0},
+		{"negative points", testLoyaltySettings, -5, 1000, 0, 0},
+		{"free order", testLoyaltySettings, 100, 0, 0, 0},
+		{"redemption switched off", LoyaltySettings{MaxRedemptionPercentage: 20}, 100, 1000, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points, discount := tt.settings.Redemption(tt.points, tt.orderTotal)
+			if points != tt.wantPoints || discount != tt.wantDiscount {
+				t.Errorf("Redemption(%d, %v) = %d, %v, want %d, %v", tt.points, tt.orderTotal, points, discount, tt.wantPoints, tt.wantDiscount)
+			}
+		})
+	}
+}
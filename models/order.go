@@ -1,5 +1,10 @@
 package models
 
+import (
+	"database/sql"
+	"fmt"
+)
+
 type OrderDetail struct {
 	OrderID        int     `json:"order_id"`
 	ReferenceID    string  `json:"reference_id"`
@@ -23,3 +28,47 @@ type OrderDetail struct {
 	City           string  `json:"city"`
 	ZipCode        string  `json:"zip_code"`
 }
+
+// ReleaseOrder gives back what a cancelled order held: its stock, in the
+// warehouses it came from, its flash sale units, its coupons and the points
+// spent on it. It returns the products restocked. Products, flash sale items
+// and coupons are locked in the order checkout takes them in, so a release
+// cannot deadlock with a checkout.
+func ReleaseOrder(db Querier, userID, orderID int) ([]int, error) {
+	productIDs, err := RestockOrder(db, orderID, StockReasonCancellation, fmt.Sprintf("Order %d cancelled", orderID))
+	if err != nil {
+		return nil, err
+	}
+	if err := ReleaseFlashSaleClaims(db, orderID); err != nil {
+		return nil, err
+	}
+	if err := RollbackOrderCoupons(db, orderID); err != nil {
+		return nil, err
+	}
+	if err := RefundRedeemedPoints(db, userID, orderID); err != nil {
+		return nil, err
+	}
+	return productIDs, nil
+}
+
+// CancelUnpaidOrder cancels an online order whose payment never went through
+// and releases what it held. It reports false, and changes nothing, once the
+// order has been paid or has moved on from Pending.
+func CancelUnpaidOrder(db Querier, orderID int) ([]int, bool, error) {
+	var userID int
+	err := db.QueryRow(`
+		UPDATE orders SET status = 'Cancelled'
+		WHERE id = $1 AND status = 'Pending' AND payment_status = 'Processing'
+		RETURNING user_id`, orderID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	productIDs, err := ReleaseOrder(db, userID, orderID)
+	if err != nil {
+		return nil, false, err
+	}
+	return productIDs, true, nil
+}
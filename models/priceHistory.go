@@ -0,0 +1,49 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	PriceSourceManual    = "manual"
+	PriceSourceImport    = "import"
+	PriceSourceScheduled = "scheduled"
+)
+
+// Execer is satisfied by both the database handle and a transaction.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type PriceHistoryEntry struct {
+	Price         float64   `json:"price" db:"price"`
+	EffectiveFrom time.Time `json:"effective_from" db:"effective_from"`
+	Source        string    `json:"source" db:"source"`
+}
+
+type ScheduledPriceChange struct {
+	ID          int        `json:"id" db:"id"`
+	ProductID   int        `json:"product_id" db:"product_id"`
+	NewPrice    float64    `json:"new_price" db:"new_price"`
+	EffectiveAt time.Time  `json:"effective_at" db:"effective_at"`
+	Status      string     `json:"status" db:"status"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	AppliedAt   *time.Time `json:"applied_at" db:"applied_at"`
+}
+
+// RecordPrice appends a price history entry for a product unless the price
+// is unchanged from the latest entry. A nil effectiveFrom means now.
+func RecordPrice(db Execer, productID int, price float64, effectiveFrom *time.Time, source string) error {
+	query := `
+		INSERT INTO product_price_history (product_id, price, effective_from, source)
+		SELECT $1, $2, COALESCE($3::timestamp, NOW()), $4
+		WHERE COALESCE((
+			SELECT price FROM product_price_history
+			WHERE product_id = $1
+			ORDER BY effective_from DESC, id DESC
+			LIMIT 1
+		), -1) <> $2`
+	_, err := db.Exec(query, productID, price, effectiveFrom, source)
+	return err
+}
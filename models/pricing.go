@@ -0,0 +1,241 @@
+package models
+
+import (
+	"encoding/json"
+	queries "horizon/sql"
+	"time"
+)
+
+// LoadLivePromotions returns the promotions that are active and running now.
+func LoadLivePromotions(db Querier) ([]Promotion, error) {
+	rows, err := db.Query(`
+		SELECT ` + PromotionColumns + `
+		FROM promotions
+		WHERE active AND start_date <= NOW() AND end_date >= NOW()`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promotions []Promotion
+	for rows.Next() {
+		promotion, err := ScanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	return promotions, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// PromotionColumns is the column list ScanPromotion expects.
+const PromotionColumns = `id, name, COALESCE(description, ''), priority, exclusive, conditions, action_type, action, start_date, end_date, active`
+
+// ScanPromotion reads a promotion selected with PromotionColumns.
+func ScanPromotion(row rowScanner) (Promotion, error) {
+	var promotion Promotion
+	var conditions, action []byte
+	err := row.Scan(&promotion.ID, &promotion.Name, &promotion.Description, &promotion.Priority, &promotion.Exclusive,
+		&conditions, &promotion.ActionType, &action, &promotion.StartDate, &promotion.EndDate, &promotion.Active)
+	if err != nil {
+		return promotion, err
+	}
+	if err := json.Unmarshal(conditions, &promotion.Conditions); err != nil {
+		return promotion, err
+	}
+	if err := json.Unmarshal(action, &promotion.Action); err != nil {
+		return promotion, err
+	}
+	return promotion, nil
+}
+
+// LoadPricingCustomer works out the segments a customer belongs to from
+// their order history.
+func LoadPricingCustomer(db Querier, userID int) (PricingCustomer, error) {
+	var orders int
+	var spend float64
+	query := `
+		SELECT COUNT(*) FILTER (WHERE status <> 'Cancelled'),
+		       COALESCE(SUM(total_amount) FILTER (WHERE status = 'Delivered'), 0)
+		FROM orders WHERE user_id = $1`
+	if err := db.QueryRow(query, userID).Scan(&orders, &spend); err != nil {
+		return PricingCustomer{}, err
+	}
+
+	customer := PricingCustomer{FirstOrder: orders == 0}
+	if orders == 0 {
+		customer.Segments = append(customer.Segments, SegmentNew)
+	} else {
+		customer.Segments = append(customer.Segments, SegmentReturning)
+	}
+	if spend >= VIPSpendThreshold {
+		customer.Segments = append(customer.Segments, SegmentVIP)
+	}
+	return customer, nil
+}
+
+// CategoryAncestry maps every category to itself and its ancestors, so that
+// a promotion on a parent category reaches products in its subcategories.
+func CategoryAncestry(db Querier) (map[int][]int, error) {
+	rows, err := db.Query(`SELECT id, parent_id FROM categories`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := map[int]*int{}
+	for rows.Next() {
+		var id int
+		var parentID *int
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, err
+		}
+		parents[id] = parentID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ancestry := map[int][]int{}
+	for id := range parents {
+		seen := map[int]bool{}
+		for current := &id; current != nil && !seen[*current]; current = parents[*current] {
+			seen[*current] = true
+			ancestry[id] = append(ancestry[id], *current)
+		}
+	}
+	return ancestry, nil
+}
+
+// LoadCartPricingLines reads a customer's cart with what the engine needs to
+// know about each product.
+func LoadCartPricingLines(db Querier, userID int) ([]PricingLine, error) {
+	ancestry, err := CategoryAncestry(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// A product is in at most one live flash sale at a time; the lateral
+	// join picks the deepest discount should sales ever overlap.
+	rows, err := db.Query(`
+		SELECT p.id, p.name, p.category_id, p.brand_id, c.quantity, p.price, o.discount_percentage,
+		       fs.id, fs.discount_percentage, fs.units
+		FROM cart c
+		JOIN products p ON c.product_id = p.id`+queries.ActiveOfferJoin+`
+		LEFT JOIN LATERAL (
+			SELECT i.id, i.discount_percentage,
+			       LEAST(i.quantity - i.claimed, i.per_customer_limit - COALESCE((
+			           SELECT SUM(fc.quantity) FROM flash_sale_claims fc
+			           WHERE fc.flash_sale_item_id = i.id AND fc.user_id = c.user_id AND fc.status = 'Claimed'
+			       ), 0)) AS units
+			FROM flash_sale_items i
+			JOIN flash_sales s ON s.id = i.flash_sale_id
+			WHERE i.product_id = p.id AND s.active AND s.start_time <= NOW() AND s.end_time > NOW()
+			ORDER BY i.discount_percentage DESC
+			LIMIT 1
+		) fs ON true
+		WHERE c.user_id = $1
+		ORDER BY c.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []PricingLine
+	for rows.Next() {
+		var line PricingLine
+		var categoryID int
+		var saleItemID, saleUnits *int
+		var salePercentage *float64
+		if err := rows.Scan(&line.ProductID, &line.Name, &categoryID, &line.BrandID, &line.Quantity, &line.UnitPrice, &line.OfferPercentage,
+			&saleItemID, &salePercentage, &saleUnits); err != nil {
+			return nil, err
+		}
+		line.CategoryIDs = ancestry[categoryID]
+		if saleItemID != nil {
+			line.FlashSale = &FlashSaleLine{ItemID: *saleItemID, Percentage: *salePercentage, Units: *saleUnits}
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+// PriceUserCart prices a customer's current cart with every live promotion.
+func PriceUserCart(db Querier, userID int) (CartPricing, error) {
+	lines, err := LoadCartPricingLines(db, userID)
+	if err != nil {
+		return CartPricing{}, err
+	}
+	customer, err := LoadPricingCustomer(db, userID)
+	if err != nil {
+		return CartPricing{}, err
+	}
+	promotions, err := LoadLivePromotions(db)
+	if err != nil {
+		return CartPricing{}, err
+	}
+	return PriceCart(lines, customer, promotions, time.Now()), nil
+}
+
+// LoadGuestCartPricingLines reads a guest cart the way LoadCartPricingLines
+// reads a customer's. Flash sales are left out: their units are capped per
+// customer, so a guest only sees them once signed in.
+func LoadGuestCartPricingLines(db Querier, guestID string) ([]PricingLine, error) {
+	ancestry, err := CategoryAncestry(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT p.id, p.name, p.category_id, p.brand_id, g.quantity, p.price, o.discount_percentage
+		FROM guest_cart_items g
+		JOIN products p ON g.product_id = p.id`+queries.ActiveOfferJoin+`
+		WHERE g.guest_id = $1
+		ORDER BY g.id`, guestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []PricingLine
+	for rows.Next() {
+		var line PricingLine
+		var categoryID int
+		if err := rows.Scan(&line.ProductID, &line.Name, &categoryID, &line.BrandID, &line.Quantity, &line.UnitPrice, &line.OfferPercentage); err != nil {
+			return nil, err
+		}
+		line.CategoryIDs = ancestry[categoryID]
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+// PriceGuestCart prices a guest cart with the live promotions open to anyone.
+func PriceGuestCart(db Querier, guestID string) (CartPricing, error) {
+	lines, err := LoadGuestCartPricingLines(db, guestID)
+	if err != nil {
+		return CartPricing{}, err
+	}
+	promotions, err := LoadLivePromotions(db)
+	if err != nil {
+		return CartPricing{}, err
+	}
+	return PriceCart(lines, PricingCustomer{}, promotions, time.Now()), nil
+}
+
+// RecordOrderPromotions keeps which promotions discounted an order and by how
+// much. Free shipping promotions are recorded with a zero amount.
+func RecordOrderPromotions(db Execer, orderID int, applied []AppliedPromotion) error {
+	for _, promotion := range applied {
+		_, err := db.Exec(`INSERT INTO order_promotions (order_id, promotion_id, amount) VALUES ($1, $2, $3)`,
+			orderID, promotion.PromotionID, promotion.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
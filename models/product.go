@@ -6,6 +6,9 @@ type Product struct {
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
 	CategoryID  int     `json:"category_id"`
+	BrandID     *int    `json:"brand_id"`
 	Stock       int     `json:"stock"`
 	Deleted     bool    `json:"deleted"`
+	AvgRating   float64 `json:"avg_rating"`
+	RatingCount int     `json:"rating_count"`
 }
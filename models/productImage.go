@@ -0,0 +1,43 @@
+package models
+
+import (
+	"horizon/config"
+	"horizon/utils"
+)
+
+type ProductImage struct {
+	ID           int    `json:"id" db:"id"`
+	ProductID    int    `json:"product_id" db:"product_id"`
+	OriginalKey  string `json:"-" db:"original_key"`
+	MediumKey    string `json:"-" db:"medium_key"`
+	ThumbnailKey string `json:"-" db:"thumbnail_key"`
+	URL          string `json:"url" db:"-"`
+	MediumURL    string `json:"medium_url" db:"-"`
+	ThumbnailURL string `json:"thumbnail_url" db:"-"`
+	Width        int    `json:"width" db:"width"`
+	Height       int    `json:"height" db:"height"`
+	SortOrder    int    `json:"sort_order" db:"sort_order"`
+	IsPrimary    bool   `json:"is_primary" db:"is_primary"`
+}
+
+// FetchProductImages returns a product's images, primary first, with URLs
+// resolved against the configured storage.
+func FetchProductImages(productID int) ([]ProductImage, error) {
+	images := []ProductImage{}
+	query := `
+		SELECT id, product_id, original_key, medium_key, thumbnail_key, width, height, sort_order, is_primary
+		FROM product_images
+		WHERE product_id = $1
+		ORDER BY is_primary DESC, sort_order, id`
+	if err := config.DB.Select(&images, query, productID); err != nil {
+		return nil, err
+	}
+
+	store := utils.Storage()
+	for i := range images {
+		images[i].URL = store.URL(images[i].OriginalKey)
+		images[i].MediumURL = store.URL(images[i].MediumKey)
+		images[i].ThumbnailURL = store.URL(images[i].ThumbnailKey)
+	}
+	return images, nil
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type ProductImportJob struct {
+	ID            int             `json:"id" db:"id"`
+	FileName      string          `json:"file_name" db:"file_name"`
+	Status        string          `json:"status" db:"status"`
+	TotalRows     int             `json:"total_rows" db:"total_rows"`
+	ProcessedRows int             `json:"processed_rows" db:"processed_rows"`
+	CreatedCount  int             `json:"created_count" db:"created_count"`
+	UpdatedCount  int             `json:"updated_count" db:"updated_count"`
+	ErrorCount    int             `json:"error_count" db:"error_count"`
+	Errors        json.RawMessage `json:"errors" db:"errors"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	FinishedAt    *time.Time      `json:"finished_at" db:"finished_at"`
+}
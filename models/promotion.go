@@ -0,0 +1,396 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	PromotionPercentage   = "percentage"
+	PromotionFixedAmount  = "fixed_amount"
+	PromotionBuyXGetY     = "buy_x_get_y"
+	PromotionTiered       = "tiered"
+	PromotionFreeShipping = "free_shipping"
+)
+
+// Customer segments a promotion can target. A customer is "new" until their
+// first order and "returning" afterwards; "vip" is added once delivered
+// orders reach VIPSpendThreshold.
+const (
+	SegmentNew       = "new"
+	SegmentReturning = "returning"
+	SegmentVIP       = "vip"
+
+	VIPSpendThreshold = 10000
+)
+
+// PromotionConditions narrow where a promotion applies. Empty lists match
+// everything; category ids also match their subcategories.
+type PromotionConditions struct {
+	CategoryIDs []int    `json:"category_ids,omitempty"`
+	BrandIDs    []int    `json:"brand_ids,omitempty"`
+	ProductIDs  []int    `json:"product_ids,omitempty"`
+	MinSubtotal float64  `json:"min_subtotal,omitempty"`
+	MinQuantity int      `json:"min_quantity,omitempty"`
+	Segments    []string `json:"segments,omitempty"`
+	FirstOrder  bool     `json:"first_order,omitempty"`
+}
+
+type PromotionTier struct {
+	MinQuantity int     `json:"min_quantity"`
+	Percentage  float64 `json:"percentage"`
+}
+
+// PromotionAction holds the parameters of the promotion's action type:
+// Percentage for percentage, Amount for fixed_amount (off the matching lines
+// as a whole), BuyQuantity/GetQuantity/GetPercentage for buy_x_get_y and
+// Tiers for tiered. free_shipping takes none; the store charges no shipping,
+// so it only sets CartPricing.FreeShipping for the storefront to advertise.
+type PromotionAction struct {
+	Percentage    float64         `json:"percentage,omitempty"`
+	Amount        float64         `json:"amount,omitempty"`
+	BuyQuantity   int             `json:"buy_quantity,omitempty"`
+	GetQuantity   int             `json:"get_quantity,omitempty"`
+	GetPercentage float64         `json:"get_percentage,omitempty"`
+	Tiers         []PromotionTier `json:"tiers,omitempty"`
+}
+
+// Promotion is a pricing rule. Promotions run from the highest priority down;
+// an exclusive one only applies to lines no other promotion has touched and
+// keeps lower-priority promotions off the lines it discounts.
+type Promotion struct {
+	ID          int                 `json:"id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Priority    int                 `json:"priority"`
+	Exclusive   bool                `json:"exclusive"`
+	Conditions  PromotionConditions `json:"conditions"`
+	ActionType  string              `json:"action_type"`
+	Action      PromotionAction     `json:"action"`
+	StartDate   time.Time           `json:"start_date"`
+	EndDate     time.Time           `json:"end_date"`
+	Active      bool                `json:"active"`
+}
+
+// Validate reports the first problem with a promotion's rule, or "".
+func (p Promotion) Validate() string {
+	if p.Name == "" {
+		return "Promotion name is required"
+	}
+	if !p.EndDate.After(p.StartDate) {
+		return "end_date must be after start_date"
+	}
+	if p.Conditions.MinSubtotal < 0 || p.Conditions.MinQuantity < 0 {
+		return "Conditions cannot be negative"
+	}
+	for _, segment := range p.Conditions.Segments {
+		if segment != SegmentNew && segment != SegmentReturning && segment != SegmentVIP {
+			return "Unknown customer segment: " + segment
+		}
+	}
+
+	a := p.Action
+	switch p.ActionType {
+	case PromotionPercentage:
+		if a.Percentage <= 0 || a.Percentage > 100 {
+			return "percentage must be between 0 and 100"
+		}
+	case PromotionFixedAmount:
+		if a.Amount <= 0 {
+			return "amount must be positive"
+		}
+	case PromotionBuyXGetY:
+		if a.BuyQuantity <= 0 || a.GetQuantity <= 0 {
+			return "buy_quantity and get_quantity must be positive"
+		}
+		if a.GetPercentage < 0 || a.GetPercentage > 100 {
+			return "get_percentage must be between 0 and 100"
+		}
+	case PromotionTiered:
+		if len(a.Tiers) == 0 {
+			return "tiered promotions need at least one tier"
+		}
+		for _, tier := range a.Tiers {
+			if tier.MinQuantity <= 0 || tier.Percentage <= 0 || tier.Percentage > 100 {
+				return "each tier needs a positive min_quantity and a percentage between 0 and 100"
+			}
+		}
+	case PromotionFreeShipping:
+	default:
+		return "Unknown action_type"
+	}
+	return ""
+}
+
+// PricingLine is one cart line as the engine sees it. CategoryIDs holds the
+// product's category and all of its ancestors.
+type PricingLine struct {
+	ProductID       int            `json:"product_id"`
+	Name            string         `json:"name"`
+	CategoryIDs     []int          `json:"-"`
+	BrandID         *int           `json:"-"`
+	Quantity        int            `json:"quantity"`
+	UnitPrice       float64        `json:"unit_price"`
+	OfferPercentage *float64       `json:"offer_percentage,omitempty"`
+	FlashSale       *FlashSaleLine `json:"flash_sale,omitempty"`
+}
+
+// FlashSaleLine is a live flash sale on a line's product. Units is how many
+// of the line's units the sale can still price for this customer, given the
+// units left and their per-customer allowance.
+type FlashSaleLine struct {
+	ItemID     int     `json:"flash_sale_item_id"`
+	Percentage float64 `json:"discount_percentage"`
+	Units      int     `json:"units_available"`
+}
+
+// PricingCustomer is what promotions may know about the shopper. Anonymous
+// shoppers have no segments and never qualify for first-order promotions.
+type PricingCustomer struct {
+	Segments   []string
+	FirstOrder bool
+}
+
+type AppliedPromotion struct {
+	PromotionID int     `json:"promotion_id"`
+	Name        string  `json:"name"`
+	Amount      float64 `json:"amount"`
+}
+
+type PricedLine struct {
+	PricingLine
+	Subtotal          float64            `json:"subtotal"`
+	FlashSaleUnits    int                `json:"flash_sale_units,omitempty"`
+	OfferDiscount     float64            `json:"offer_discount"`
+	PromotionDiscount float64            `json:"promotion_discount"`
+	Total             float64            `json:"total"`
+	Promotions        []AppliedPromotion `json:"promotions"`
+	exclusive         bool
+}
+
+// CartPricing is the engine's verdict on a cart: each line with the offer and
+// promotions that reduced it, and the totals to charge.
+type CartPricing struct {
+	Lines             []PricedLine       `json:"lines"`
+	Subtotal          float64            `json:"subtotal"`
+	OfferDiscount     float64            `json:"offer_discount"`
+	PromotionDiscount float64            `json:"promotion_discount"`
+	Total             float64            `json:"total"`
+	FreeShipping      bool               `json:"free_shipping"`
+	Promotions        []AppliedPromotion `json:"promotions"`
+}
+
+// PriceCart applies product offers and then the promotions to a cart.
+// Offers come first since they are part of the advertised product price;
+// promotions then work on what is left of each line. A flash sale that beats
+// the product's offer takes its place on the units the sale can still price,
+// and its discount is counted with the offer's.
+func PriceCart(lines []PricingLine, customer PricingCustomer, promotions []Promotion, now time.Time) CartPricing {
+	pricing := CartPricing{Lines: make([]PricedLine, len(lines)), Promotions: []AppliedPromotion{}}
+	for i, line := range lines {
+		priced := PricedLine{PricingLine: line, Promotions: []AppliedPromotion{}}
+		priced.Subtotal = roundMoney(line.UnitPrice * float64(line.Quantity))
+		offerSubtotal := priced.Subtotal
+		if sale := line.FlashSale; sale != nil && sale.Units > 0 && (line.OfferPercentage == nil || sale.Percentage > *line.OfferPercentage) {
+			priced.FlashSaleUnits = sale.Units
+			if priced.FlashSaleUnits > line.Quantity {
+				priced.FlashSaleUnits = line.Quantity
+			}
+			saleSubtotal := roundMoney(line.UnitPrice * float64(priced.FlashSaleUnits))
+			priced.OfferDiscount = roundMoney(saleSubtotal * sale.Percentage / 100)
+			offerSubtotal -= saleSubtotal
+		}
+		if line.OfferPercentage != nil {
+			priced.OfferDiscount += roundMoney(offerSubtotal * *line.OfferPercentage / 100)
+		}
+		priced.Total = priced.Subtotal - priced.OfferDiscount
+		pricing.Lines[i] = priced
+	}
+
+	ordered := append([]Promotion(nil), promotions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Priority != ordered[j].Priority {
+			return ordered[i].Priority > ordered[j].Priority
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	for _, promotion := range ordered {
+		if !promotion.Active || now.Before(promotion.StartDate) || now.After(promotion.EndDate) {
+			continue
+		}
+		if !customerQualifies(promotion.Conditions, customer) {
+			continue
+		}
+
+		var matched []int
+		var quantity int
+		var amount float64
+		for i, line := range pricing.Lines {
+			if line.exclusive || (promotion.Exclusive && len(line.Promotions) > 0) {
+				continue
+			}
+			if !lineMatches(promotion.Conditions, line.PricingLine) {
+				continue
+			}
+			matched = append(matched, i)
+			quantity += line.Quantity
+			amount += line.Total
+		}
+		if len(matched) == 0 || quantity < promotion.Conditions.MinQuantity || amount < promotion.Conditions.MinSubtotal {
+			continue
+		}
+
+		if promotion.ActionType == PromotionFreeShipping {
+			pricing.FreeShipping = true
+			pricing.Promotions = append(pricing.Promotions, AppliedPromotion{PromotionID: promotion.ID, Name: promotion.Name})
+			continue
+		}
+
+		discounts := promotionDiscounts(promotion, pricing.Lines, matched, quantity, amount)
+		var total float64
+		for _, i := range matched {
+			discount := roundMoney(math.Min(discounts[i], pricing.Lines[i].Total))
+			if discount <= 0 {
+				continue
+			}
+			line := &pricing.Lines[i]
+			line.PromotionDiscount += discount
+			line.Total -= discount
+			line.Promotions = append(line.Promotions, AppliedPromotion{PromotionID: promotion.ID, Name: promotion.Name, Amount: discount})
+			if promotion.Exclusive {
+				line.exclusive = true
+			}
+			total += discount
+		}
+		if total > 0 {
+			pricing.Promotions = append(pricing.Promotions, AppliedPromotion{PromotionID: promotion.ID, Name: promotion.Name, Amount: roundMoney(total)})
+		}
+	}
+
+	for _, line := range pricing.Lines {
+		pricing.Subtotal += line.Subtotal
+		pricing.OfferDiscount += line.OfferDiscount
+		pricing.PromotionDiscount += line.PromotionDiscount
+	}
+	pricing.Subtotal = roundMoney(pricing.Subtotal)
+	pricing.OfferDiscount = roundMoney(pricing.OfferDiscount)
+	pricing.PromotionDiscount = roundMoney(pricing.PromotionDiscount)
+	pricing.Total = roundMoney(pricing.Subtotal - pricing.OfferDiscount - pricing.PromotionDiscount)
+	return pricing
+}
+
+// promotionDiscounts works out, per matched line index, how much the
+// promotion takes off. quantity and amount are the matched lines' totals.
+func promotionDiscounts(promotion Promotion, lines []PricedLine, matched []int, quantity int, amount float64) map[int]float64 {
+	discounts := map[int]float64{}
+	action := promotion.Action
+
+	switch promotion.ActionType {
+	case PromotionPercentage:
+		for _, i := range matched {
+			discounts[i] = lines[i].Total * action.Percentage / 100
+		}
+
+	case PromotionFixedAmount:
+		off := math.Min(action.Amount, amount)
+		for _, i := range matched {
+			if amount > 0 {
+				discounts[i] = off * lines[i].Total / amount
+			}
+		}
+
+	case PromotionTiered:
+		var percentage float64
+		best := 0
+		for _, tier := range action.Tiers {
+			if quantity >= tier.MinQuantity && tier.MinQuantity > best {
+				best, percentage = tier.MinQuantity, tier.Percentage
+			}
+		}
+		for _, i := range matched {
+			discounts[i] = lines[i].Total * percentage / 100
+		}
+
+	case PromotionBuyXGetY:
+		// Every group of buy+get units earns the cheapest get units of the
+		// group at get_percentage off (free by default), most expensive
+		// units counted first.
+		getPercentage := action.GetPercentage
+		if getPercentage == 0 {
+			getPercentage = 100
+		}
+		type unit struct {
+			line  int
+			price float64
+		}
+		var units []unit
+		for _, i := range matched {
+			unitPrice := lines[i].Total / float64(lines[i].Quantity)
+			for n := 0; n < lines[i].Quantity; n++ {
+				units = append(units, unit{i, unitPrice})
+			}
+		}
+		sort.SliceStable(units, func(a, b int) bool { return units[a].price > units[b].price })
+		group := action.BuyQuantity + action.GetQuantity
+		for start := 0; start+group <= len(units); start += group {
+			for _, free := range units[start+action.BuyQuantity : start+group] {
+				discounts[free.line] += free.price * getPercentage / 100
+			}
+		}
+	}
+	return discounts
+}
+
+func customerQualifies(conditions PromotionConditions, customer PricingCustomer) bool {
+	if conditions.FirstOrder && !customer.FirstOrder {
+		return false
+	}
+	if len(conditions.Segments) == 0 {
+		return true
+	}
+	for _, wanted := range conditions.Segments {
+		for _, segment := range customer.Segments {
+			if wanted == segment {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func lineMatches(conditions PromotionConditions, line PricingLine) bool {
+	if len(conditions.ProductIDs) > 0 && !containsInt(conditions.ProductIDs, line.ProductID) {
+		return false
+	}
+	if len(conditions.BrandIDs) > 0 && (line.BrandID == nil || !containsInt(conditions.BrandIDs, *line.BrandID)) {
+		return false
+	}
+	if len(conditions.CategoryIDs) > 0 {
+		found := false
+		for _, id := range line.CategoryIDs {
+			if containsInt(conditions.CategoryIDs, id) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
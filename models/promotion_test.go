@@ -0,0 +1,221 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriceCart(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	running := func(p Promotion) Promotion {
+		p.Active = true
+		p.StartDate = now.Add(-time.Hour)
+		p.EndDate = now.Add(time.Hour)
+		return p
+	}
+	percent := func(v float64) *float64 { return &v }
+	brand := 7
+
+	tests := []struct {
+		name         string
+		lines        []PricingLine
+		customer     PricingCustomer
+		promotions   []Promotion
+		wantLines    []float64 // each line's total
+		wantOffer    float64
+		wantPromo    float64
+		wantTotal    float64
+		wantFlash    []int // each line's flash sale units
+		freeShipping bool
+	}{
+		{
+			name:      "no offers or promotions",
+			lines:     []PricingLine{{ProductID: 1, Quantity: 2, UnitPrice: 100}},
+			wantLines: []float64{200},
+			wantTotal: 200,
+		},
+		{
+			name:      "product offer",
+			lines:     []PricingLine{{ProductID: 1, Quantity: 2, UnitPrice: 100, OfferPercentage: percent(10)}},
+			wantLines: []float64{180},
+			wantOffer: 20,
+			wantTotal: 180,
+		},
+		{
+			name: "flash sale beating the offer prices only the units it has",
+			lines: []PricingLine{{ProductID: 1, Quantity: 3, UnitPrice: 100, OfferPercentage: percent(10),
+				FlashSale: &FlashSaleLine{ItemID: 1, Percentage: 50, Units: 1}}},
+			wantLines: []float64{230},
+			wantOffer: 70,
+			wantTotal: 230,
+			wantFlash: []int{1},
+		},
+		{
+			name: "flash sale units capped at the line quantity",
+			lines: []PricingLine{{ProductID: 1, Quantity: 2, UnitPrice: 100,
+				FlashSale: &FlashSaleLine{ItemID: 1, Percentage: 25, Units: 5}}},
+			wantLines: []float64{150},
+			wantOffer: 50,
+			wantTotal: 150,
+			wantFlash: []int{2},
+		},
+		{
+			name: "flash sale no better than the offer is ignored",
+			lines: []PricingLine{{ProductID: 1, Quantity: 2, UnitPrice: 100, OfferPercentage: percent(20),
+				FlashSale: &FlashSaleLine{ItemID: 1, Percentage: 20, Units: 2}}},
+			wantLines: []float64{160},
+			wantOffer: 40,
+			wantTotal: 160,
+			wantFlash: []int{0},
+		},
+		{
+			name: "sold out flash sale is ignored",
+			lines: []PricingLine{{ProductID: 1, Quantity: 1, UnitPrice: 100,
+				FlashSale: &FlashSaleLine{ItemID: 1, Percentage: 50, Units: 0}}},
+			wantLines: []float64{100},
+			wantTotal: 100,
+			wantFlash: []int{0},
+		},
+		{
+			name:  "percentage promotion works on the price after offers",
+			lines: []PricingLine{{ProductID: 1, Quantity: 1, UnitPrice: 200, OfferPercentage: percent(50)}},
+			promotions: []Promotion{running(Promotion{ID: 1, Name: "10 off",
+				ActionType: PromotionPercentage, Action: PromotionAction{Percentage: 10}})},
+			wantLines: []float64{90},
+			wantOffer: 100,
+			wantPromo: 10,
+			wantTotal: 90,
+		},
+		{
+			name: "fixed amount is split across matching lines",
+			lines: []PricingLine{
+				{ProductID: 1, Quantity: 1, UnitPrice: 300},
+				{ProductID: 2, Quantity: 1, UnitPrice: 100},
+			},
+			promotions: []Promotion{running(Promotion{ID: 1, Name: "40 off",
+				ActionType: PromotionFixedAmount, Action: PromotionAction{Amount: 40}})},
+			wantLines: []float64{270, 90},
+			wantPromo: 40,
+			wantTotal: 360,
+		},
+		{
+			name:  "buy two get one free takes the cheapest unit",
+			lines: []PricingLine{{ProductID: 1, Quantity: 2, UnitPrice: 100}, {ProductID: 2, Quantity: 1, UnitPrice: 40}},
+			promotions: []Promotion{running(Promotion{ID: 1, Name: "B2G1",
+				ActionType: PromotionBuyXGetY, Action: PromotionAction{BuyQuantity: 2, GetQuantity: 1}})},
+			wantLines: []float64{200, 0},
+			wantPromo: 40,
+			wantTotal: 200,
+		},
+		{
+			name:  "tiered promotion uses the highest tier reached",
+			lines: []PricingLine{{ProductID: 1, Quantity: 5, UnitPrice: 100}},
+			promotions: []Promotion{running(Promotion{ID: 1, Name: "Bulk", ActionType: PromotionTiered,
+				Action: PromotionAction{Tiers: []PromotionTier{{MinQuantity: 2, Percentage: 5}, {MinQuantity: 5, Percentage: 10}, {MinQuantity: 10, Percentage: 20}}}})},
+			wantLines: []float64{450},
+			wantPromo: 50,
+			wantTotal: 450,
+		},
+		{
+			name: "conditions limit the promotion to matching lines",
+			lines: []PricingLine{
+				{ProductID: 1, Quantity: 1, UnitPrice: 100, BrandID: &brand},
+				{ProductID: 2, Quantity: 1, UnitPrice: 100, CategoryIDs: []int{3, 1}},
+				{ProductID: 3, Quantity: 1, UnitPrice: 100},
+			},
+			promotions: []Promotion{
+				running(Promotion{ID: 1, Name: "Brand", Conditions: PromotionConditions{BrandIDs: []int{brand}},
+					ActionType: PromotionPercentage, Action: PromotionAction{Percentage: 10}}),
+				running(Promotion{ID: 2, Name: "Category", Conditions: PromotionConditions{CategoryIDs: []int{1}},
+					ActionType: PromotionPercentage, Action: PromotionAction{Percentage: 20}}),
+			},
+			wantLines: []float64{90, 80, 100},
+			wantPromo: 30,
+			wantTotal: 270,
+		},
+		{
+			name:  "minimum subtotal not met",
+			lines: []PricingLine{{ProductID: 1, Quantity: 1, UnitPrice: 100}},
+			promotions: []Promotion{running(Promotion{ID: 1, Name: "Big spender", Conditions: PromotionConditions{MinSubtotal: 500},
+				ActionType: PromotionPercentage, Action: PromotionAction{Percentage: 10}})},
+			wantLines: []float64{100},
+			wantTotal: 100,
+		},
+		{
+			name:     "segment and first order conditions",
+			lines:    []PricingLine{{ProductID: 1, Quantity: 1, UnitPrice: 100}},
+			customer: PricingCustomer{Segments: []string{SegmentNew}, FirstOrder: true},
+			promotions: []Promotion{
+				running(Promotion{ID: 1, Name: "VIP", Conditions: PromotionConditions{Segments: []string{SegmentVIP}},
+					ActionType: PromotionPercentage, Action: PromotionAction{Percentage: 50}}),
+				running(Promotion{ID: 2, Name: "Welcome", Conditions: PromotionConditions{FirstOrder: true},
+					ActionType: PromotionPercentage, Action: PromotionAction{Percentage: 10}}),
+			},
+			wantLines: []float64{90},
+			wantPromo: 10,
+			wantTotal: 90,
+		},
+		{
+			name:  "inactive and expired promotions are skipped",
+			lines: []PricingLine{{ProductID: 1, Quantity: 1, UnitPrice: 100}},
+			promotions: []Promotion{
+				{ID: 1, Name: "Off", ActionType: PromotionPercentage, Action: PromotionAction{Percentage: 10},
+					StartDate: now.Add(-time.Hour), EndDate: now.Add(time.Hour)},
+				{ID: 2, Name: "Over", Active: true, ActionType: PromotionPercentage, Action: PromotionAction{Percentage: 10},
+					StartDate: now.Add(-2 * time.Hour), EndDate: now.Add(-time.Hour)},
+			},
+			wantLines: []float64{100},
+			wantTotal: 100,
+		},
+		{
+			name:  "exclusive promotion keeps lower priorities off its lines",
+			lines: []PricingLine{{ProductID: 1, Quantity: 1, UnitPrice: 100}, {ProductID: 2, Quantity: 1, UnitPrice: 100}},
+			promotions: []Promotion{
+				running(Promotion{ID: 1, Name: "Everything", Priority: 1,
+					ActionType: PromotionPercentage, Action: PromotionAction{Percentage: 10}}),
+				running(Promotion{ID: 2, Name: "Exclusive", Priority: 5, Exclusive: true, Conditions: PromotionConditions{ProductIDs: []int{1}},
+					ActionType: PromotionPercentage, Action: PromotionAction{Percentage: 30}}),
+			},
+			wantLines: []float64{70, 90},
+			wantPromo: 40,
+			wantTotal: 160,
+		},
+		{
+			name:         "free shipping only flags the cart",
+			lines:        []PricingLine{{ProductID: 1, Quantity: 1, UnitPrice: 100}},
+			promotions:   []Promotion{running(Promotion{ID: 1, Name: "Ship free", ActionType: PromotionFreeShipping})},
+			wantLines:    []float64{100},
+			wantTotal:    100,
+			freeShipping: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pricing := PriceCart(tt.lines, tt.customer, tt.promotions, now)
+
+			for i, want := range tt.wantLines {
+				if got := pricing.Lines[i].Total; got != want {
+					t.Errorf("line %d total = %v, want %v", i, got, want)
+				}
+			}
+			for i, want := range tt.wantFlash {
+				if got := pricing.Lines[i].FlashSaleUnits; got != want {
+					t.Errorf("line %d flash sale units = %v, want %v", i, got, want)
+				}
+			}
+			if pricing.OfferDiscount != tt.wantOffer {
+				t.Errorf("offer discount = %v, want %v", pricing.OfferDiscount, tt.wantOffer)
+			}
+			if pricing.PromotionDiscount != tt.wantPromo {
+				t.Errorf("promotion discount = %v, want %v", pricing.PromotionDiscount, tt.wantPromo)
+			}
+			if pricing.Total != tt.wantTotal {
+				t.Errorf("total = %v, want %v", pricing.Total, tt.wantTotal)
+			}
+			if pricing.FreeShipping != tt.freeShipping {
+				t.Errorf("free shipping = %v, want %v", pricing.FreeShipping, tt.freeShipping)
+			}
+		})
+	}
+}
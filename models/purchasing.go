@@ -0,0 +1,97 @@
+package models
+
+import "time"
+
+const (
+	PurchaseOrderDraft             = "Draft"
+	PurchaseOrderOrdered           = "Ordered"
+	PurchaseOrderPartiallyReceived = "Partially Received"
+	PurchaseOrderReceived          = "Received"
+	PurchaseOrderCancelled         = "Cancelled"
+)
+
+type Supplier struct {
+	ID          int    `json:"id" db:"id"`
+	Name        string `json:"name" db:"name"`
+	ContactName string `json:"contact_name" db:"contact_name"`
+	Email       string `json:"email" db:"email"`
+	Phone       string `json:"phone" db:"phone"`
+	Address     string `json:"address" db:"address"`
+	Active      bool   `json:"active" db:"active"`
+}
+
+type PurchaseOrder struct {
+	ID           int                 `json:"id" db:"id"`
+	PONumber     string              `json:"po_number" db:"po_number"`
+	SupplierID   int                 `json:"supplier_id" db:"supplier_id"`
+	SupplierName string              `json:"supplier_name" db:"supplier_name"`
+	WarehouseID  int                 `json:"warehouse_id" db:"warehouse_id"`
+	Status       string              `json:"status" db:"status"`
+	ExpectedDate *time.Time          `json:"expected_date" db:"expected_date"`
+	Notes        string              `json:"notes" db:"notes"`
+	CreatedAt    time.Time           `json:"created_at" db:"created_at"`
+	Items        []PurchaseOrderItem `json:"items,omitempty" db:"-"`
+	Receipts     []GoodsReceipt      `json:"receipts,omitempty" db:"-"`
+}
+
+type PurchaseOrderItem struct {
+	ID               int     `json:"id" db:"id"`
+	ProductID        int     `json:"product_id" db:"product_id"`
+	ProductName      string  `json:"product_name" db:"product_name"`
+	QuantityOrdered  int     `json:"quantity_ordered" db:"quantity_ordered"`
+	QuantityReceived int     `json:"quantity_received" db:"quantity_received"`
+	UnitCost         float64 `json:"unit_cost" db:"unit_cost"`
+}
+
+type GoodsReceipt struct {
+	ID          int                `json:"id" db:"id"`
+	WarehouseID int                `json:"warehouse_id" db:"warehouse_id"`
+	LandedCost  float64            `json:"landed_cost" db:"landed_cost"`
+	Note        string             `json:"note" db:"note"`
+	ReceivedAt  time.Time          `json:"received_at" db:"received_at"`
+	Items       []GoodsReceiptItem `json:"items,omitempty" db:"-"`
+}
+
+type GoodsReceiptItem struct {
+	PurchaseOrderItemID int     `json:"purchase_order_item_id" db:"purchase_order_item_id"`
+	ProductID           int     `json:"product_id" db:"product_id"`
+	Quantity            int     `json:"quantity" db:"quantity"`
+	UnitCost            float64 `json:"unit_cost" db:"unit_cost"`
+	LandedUnitCost      float64 `json:"landed_unit_cost" db:"landed_unit_cost"`
+}
+
+// SpreadLandedCost shares a delivery's landed cost over its lines in
+// proportion to their value, or to their quantity when the goods were free,
+// and sets each line's landed unit cost.
+func SpreadLandedCost(items []GoodsReceiptItem, landedCost float64) {
+	var totalValue float64
+	var totalQuantity int
+	for _, item := range items {
+		totalValue += item.UnitCost * float64(item.Quantity)
+		totalQuantity += item.Quantity
+	}
+
+	for i := range items {
+		item := &items[i]
+		share := 0.0
+		switch {
+		case totalValue > 0:
+			share = landedCost * item.UnitCost * float64(item.Quantity) / totalValue
+		case totalQuantity > 0:
+			share = landedCost * float64(item.Quantity) / float64(totalQuantity)
+		}
+		item.LandedUnitCost = item.UnitCost + share/float64(item.Quantity)
+	}
+}
+
+// InventoryValuation values a product's stock at its weighted average landed
+// cost and prices the units sold in a period at the same cost.
+type InventoryValuation struct {
+	ProductID      int     `json:"product_id" db:"product_id"`
+	ProductName    string  `json:"product_name" db:"product_name"`
+	OnHand         int     `json:"on_hand" db:"on_hand"`
+	AverageCost    float64 `json:"average_cost" db:"average_cost"`
+	InventoryValue float64 `json:"inventory_value" db:"inventory_value"`
+	UnitsSold      int     `json:"units_sold" db:"units_sold"`
+	COGS           float64 `json:"cogs" db:"cogs"`
+}
@@ -0,0 +1,256 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	ReferralPending  = "Pending"
+	ReferralRewarded = "Rewarded"
+	ReferralRejected = "Rejected"
+	ReferralReversed = "Reversed"
+
+	ReferralRewardTransaction   = "Referral Reward"
+	ReferralReversalTransaction = "Referral Reversal"
+)
+
+// Reasons a referral is rejected.
+const (
+	ReferralSelfReferral = "self_referral"
+	ReferralSamePhone    = "same_phone"
+	ReferralSameDomain   = "same_email_domain"
+	ReferralSameDevice   = "same_device"
+)
+
+var ErrInvalidReferralCode = errors.New("invalid referral code")
+
+// publicEmailDomains are shared by unrelated customers, so two accounts on
+// one of them say nothing about who owns them.
+var publicEmailDomains = map[string]bool{
+	"gmail.com": true, "googlemail.com": true, "yahoo.com": true, "outlook.com": true,
+	"hotmail.com": true, "live.com": true, "icloud.com": true, "proton.me": true,
+	"protonmail.com": true, "aol.com": true, "rediffmail.com": true,
+}
+
+type ReferralSettings struct {
+	ReferrerReward float64 `json:"referrer_reward" db:"referrer_reward"`
+	RefereeReward  float64 `json:"referee_reward" db:"referee_reward"`
+	Active         bool    `json:"active" db:"active"`
+}
+
+type Referral struct {
+	ID              int        `json:"id" db:"id"`
+	RefereeName     string     `json:"referee_name" db:"referee_name"`
+	Status          string     `json:"status" db:"status"`
+	RejectionReason *string    `json:"rejection_reason,omitempty" db:"rejection_reason"`
+	ReferrerReward  *float64   `json:"reward,omitempty" db:"referrer_reward"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	RewardedAt      *time.Time `json:"rewarded_at,omitempty" db:"rewarded_at"`
+}
+
+// LoadReferralSettings reads the program's reward amounts.
+func LoadReferralSettings(db Querier) (ReferralSettings, error) {
+	var settings ReferralSettings
+	err := db.QueryRow(`SELECT referrer_reward, referee_reward, active FROM referral_settings`).
+		Scan(&settings.ReferrerReward, &settings.RefereeReward, &settings.Active)
+	return settings, err
+}
+
+// RecordUserDevice remembers that a customer used a device. Clients that do
+// not send a device id are not tracked.
+func RecordUserDevice(db Execer, userID int, deviceID string) error {
+	deviceID = strings.TrimSpace(deviceID)
+	if deviceID == "" {
+		return nil
+	}
+	if len(deviceID) > 100 {
+		deviceID = deviceID[:100]
+	}
+	_, err := db.Exec(`INSERT INTO user_devices (user_id, device_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, userID, deviceID)
+	return err
+}
+
+// FindReferrer returns the customer a referral code belongs to.
+func FindReferrer(db Querier, code string) (int, error) {
+	var referrerID int
+	query := `SELECT id FROM users WHERE referral_code = $1 AND blocked = false`
+	err := db.QueryRow(query, strings.ToUpper(strings.TrimSpace(code))).Scan(&referrerID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidReferralCode
+	}
+	return referrerID, err
+}
+
+type referralParty struct {
+	ID    int
+	Email string
+	Phone sql.NullString
+}
+
+// CreateReferral links a newly created customer to the owner of the referral
+// code they signed up with. Referrals that fail the fraud checks are stored
+// as rejected so they show up in reporting.
+func CreateReferral(db Querier, refereeID int, code, deviceID string) error {
+	referrerID, err := FindReferrer(db, code)
+	if err != nil {
+		return err
+	}
+
+	var referrer, referee referralParty
+	query := `SELECT id, email, phone FROM users WHERE id = $1`
+	if err := db.QueryRow(query, referrerID).Scan(&referrer.ID, &referrer.Email, &referrer.Phone); err != nil {
+		return err
+	}
+	if err := db.QueryRow(query, refereeID).Scan(&referee.ID, &referee.Email, &referee.Phone); err != nil {
+		return err
+	}
+
+	var sharedDevice bool
+	deviceQuery := `SELECT EXISTS (SELECT 1 FROM user_devices WHERE user_id = $1 AND device_id = $2)`
+	if deviceID = strings.TrimSpace(deviceID); deviceID != "" {
+		if err := db.QueryRow(deviceQuery, referrerID, deviceID).Scan(&sharedDevice); err != nil {
+			return err
+		}
+	}
+
+	status, reason := ReferralPending, referralFraudReason(referrer, referee, sharedDevice)
+	var rejection *string
+	if reason != "" {
+		status, rejection = ReferralRejected, &reason
+	}
+	_, err = db.Exec(`
+		INSERT INTO referrals (referrer_id, referee_id, status, rejection_reason)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (referee_id) DO NOTHING`, referrerID, refereeID, status, rejection)
+	return err
+}
+
+func referralFraudReason(referrer, referee referralParty, sharedDevice bool) string {
+	if referrer.ID == referee.ID || mailbox(referrer.Email) == mailbox(referee.Email) {
+		return ReferralSelfReferral
+	}
+	if referrer.Phone.Valid && referee.Phone.Valid && referrer.Phone.String != "" && referrer.Phone.String == referee.Phone.String {
+		return ReferralSamePhone
+	}
+	if sharedDevice {
+		return ReferralSameDevice
+	}
+	domain := emailDomain(referrer.Email)
+	if domain != "" && !publicEmailDomains[domain] && domain == emailDomain(referee.Email) {
+		return ReferralSameDomain
+	}
+	return ""
+}
+
+// mailbox reduces an address to the inbox it delivers to, so that plus
+// aliases and Gmail's ignored dots count as the same person.
+func mailbox(email string) string {
+	local, domain, found := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	if !found {
+		return local
+	}
+	local, _, _ = strings.Cut(local, "+")
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+func emailDomain(email string) string {
+	_, domain, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	return domain
+}
+
+// RewardReferral pays out a pending referral when the referred customer's
+// first order is delivered, crediting both wallets. It reports whether a
+// reward was paid.
+func RewardReferral(db Querier, refereeID, orderID int) (bool, error) {
+	var delivered int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM orders WHERE user_id = $1 AND status = 'Delivered'`, refereeID).Scan(&delivered); err != nil {
+		return false, err
+	}
+	if delivered != 1 {
+		return false, nil
+	}
+
+	settings, err := LoadReferralSettings(db)
+	if err != nil || !settings.Active {
+		return false, err
+	}
+
+	var referrerID int
+	err = db.QueryRow(`
+		UPDATE referrals
+		SET status = 'Rewarded', order_id = $2, referrer_reward = $3, referee_reward = $4, rewarded_at = NOW()
+		WHERE referee_id = $1 AND status = 'Pending'
+		RETURNING referrer_id`, refereeID, orderID, settings.ReferrerReward, settings.RefereeReward).Scan(&referrerID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	credits := []struct {
+		userID int
+		amount float64
+	}{{referrerID, settings.ReferrerReward}, {refereeID, settings.RefereeReward}}
+	for _, credit := range credits {
+		if credit.amount <= 0 {
+			continue
+		}
+		if _, err := db.Exec(`UPDATE users SET wallet_balance = wallet_balance + $1 WHERE id = $2`, credit.amount, credit.userID); err != nil {
+			return false, err
+		}
+		_, err := db.Exec(`INSERT INTO wallet_transactions (user_id, order_id, amount, transaction_type) VALUES ($1, $2, $3, $4)`,
+			credit.userID, orderID, credit.amount, ReferralRewardTransaction)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// ReverseReferral takes back a referral reward when the order that earned it
+// is returned, debiting both wallets by what they were credited. A wallet
+// that has already spent the reward goes negative. It reports whether a
+// reward was reversed.
+func ReverseReferral(db Querier, refereeID, orderID int) (bool, error) {
+	var referrerID int
+	var referrerReward, refereeReward float64
+	err := db.QueryRow(`
+		UPDATE referrals
+		SET status = 'Reversed', reversed_at = NOW()
+		WHERE referee_id = $1 AND order_id = $2 AND status = 'Rewarded'
+		RETURNING referrer_id, COALESCE(referrer_reward, 0), COALESCE(referee_reward, 0)`, refereeID, orderID).
+		Scan(&referrerID, &referrerReward, &refereeReward)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	debits := []struct {
+		userID int
+		amount float64
+	}{{referrerID, referrerReward}, {refereeID, refereeReward}}
+	for _, debit := range debits {
+		if debit.amount <= 0 {
+			continue
+		}
+		if _, err := db.Exec(`UPDATE users SET wallet_balance = wallet_balance - $1 WHERE id = $2`, debit.amount, debit.userID); err != nil {
+			return false, err
+		}
+		_, err := db.Exec(`INSERT INTO wallet_transactions (user_id, order_id, amount, transaction_type) VALUES ($1, $2, $3, $4)`,
+			debit.userID, orderID, -debit.amount, ReferralReversalTransaction)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -1,8 +1,26 @@
 package responsemodels
 
+import "horizon/models"
+
 type ViewCategory struct {
+	ID          int    `json:"id"`
+	ParentID    *int   `json:"parent_id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	Slug        string `json:"slug"`
+	SortOrder   int    `json:"sort_order"`
+	ImageURL    string `json:"image_url,omitempty"`
+}
+
+type CategoryNode struct {
+	ViewCategory
+	Children []*CategoryNode `json:"children"`
+}
+
+type Breadcrumb struct {
+	ID   int    `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	Slug string `json:"slug" db:"slug"`
 }
 
 type ViewProducts struct {
@@ -12,6 +30,7 @@ type ViewProducts struct {
 	Price        float64 `json:"price"`
 	CategoryName string  `json:"category_name"`
 	Status       string  `json:"status"`
+	ThumbnailURL string  `json:"thumbnail_url,omitempty"`
 }
 type UserProfile struct {
 	Name  string `json:"name"`
@@ -25,11 +44,18 @@ type AddressUser struct {
 	ZipCode     string `json:"zip_code"`
 }
 type ViewCartItem struct {
-	ID       int     `json:"id"`
-	Name     string  `json:"name"`
-	Price    float64 `json:"price"`
-	Quantity int     `json:"quantity"`
-	Subtotal float64 `json:"subtotal"`
+	ID           int     `json:"id"`
+	Name         string  `json:"name"`
+	Price        float64 `json:"price"`
+	Quantity     int     `json:"quantity"`
+	Subtotal     float64 `json:"subtotal"`
+	ThumbnailURL string  `json:"thumbnail_url,omitempty"`
+
+	FlashSaleUnits    int                       `json:"flash_sale_units,omitempty"`
+	OfferDiscount     float64                   `json:"offer_discount"`
+	PromotionDiscount float64                   `json:"promotion_discount"`
+	Total             float64                   `json:"total"`
+	Promotions        []models.AppliedPromotion `json:"promotions"`
 }
 
 type OrderDetail struct {
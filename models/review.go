@@ -0,0 +1,87 @@
+package models
+
+import (
+	"horizon/config"
+	"horizon/utils"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ReviewPending  = "Pending"
+	ReviewApproved = "Approved"
+	ReviewHidden   = "Hidden"
+)
+
+type ReviewPhoto struct {
+	ID           int    `json:"id" db:"id"`
+	ReviewID     int    `json:"-" db:"review_id"`
+	ImageKey     string `json:"-" db:"image_key"`
+	ThumbnailKey string `json:"-" db:"thumbnail_key"`
+	URL          string `json:"url" db:"-"`
+	ThumbnailURL string `json:"thumbnail_url" db:"-"`
+}
+
+type Review struct {
+	ID           int           `json:"id" db:"id"`
+	ProductID    int           `json:"product_id" db:"product_id"`
+	UserID       int           `json:"-" db:"user_id"`
+	UserName     string        `json:"user_name" db:"user_name"`
+	Rating       int           `json:"rating" db:"rating"`
+	Title        string        `json:"title" db:"title"`
+	Body         string        `json:"body" db:"body"`
+	Status       string        `json:"status" db:"status"`
+	HelpfulCount int           `json:"helpful_count" db:"helpful_count"`
+	CreatedAt    time.Time     `json:"created_at" db:"created_at"`
+	Photos       []ReviewPhoto `json:"photos" db:"-"`
+}
+
+// RefreshProductRating recomputes the stored average rating and count of a
+// product from its approved reviews.
+func RefreshProductRating(productID int) error {
+	query := `
+		UPDATE products p
+		SET avg_rating = COALESCE(r.avg_rating, 0), rating_count = COALESCE(r.rating_count, 0)
+		FROM (
+			SELECT ROUND(AVG(rating), 2) AS avg_rating, COUNT(*) AS rating_count
+			FROM product_reviews
+			WHERE product_id = $1 AND status = 'Approved'
+		) r
+		WHERE p.id = $1`
+	_, err := config.DB.Exec(query, productID)
+	return err
+}
+
+// AttachReviewPhotos loads the photos of the given reviews with URLs resolved
+// against the configured storage.
+func AttachReviewPhotos(reviews []Review) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(reviews))
+	for i, review := range reviews {
+		ids[i] = int64(review.ID)
+	}
+
+	var photos []ReviewPhoto
+	query := `SELECT id, review_id, image_key, thumbnail_key FROM review_photos WHERE review_id = ANY($1) ORDER BY sort_order, id`
+	if err := config.DB.Select(&photos, query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	store := utils.Storage()
+	byReview := map[int][]ReviewPhoto{}
+	for _, photo := range photos {
+		photo.URL = store.URL(photo.ImageKey)
+		photo.ThumbnailURL = store.URL(photo.ThumbnailKey)
+		byReview[photo.ReviewID] = append(byReview[photo.ReviewID], photo)
+	}
+	for i := range reviews {
+		reviews[i].Photos = byReview[reviews[i].ID]
+		if reviews[i].Photos == nil {
+			reviews[i].Photos = []ReviewPhoto{}
+		}
+	}
+	return nil
+}
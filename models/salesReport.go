@@ -4,6 +4,7 @@ type SalesItem struct {
 	ProductID           int     `db:"product_id"`
 	ProductName         string  `db:"product_name"`
 	ProductDescription  string  `db:"product_description"`
+	BrandName           string  `db:"brand_name"`
 	TotalQuantity       int     `db:"total_quantity"`
 	TotalAmount         float64 `db:"total_amount"`
 	TotalOfferDiscount  float64 `db:"total_offer_discount"`
@@ -19,4 +20,11 @@ type SalesReport struct {
 	TotalRevenue    float64
 	TotalDiscount   float64
 	Items           []SalesItem
+	Brands          []BrandSales
+}
+
+type BrandSales struct {
+	BrandName     string  `db:"brand_name"`
+	TotalQuantity int     `db:"total_quantity"`
+	TotalAmount   float64 `db:"total_amount"`
 }
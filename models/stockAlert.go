@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type StockAlert struct {
+	ID           int        `json:"id" db:"id"`
+	ProductID    int        `json:"product_id" db:"product_id"`
+	ProductName  string     `json:"product_name" db:"product_name"`
+	Stock        int        `json:"stock" db:"stock"`
+	Threshold    int        `json:"threshold" db:"threshold"`
+	CurrentStock int        `json:"current_stock" db:"current_stock"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	ResolvedAt   *time.Time `json:"resolved_at" db:"resolved_at"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"horizon/config"
+	"time"
 )
 
 type User struct {
@@ -42,12 +43,26 @@ func (u *UserDet) FindByEmail(email string) error {
 	return config.DB.QueryRow(query, email).Scan(&u.ID, &u.Name, &u.Email, &u.Verified)
 }
 func (u *UserDet) Create() error {
-	query := "INSERT INTO users (name, email, verified) VALUES ($1, $2, $3)"
-	_, err := config.DB.Exec(query, u.Name, u.Email, u.Verified)
-	return err
+	query := "INSERT INTO users (name, email, verified) VALUES ($1, $2, $3) RETURNING id"
+	return config.DB.QueryRow(query, u.Name, u.Email, u.Verified).Scan(&u.ID)
 }
 func (u *UserDet) Update() error {
 	query := "UPDATE users SET verified = $1 WHERE email = $2"
 	_, err := config.DB.Exec(query, u.Verified, u.Email)
 	return err
 }
+
+type DeletionRequest struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	UserName     string    `json:"user_name"`
+	UserEmail    string    `json:"user_email"`
+	Reason       string    `json:"reason"`
+	Status       string    `json:"status"`
+	RequestedAt  time.Time `json:"requested_at"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+	// WalletBalance is left for an admin to refund; deletion does not
+	// touch it.
+	WalletBalance  float64 `json:"wallet_balance"`
+	OrdersInFlight int     `json:"orders_in_flight"`
+}
@@ -0,0 +1,349 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StockReasonReceived        = "received"
+	StockReasonDamage          = "damage"
+	StockReasonCountCorrection = "count_correction"
+	StockReasonSale            = "sale"
+	StockReasonReturn          = "return"
+	StockReasonCancellation    = "cancellation"
+	StockReasonTransferOut     = "transfer_out"
+	StockReasonTransferIn      = "transfer_in"
+)
+
+// ManualStockReasons are the reasons an admin may give for an adjustment;
+// the rest are recorded by the system.
+var ManualStockReasons = map[string]bool{
+	StockReasonReceived:        true,
+	StockReasonDamage:          true,
+	StockReasonCountCorrection: true,
+}
+
+var ErrInsufficientWarehouseStock = errors.New("not enough stock in this warehouse")
+
+// Querier is satisfied by both the database handle and a transaction.
+type Querier interface {
+	Execer
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type Warehouse struct {
+	ID          int    `json:"id" db:"id"`
+	Name        string `json:"name" db:"name"`
+	AddressLine string `json:"address_line" db:"address_line"`
+	City        string `json:"city" db:"city"`
+	ZipCode     string `json:"zip_code" db:"zip_code"`
+	IsDefault   bool   `json:"is_default" db:"is_default"`
+	Active      bool   `json:"active" db:"active"`
+}
+
+type WarehouseStock struct {
+	WarehouseID   int    `json:"warehouse_id" db:"warehouse_id"`
+	WarehouseName string `json:"warehouse_name" db:"warehouse_name"`
+	Quantity      int    `json:"quantity" db:"quantity"`
+}
+
+type StockAdjustment struct {
+	ID          int       `json:"id" db:"id"`
+	ProductID   int       `json:"product_id" db:"product_id"`
+	WarehouseID int       `json:"warehouse_id" db:"warehouse_id"`
+	Delta       int       `json:"delta" db:"delta"`
+	Reason      string    `json:"reason" db:"reason"`
+	Note        string    `json:"note" db:"note"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+type StockTransfer struct {
+	ID              int        `json:"id" db:"id"`
+	ProductID       int        `json:"product_id" db:"product_id"`
+	FromWarehouseID int        `json:"from_warehouse_id" db:"from_warehouse_id"`
+	ToWarehouseID   int        `json:"to_warehouse_id" db:"to_warehouse_id"`
+	Quantity        int        `json:"quantity" db:"quantity"`
+	Status          string     `json:"status" db:"status"`
+	Note            string     `json:"note" db:"note"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	CompletedAt     *time.Time `json:"completed_at" db:"completed_at"`
+}
+
+// AdjustStock changes a product's stock at one warehouse by delta, keeps the
+// product's total in step and records the movement. Only sales may take a
+// location below zero: by then the customer has paid, so the shortfall is
+// left visible rather than failing the order.
+func AdjustStock(db Querier, productID, warehouseID, delta int, reason, note string) error {
+	return adjustStock(db, productID, warehouseID, delta, reason, note, nil)
+}
+
+// adjustStock is AdjustStock for movements that belong to an order. The
+// product row is locked before any warehouse row, the same order checkout
+// takes them in, so that the two cannot deadlock.
+func adjustStock(db Querier, productID, warehouseID, delta int, reason, note string, orderID *int) error {
+	if _, err := db.Exec(`SELECT id FROM products WHERE id = $1 FOR UPDATE`, productID); err != nil {
+		return err
+	}
+
+	if delta < 0 && reason != StockReasonSale {
+		result, err := db.Exec(`
+			UPDATE warehouse_stock SET quantity = quantity + $3, updated_at = NOW()
+			WHERE warehouse_id = $1 AND product_id = $2 AND quantity + $3 >= 0`,
+			warehouseID, productID, delta)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return ErrInsufficientWarehouseStock
+		}
+	} else {
+		_, err := db.Exec(`
+			INSERT INTO warehouse_stock (warehouse_id, product_id, quantity)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (warehouse_id, product_id) DO UPDATE
+			SET quantity = warehouse_stock.quantity + EXCLUDED.quantity, updated_at = NOW()`,
+			warehouseID, productID, delta)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := db.Exec(`UPDATE products SET stock = stock + $1, updated_at = NOW() WHERE id = $2`, delta, productID); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO stock_adjustments (product_id, warehouse_id, delta, reason, note, order_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)`,
+		productID, warehouseID, delta, reason, note, orderID)
+	return err
+}
+
+// DefaultWarehouseID returns the warehouse that holds stock not yet assigned
+// to a specific location.
+func DefaultWarehouseID(db Querier) (int, error) {
+	var id int
+	err := db.QueryRow(`SELECT id FROM warehouses WHERE is_default`).Scan(&id)
+	return id, err
+}
+
+// SetTotalStock moves a product's total stock to quantity. It serves the
+// callers that still think of stock as one number, such as product edits and
+// imports: increases go to the default warehouse, and decreases come out of
+// the default warehouse first and then the others, fullest first. It fails
+// with ErrInsufficientWarehouseStock when the warehouses do not hold enough.
+func SetTotalStock(db Querier, productID, quantity int, note string) error {
+	var current int
+	if err := db.QueryRow(`SELECT stock FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&current); err != nil {
+		return err
+	}
+	if quantity == current {
+		return nil
+	}
+
+	if quantity > current {
+		warehouseID, err := DefaultWarehouseID(db)
+		if err != nil {
+			return err
+		}
+		return AdjustStock(db, productID, warehouseID, quantity-current, StockReasonCountCorrection, note)
+	}
+
+	rows, err := db.Query(`
+		SELECT s.warehouse_id, s.quantity
+		FROM warehouse_stock s
+		JOIN warehouses w ON w.id = s.warehouse_id
+		WHERE s.product_id = $1 AND s.quantity > 0
+		ORDER BY w.is_default DESC, s.quantity DESC, w.id`, productID)
+	if err != nil {
+		return err
+	}
+	type held struct{ warehouseID, quantity int }
+	var locations []held
+	for rows.Next() {
+		var location held
+		if err := rows.Scan(&location.warehouseID, &location.quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		locations = append(locations, location)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	remaining := current - quantity
+	for _, location := range locations {
+		if remaining == 0 {
+			break
+		}
+		take := location.quantity
+		if take > remaining {
+			take = remaining
+		}
+		if err := AdjustStock(db, productID, location.warehouseID, -take, StockReasonCountCorrection, note); err != nil {
+			return err
+		}
+		remaining -= take
+	}
+	if remaining > 0 {
+		return ErrInsufficientWarehouseStock
+	}
+	return nil
+}
+
+type allocationCandidate struct {
+	warehouseID int
+	zipCode     string
+	available   int
+}
+
+// AllocateOrderLine chooses the warehouses that fill an order line and takes
+// the units out of them. The nearest warehouse, by zip code, that can ship
+// the whole line wins; when no single location has enough, the line is split
+// nearest first. Any remainder that no warehouse can cover goes to the
+// nearest one. The product row stays locked until the transaction ends, so
+// concurrent orders allocate its stock one at a time.
+func AllocateOrderLine(db Querier, orderID, orderItemID, productID, quantity int, zipCode string) error {
+	if _, err := db.Exec(`SELECT id FROM products WHERE id = $1 FOR UPDATE`, productID); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT w.id, w.zip_code, COALESCE(s.quantity, 0)
+		FROM warehouses w
+		LEFT JOIN warehouse_stock s ON s.warehouse_id = w.id AND s.product_id = $1
+		WHERE w.active
+		ORDER BY w.id`, productID)
+	if err != nil {
+		return err
+	}
+	var candidates []allocationCandidate
+	for rows.Next() {
+		var candidate allocationCandidate
+		if err := rows.Scan(&candidate.warehouseID, &candidate.zipCode, &candidate.available); err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, candidate)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		return errors.New("no active warehouse to allocate from")
+	}
+
+	note := "Order " + strconv.Itoa(orderID)
+	for warehouseID, qty := range planAllocation(candidates, quantity, zipCode) {
+		_, err := db.Exec(`INSERT INTO order_item_allocations (order_item_id, warehouse_id, quantity) VALUES ($1, $2, $3)`,
+			orderItemID, warehouseID, qty)
+		if err != nil {
+			return err
+		}
+		if err := adjustStock(db, productID, warehouseID, -qty, StockReasonSale, note, &orderID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func planAllocation(candidates []allocationCandidate, quantity int, zipCode string) map[int]int {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return zipDistance(candidates[i].zipCode, zipCode) < zipDistance(candidates[j].zipCode, zipCode)
+	})
+
+	plan := map[int]int{}
+	for _, candidate := range candidates {
+		if candidate.available >= quantity {
+			plan[candidate.warehouseID] = quantity
+			return plan
+		}
+	}
+
+	remaining := quantity
+	for _, candidate := range candidates {
+		if remaining == 0 {
+			break
+		}
+		if candidate.available <= 0 {
+			continue
+		}
+		take := candidate.available
+		if take > remaining {
+			take = remaining
+		}
+		plan[candidate.warehouseID] += take
+		remaining -= take
+	}
+	if remaining > 0 {
+		plan[candidates[0].warehouseID] += remaining
+	}
+	return plan
+}
+
+// zipDistance approximates how far apart two postal codes are. Codes are
+// assigned geographically, so the numeric difference is a fair proxy; a code
+// that cannot be compared sorts last.
+func zipDistance(a, b string) float64 {
+	x, errA := strconv.Atoi(strings.TrimSpace(a))
+	y, errB := strconv.Atoi(strings.TrimSpace(b))
+	if errA != nil || errB != nil {
+		return math.Inf(1)
+	}
+	return math.Abs(float64(x - y))
+}
+
+// RestockOrder puts back the stock an order still has out, in the
+// warehouses it came from, and returns the products restocked. It works from
+// the order's own stock movements, so an order is never restocked twice and
+// one that never took stock gets nothing back. The order row is locked to
+// keep concurrent status changes from both restocking.
+func RestockOrder(db Querier, orderID int, reason, note string) ([]int, error) {
+	if _, err := db.Exec(`SELECT id FROM orders WHERE id = $1 FOR UPDATE`, orderID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT product_id, warehouse_id, -SUM(delta)
+		FROM stock_adjustments
+		WHERE order_id = $1 AND reason IN ('sale', 'cancellation', 'return')
+		GROUP BY product_id, warehouse_id
+		HAVING SUM(delta) < 0
+		ORDER BY product_id, warehouse_id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	type outstanding struct{ productID, warehouseID, quantity int }
+	var lines []outstanding
+	for rows.Next() {
+		var line outstanding
+		if err := rows.Scan(&line.productID, &line.warehouseID, &line.quantity); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var productIDs []int
+	for _, line := range lines {
+		if err := adjustStock(db, line.productID, line.warehouseID, line.quantity, reason, note, &orderID); err != nil {
+			return nil, err
+		}
+		productIDs = append(productIDs, line.productID)
+	}
+	return productIDs, nil
+}
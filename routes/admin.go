@@ -10,12 +10,20 @@ import (
 func AdminRoutes(app *fiber.App) {
 
 	//Authorization
-	app.Post("/admin/login", admin.AdminLogin)
+	app.Post("/admin/login", middleware.LoginThrottle(middleware.ThrottleConfig{
+		Scope:      "admin",
+		AccountKey: middleware.BodyField("username"),
+	}), admin.AdminLogin)
+
+	//Login Lockouts
+	app.Get("/admin/lockouts", middleware.AdminJWT, admin.ViewLockouts)
+	app.Delete("/admin/lockouts/:id", middleware.AdminJWT, admin.ClearLockout)
 
 	//User Management
 	app.Get("/admin/users", middleware.AdminJWT, admin.ViewUsers)
 	app.Post("/admin/block-user", middleware.AdminJWT, admin.BlockUser)
 	app.Post("/admin/unblock-user", middleware.AdminJWT, admin.UnblockUser)
+	app.Get("/admin/deletion-requests", middleware.AdminJWT, admin.ViewDeletionRequests)
 
 	//Category Management
 	app.Post("/admin/add-category", middleware.AdminJWT, admin.AddCategory)
@@ -23,6 +31,10 @@ func AdminRoutes(app *fiber.App) {
 	app.Delete("/admin/delete-category/:id", middleware.AdminJWT, admin.SoftDeleteCategory)
 	app.Post("/admin/recover-category/:id", middleware.AdminJWT, admin.RecoverCategory)
 	app.Get("/admin/view-categories", middleware.AdminJWT, admin.AdminViewCategories)
+	app.Get("/admin/categories/:id/attributes", middleware.AdminJWT, admin.ViewCategoryAttributes)
+	app.Post("/admin/categories/:id/attributes", middleware.AdminJWT, admin.AddAttribute)
+	app.Put("/admin/attributes/:id", middleware.AdminJWT, admin.EditAttribute)
+	app.Delete("/admin/attributes/:id", middleware.AdminJWT, admin.DeleteAttribute)
 
 	//Product Management
 	app.Post("/admin/add-products", middleware.AdminJWT, admin.AddProduct)
@@ -31,16 +43,90 @@ func AdminRoutes(app *fiber.App) {
 	app.Post("/admin/recover-product/:id", middleware.AdminJWT, admin.RecoverProduct)
 	app.Get("/admin/view-products", middleware.AdminJWT, admin.AdminViewProducts)
 	app.Put("/admin/update-stock", middleware.AdminJWT, admin.UpdateProductStock)
+	app.Put("/admin/products/:id/reorder-threshold", middleware.AdminJWT, admin.SetReorderThreshold)
+	app.Get("/admin/stock-alerts", middleware.AdminJWT, admin.ViewStockAlerts)
+	app.Post("/admin/products/import", middleware.AdminJWT, admin.ImportProducts)
+	app.Get("/admin/products/imports/:id", middleware.AdminJWT, admin.ViewImportJob)
+	app.Get("/admin/products/export", middleware.AdminJWT, admin.ExportProducts)
+	app.Get("/admin/products/:id/price-history", middleware.AdminJWT, admin.ViewPriceHistory)
+	app.Post("/admin/products/:id/price-schedule", middleware.AdminJWT, admin.SchedulePriceChange)
+	app.Delete("/admin/price-schedule/:id", middleware.AdminJWT, admin.CancelScheduledPriceChange)
+	app.Put("/admin/products/:id/attributes", middleware.AdminJWT, admin.SetProductAttributes)
+	app.Post("/admin/products/:id/images", middleware.AdminJWT, admin.UploadProductImages)
+	app.Put("/admin/products/:id/images/order", middleware.AdminJWT, admin.ReorderProductImages)
+	app.Put("/admin/products/:id/images/:image_id/primary", middleware.AdminJWT, admin.SetPrimaryProductImage)
+	app.Delete("/admin/products/:id/images/:image_id", middleware.AdminJWT, admin.DeleteProductImage)
+
+	//Warehouses & Inventory
+	app.Post("/admin/warehouses", middleware.AdminJWT, admin.AddWarehouse)
+	app.Put("/admin/warehouses/:id", middleware.AdminJWT, admin.EditWarehouse)
+	app.Get("/admin/warehouses", middleware.AdminJWT, admin.AdminViewWarehouses)
+	app.Get("/admin/products/:id/stock", middleware.AdminJWT, admin.ViewProductStock)
+	app.Get("/admin/stock-adjustments", middleware.AdminJWT, admin.ViewStockAdjustments)
+	app.Post("/admin/stock-transfers", middleware.AdminJWT, admin.CreateStockTransfer)
+	app.Get("/admin/stock-transfers", middleware.AdminJWT, admin.ViewStockTransfers)
+	app.Post("/admin/stock-transfers/:id/receive", middleware.AdminJWT, admin.ReceiveStockTransfer)
+	app.Post("/admin/stock-transfers/:id/cancel", middleware.AdminJWT, admin.CancelStockTransfer)
+
+	//Suppliers & Purchasing
+	app.Post("/admin/suppliers", middleware.AdminJWT, admin.AddSupplier)
+	app.Put("/admin/suppliers/:id", middleware.AdminJWT, admin.EditSupplier)
+	app.Get("/admin/suppliers", middleware.AdminJWT, admin.AdminViewSuppliers)
+	app.Post("/admin/purchase-orders", middleware.AdminJWT, admin.CreatePurchaseOrder)
+	app.Get("/admin/purchase-orders", middleware.AdminJWT, admin.AdminViewPurchaseOrders)
+	app.Get("/admin/purchase-orders/:id", middleware.AdminJWT, admin.ViewPurchaseOrder)
+	app.Post("/admin/purchase-orders/:id/place", middleware.AdminJWT, admin.PlacePurchaseOrder)
+	app.Post("/admin/purchase-orders/:id/cancel", middleware.AdminJWT, admin.CancelPurchaseOrder)
+	app.Post("/admin/purchase-orders/:id/receipts", middleware.AdminJWT, admin.ReceiveGoods)
+
+	//Review Moderation
+	app.Get("/admin/reviews", middleware.AdminJWT, admin.AdminViewReviews)
+	app.Patch("/admin/reviews/:id/status", middleware.AdminJWT, admin.ModerateReview)
+
+	//Brand Management
+	app.Post("/admin/brands", middleware.AdminJWT, admin.AddBrand)
+	app.Put("/admin/brands/:id", middleware.AdminJWT, admin.EditBrand)
+	app.Delete("/admin/brands/:id", middleware.AdminJWT, admin.SoftDeleteBrand)
+	app.Post("/admin/brands/:id/recover", middleware.AdminJWT, admin.RecoverBrand)
+	app.Get("/admin/brands", middleware.AdminJWT, admin.AdminViewBrands)
 
 	//Offer Management
 	app.Post("/admin/add-offer", middleware.AdminJWT, admin.AddOffer)
 	app.Delete("/admin/remove-offer/:product_id", middleware.AdminJWT, admin.RemoveOffer)
+	app.Delete("/admin/remove-brand-offer/:brand_id", middleware.AdminJWT, admin.RemoveBrandOffer)
+	app.Delete("/admin/offers/:id", middleware.AdminJWT, admin.RemoveOfferByID)
 	app.Get("/admin/view-offers", middleware.AdminJWT, admin.ViewOffer)
+	app.Put("/admin/offer-precedence", middleware.AdminJWT, admin.SetOfferPrecedence)
+
+	//Promotions
+	app.Post("/admin/promotions", middleware.AdminJWT, admin.AddPromotion)
+	app.Put("/admin/promotions/:id", middleware.AdminJWT, admin.EditPromotion)
+	app.Delete("/admin/promotions/:id", middleware.AdminJWT, admin.DeactivatePromotion)
+	app.Get("/admin/promotions", middleware.AdminJWT, admin.AdminViewPromotions)
 
 	//Coupon Management
 	app.Post("/admin/add-coupon", middleware.AdminJWT, admin.CreateCoupon)
 	app.Get("/admin/view-coupon", middleware.AdminJWT, admin.ViewCouponsAdmin)
 	app.Delete("/admin/remove-coupon/:id", middleware.AdminJWT, admin.RemoveCoupon)
+	app.Post("/admin/coupon-batches", middleware.AdminJWT, admin.GenerateCouponBatch)
+	app.Get("/admin/coupon-batches", middleware.AdminJWT, admin.AdminViewCouponBatches)
+	app.Get("/admin/coupon-batches/:id", middleware.AdminJWT, admin.ViewCouponBatch)
+
+	//Referrals
+	app.Put("/admin/referral-settings", middleware.AdminJWT, admin.UpdateReferralSettings)
+	app.Get("/admin/referral-report", middleware.AdminJWT, admin.ReferralReport)
+
+	//Flash Sales
+	app.Post("/admin/flash-sales", middleware.AdminJWT, admin.CreateFlashSale)
+	app.Get("/admin/flash-sales", middleware.AdminJWT, admin.AdminViewFlashSales)
+	app.Delete("/admin/flash-sales/:id", middleware.AdminJWT, admin.EndFlashSale)
+
+	//Abandoned Carts
+	app.Put("/admin/cart-recovery-settings", middleware.AdminJWT, admin.UpdateCartRecoverySettings)
+	app.Get("/admin/abandoned-carts", middleware.AdminJWT, admin.AbandonedCartReport)
+
+	//Loyalty
+	app.Put("/admin/loyalty-settings", middleware.AdminJWT, admin.UpdateLoyaltySettings)
 
 	//Order Management
 	app.Get("/admin/order-details", middleware.AdminJWT, admin.AdminListOrder)
@@ -50,4 +136,5 @@ func AdminRoutes(app *fiber.App) {
 	app.Post("/sales-report", middleware.AdminJWT, admin.GenerateSalesReport)
 	app.Get("/dashboard/:period", middleware.AdminJWT, admin.GenerateDashboardReport)
 	app.Get("/top-selling-report", middleware.AdminJWT, admin.GenerateTopSellingReport)
+	app.Get("/inventory-valuation-report", middleware.AdminJWT, admin.InventoryValuationReport)
 }
@@ -10,16 +10,50 @@ import (
 func UserRoutes(app *fiber.App) {
 
 	//Authorization
+	loginThrottle := middleware.LoginThrottle(middleware.ThrottleConfig{
+		Scope:      "user",
+		AccountKey: middleware.BodyField("email"),
+		OnLockout:  middleware.NotifyAccountLocked,
+	})
+	otpThrottle := middleware.LoginThrottle(middleware.ThrottleConfig{
+		Scope:      "otp",
+		AccountKey: middleware.BodyField("email"),
+	})
+	googleLinkThrottle := middleware.LoginThrottle(middleware.ThrottleConfig{
+		Scope:      "google_link",
+		AccountKey: users.GoogleLinkAccountKey,
+	})
+
 	app.Post("/user/signup", users.Signup)
-	app.Post("/user/verify-otp", users.VerifyOTP)
+	app.Post("/user/verify-otp", otpThrottle, users.VerifyOTP)
 	app.Post("/user/resend-otp", users.ResendOTP)
-	app.Post("user/login", users.Login)
+	app.Post("user/login", loginThrottle, users.Login)
+	app.Post("/user/login/request-otp", users.RequestLoginOTP)
+	app.Post("/user/login/verify-otp", otpThrottle, users.VerifyLoginOTP)
+	app.Get("/user/login/magic", users.MagicLinkLogin)
 	app.Get("/auth/google/login", users.GoogleLogin)
 	app.Get("/auth/google/callback", users.GoogleCallback)
+	app.Post("/auth/google/link", googleLinkThrottle, users.LinkGoogleAccount)
 	//View Products
 	app.Get("/categories", users.ViewCategories)
+	app.Get("/categories/tree", users.CategoryTree)
+	app.Get("/categories/:id/products", users.CategoryProducts)
+	app.Get("/products/:id/breadcrumbs", users.ProductBreadcrumbs)
+	app.Get("/categories/:id/filters", users.CategoryFilters)
+	app.Get("/products/:id", users.ProductDetail)
+	app.Get("/products/:id/images", users.ProductImages)
+	app.Get("/products/:id/reviews", users.ViewProductReviews)
 	app.Get("/products", users.ViewProducts)
+	app.Get("/brands", users.ViewBrands)
+	app.Get("/brands/:id/products", users.BrandProducts)
 	app.Get("/product/filter", users.SearchProducts)
+	app.Get("/flash-sales", users.ViewFlashSales)
+
+	//Guest cart
+	app.Post("/guest/add-cart", users.GuestAddToCart)
+	app.Delete("/guest/remove-cart/:product_id", users.GuestRemoveFromCart)
+	app.Get("/guest/list-cart", users.GuestViewCart)
+	app.Delete("/guest/clear-cart", users.GuestClearCart)
 
 	userRoutes := app.Group("/user", middleware.AuthMiddleware)
 
@@ -28,6 +62,9 @@ func UserRoutes(app *fiber.App) {
 	userRoutes.Post("/edit-profile", users.EditUserProfile)
 	userRoutes.Get("/view-wallet", users.ViewWalletBalance)
 	userRoutes.Get("/wallet-transaction", users.ViewWalletTransactions)
+	userRoutes.Get("/data-export", users.ExportUserData)
+	userRoutes.Post("/delete-account", users.RequestAccountDeletion)
+	userRoutes.Delete("/delete-account", users.CancelAccountDeletion)
 
 	//Address
 	userRoutes.Post("/add-address", users.AddAddress)
@@ -41,6 +78,10 @@ func UserRoutes(app *fiber.App) {
 	userRoutes.Delete("/clear-wishlist", users.ClearWishlist)
 	userRoutes.Get("/wishlist", users.ViewWishlist)
 
+	//Back-in-stock notifications
+	userRoutes.Post("/products/:id/notify-me", users.SubscribeStockNotification)
+	userRoutes.Delete("/products/:id/notify-me", users.UnsubscribeStockNotification)
+
 	//Cart
 	userRoutes.Post("/add-cart", users.AddToCart)
 	userRoutes.Delete("/remove-cart/:product_id", users.RemoveFromCart)
@@ -52,14 +93,26 @@ func UserRoutes(app *fiber.App) {
 	app.Get("paypal/success", users.PayPalSuccess)
 	app.Get("paypal/cancel", users.PayPalCancel)
 
+	//Referrals
+	userRoutes.Get("/referrals", users.ReferralDashboard)
+
+	//Loyalty
+	userRoutes.Get("/loyalty", users.LoyaltyDashboard)
+
 	//Coupon
 	userRoutes.Post("/apply-coupon", users.ApplyCoupon)
 	userRoutes.Get("/coupon", users.ViewCoupons)
+	userRoutes.Get("/coupons/eligible", users.EligibleCoupons)
 
 	//Order
 	userRoutes.Get("view-orders", users.ViewOrder)
 	userRoutes.Post("cancel-order/:order_id", users.CancelOrder)
 
+	//Reviews
+	userRoutes.Post("/products/:id/reviews", users.SubmitReview)
+	userRoutes.Post("/reviews/:id/helpful", users.MarkReviewHelpful)
+	userRoutes.Delete("/reviews/:id/helpful", users.UnmarkReviewHelpful)
+
 	//Invoice
 	userRoutes.Get("/invoice/:orderID", users.GetInvoice)
 
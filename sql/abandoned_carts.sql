@@ -0,0 +1,43 @@
+-- Abandoned cart recovery settings. Always exactly one row.
+--   idle_hours: how long a cart must go untouched to count as abandoned
+--   max_reminders / reminder_interval_hours: how many reminders one cart
+--   gets and how far apart
+--   attribution_days: how long after the last reminder a checkout still
+--   counts as a recovery
+--   coupon_*: the optional one-time coupon sent with the first reminder
+CREATE TABLE IF NOT EXISTS cart_recovery_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    idle_hours INT NOT NULL DEFAULT 24 CHECK (idle_hours > 0),
+    max_reminders INT NOT NULL DEFAULT 2 CHECK (max_reminders >= 0),
+    reminder_interval_hours INT NOT NULL DEFAULT 48 CHECK (reminder_interval_hours > 0),
+    attribution_days INT NOT NULL DEFAULT 7 CHECK (attribution_days > 0),
+    coupon_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    coupon_percentage DECIMAL(5, 2) NOT NULL DEFAULT 10 CHECK (coupon_percentage > 0 AND coupon_percentage <= 100),
+    coupon_max_discount DECIMAL(10, 2) NOT NULL DEFAULT 500 CHECK (coupon_max_discount > 0),
+    coupon_validity_hours INT NOT NULL DEFAULT 72 CHECK (coupon_validity_hours > 0)
+);
+INSERT INTO cart_recovery_settings (id) VALUES (TRUE) ON CONFLICT (id) DO NOTHING;
+
+-- One row per time a customer's cart was found idle. last_activity_at is
+-- the cart's latest change when it was detected, so the same idle cart is
+-- not detected twice. An open cart is recovered by the next checkout, or
+-- lost once it is emptied or its reminders have run out.
+CREATE TABLE IF NOT EXISTS abandoned_carts (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'Open' CHECK (status IN ('Open', 'Recovered', 'Lost')),
+    last_activity_at TIMESTAMP NOT NULL,
+    item_count INT NOT NULL,
+    cart_value DECIMAL(10, 2) NOT NULL,
+    reminders_sent INT NOT NULL DEFAULT 0,
+    last_reminded_at TIMESTAMP,
+    coupon_id INT REFERENCES coupons(id) ON DELETE SET NULL,
+    recovered_order_id INT REFERENCES orders(id),
+    recovered_value DECIMAL(10, 2),
+    detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_abandoned_carts_open ON abandoned_carts (user_id) WHERE status = 'Open';
+CREATE INDEX IF NOT EXISTS idx_abandoned_carts_detected ON abandoned_carts (detected_at);
+CREATE INDEX IF NOT EXISTS idx_cart_user_updated ON cart (user_id, updated_at);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS account_deletion_requests (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL UNIQUE,
+    reason TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'Pending',
+    requested_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    scheduled_for TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
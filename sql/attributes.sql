@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS attribute_definitions (
+    id SERIAL PRIMARY KEY,
+    category_id INT NOT NULL REFERENCES categories(id),
+    name VARCHAR(100) NOT NULL,
+    code VARCHAR(100) NOT NULL,
+    data_type VARCHAR(20) NOT NULL CHECK (data_type IN ('text', 'number', 'boolean', 'enum')),
+    unit VARCHAR(20),
+    allowed_values TEXT[] NOT NULL DEFAULT '{}',
+    filterable BOOLEAN NOT NULL DEFAULT FALSE,
+    sort_order INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (category_id, code)
+);
+
+CREATE TABLE IF NOT EXISTS product_attribute_values (
+    product_id INT NOT NULL REFERENCES products(id),
+    attribute_id INT NOT NULL REFERENCES attribute_definitions(id) ON DELETE CASCADE,
+    value TEXT NOT NULL,
+    value_number NUMERIC,
+    PRIMARY KEY (product_id, attribute_id)
+);
+CREATE INDEX IF NOT EXISTS idx_product_attribute_values_attribute ON product_attribute_values (attribute_id, value);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS brands (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    slug VARCHAR(120) UNIQUE NOT NULL,
+    description TEXT,
+    logo_key TEXT,
+    deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS brand_id INT REFERENCES brands(id);
+CREATE INDEX IF NOT EXISTS idx_products_brand ON products (brand_id);
+
+-- Offers can target every product of a brand; offer_scopes.sql checks that
+-- each offer names the target its scope needs.
+ALTER TABLE offers ALTER COLUMN product_id DROP NOT NULL;
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS brand_id INT REFERENCES brands(id) ON DELETE CASCADE;
@@ -0,0 +1,38 @@
+-- Who may use a coupon: per_user_limit caps redemptions per customer (NULL
+-- is no cap), first_order_only, segments and coupon_users restrict who
+-- qualifies, and category_ids limits the discount to those categories.
+ALTER TABLE coupons ADD COLUMN IF NOT EXISTS per_user_limit INT CHECK (per_user_limit > 0);
+ALTER TABLE coupons ADD COLUMN IF NOT EXISTS first_order_only BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE coupons ADD COLUMN IF NOT EXISTS segments TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE coupons ADD COLUMN IF NOT EXISTS category_ids INT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS coupon_users (
+    coupon_id INT NOT NULL REFERENCES coupons(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (coupon_id, user_id)
+);
+
+-- Bulk-generated single-use codes belong to a batch.
+CREATE TABLE IF NOT EXISTS coupon_batches (
+    id SERIAL PRIMARY KEY,
+    campaign VARCHAR(100) NOT NULL,
+    prefix VARCHAR(20) NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+ALTER TABLE coupons ADD COLUMN IF NOT EXISTS batch_id INT REFERENCES coupon_batches(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_coupons_batch ON coupons (batch_id);
+
+-- A redemption is released again when its order is cancelled.
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    id SERIAL PRIMARY KEY,
+    coupon_id INT NOT NULL REFERENCES coupons(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    discount DECIMAL(10, 2) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'Redeemed' CHECK (status IN ('Redeemed', 'Rolled Back')),
+    redeemed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    rolled_back_at TIMESTAMP,
+    UNIQUE (coupon_id, order_id)
+);
+CREATE INDEX IF NOT EXISTS idx_coupon_redemptions_user ON coupon_redemptions (coupon_id, user_id) WHERE status = 'Redeemed';
@@ -0,0 +1,41 @@
+-- Flash sales sell a fixed number of units of each product at a discount
+-- between start_time and end_time. claimed counts units taken by orders and
+-- can never pass quantity, whatever checkouts race for the last units.
+CREATE TABLE IF NOT EXISTS flash_sales (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (end_time > start_time)
+);
+CREATE INDEX IF NOT EXISTS idx_flash_sales_window ON flash_sales (start_time, end_time) WHERE active;
+
+CREATE TABLE IF NOT EXISTS flash_sale_items (
+    id SERIAL PRIMARY KEY,
+    flash_sale_id INT NOT NULL REFERENCES flash_sales(id) ON DELETE CASCADE,
+    product_id INT NOT NULL REFERENCES products(id),
+    discount_percentage DECIMAL(5, 2) NOT NULL CHECK (discount_percentage > 0 AND discount_percentage <= 100),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    claimed INT NOT NULL DEFAULT 0,
+    per_customer_limit INT NOT NULL DEFAULT 1 CHECK (per_customer_limit > 0),
+    UNIQUE (flash_sale_id, product_id),
+    CHECK (claimed >= 0 AND claimed <= quantity)
+);
+CREATE INDEX IF NOT EXISTS idx_flash_sale_items_product ON flash_sale_items (product_id);
+
+-- Units of a flash sale item taken by an order. Cancelling the order
+-- releases them back to the sale.
+CREATE TABLE IF NOT EXISTS flash_sale_claims (
+    id SERIAL PRIMARY KEY,
+    flash_sale_item_id INT NOT NULL REFERENCES flash_sale_items(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id),
+    order_id INT NOT NULL REFERENCES orders(id),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'Claimed' CHECK (status IN ('Claimed', 'Released')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    released_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_flash_sale_claims_customer ON flash_sale_claims (flash_sale_item_id, user_id) WHERE status = 'Claimed';
+CREATE INDEX IF NOT EXISTS idx_flash_sale_claims_order ON flash_sale_claims (order_id);
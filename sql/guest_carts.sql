@@ -0,0 +1,13 @@
+-- Carts of visitors who have not logged in, keyed by the random id in their
+-- signed guest cart token. They are merged into the customer's cart at login
+-- and purged once left alone for long enough.
+CREATE TABLE IF NOT EXISTS guest_cart_items (
+    id SERIAL PRIMARY KEY,
+    guest_id VARCHAR(64) NOT NULL,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (guest_id, product_id)
+);
+CREATE INDEX IF NOT EXISTS idx_guest_cart_items_updated ON guest_cart_items (updated_at);
@@ -0,0 +1,43 @@
+-- Loyalty program settings. Always exactly one row.
+--   points_per_rupee: points earned per rupee paid on a delivered order
+--   rupees_per_point: discount a point is worth when redeemed
+--   max_redemption_percentage: share of an order points may pay for
+--   silver/gold thresholds: delivered spend over the last 12 months needed
+--   for each tier, whose multiplier scales the points earned
+CREATE TABLE IF NOT EXISTS loyalty_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    points_per_rupee DECIMAL(10, 4) NOT NULL DEFAULT 0.1 CHECK (points_per_rupee >= 0),
+    rupees_per_point DECIMAL(10, 4) NOT NULL DEFAULT 0.25 CHECK (rupees_per_point >= 0),
+    max_redemption_percentage DECIMAL(5, 2) NOT NULL DEFAULT 20 CHECK (max_redemption_percentage BETWEEN 0 AND 100),
+    review_bonus_points INT NOT NULL DEFAULT 20 CHECK (review_bonus_points >= 0),
+    validity_days INT NOT NULL DEFAULT 365 CHECK (validity_days > 0),
+    silver_threshold DECIMAL(10, 2) NOT NULL DEFAULT 10000,
+    gold_threshold DECIMAL(10, 2) NOT NULL DEFAULT 25000,
+    silver_multiplier DECIMAL(4, 2) NOT NULL DEFAULT 1.25,
+    gold_multiplier DECIMAL(4, 2) NOT NULL DEFAULT 1.5,
+    CHECK (gold_threshold >= silver_threshold)
+);
+INSERT INTO loyalty_settings (id) VALUES (TRUE) ON CONFLICT (id) DO NOTHING;
+
+-- Every change to a customer's points. Credits carry what is left of them
+-- in remaining and expire at expires_at; debits use up the credits that
+-- expire soonest first. The balance is the remaining of unexpired credits.
+CREATE TABLE IF NOT EXISTS loyalty_ledger (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    entry_type VARCHAR(20) NOT NULL
+        CHECK (entry_type IN ('earn', 'review_bonus', 'redeem', 'redeem_refund', 'reversal', 'expire')),
+    points INT NOT NULL,
+    remaining INT NOT NULL DEFAULT 0 CHECK (remaining >= 0),
+    order_id INT REFERENCES orders(id),
+    review_id INT REFERENCES product_reviews(id) ON DELETE SET NULL,
+    note TEXT,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_loyalty_ledger_credits ON loyalty_ledger (user_id, expires_at) WHERE remaining > 0;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loyalty_ledger_order_earn ON loyalty_ledger (order_id) WHERE entry_type = 'earn';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loyalty_ledger_review_bonus ON loyalty_ledger (review_id) WHERE entry_type = 'review_bonus';
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS loyalty_points_redeemed INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS loyalty_discount DECIMAL(10, 2) NOT NULL DEFAULT 0;
@@ -0,0 +1,36 @@
+-- An offer's scope says what it covers: one product, a set of products
+-- (listed in offer_products), a category and its subcategories, a brand, or
+-- the whole store.
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS category_id INT REFERENCES categories(id) ON DELETE CASCADE;
+ALTER TABLE offers ADD COLUMN IF NOT EXISTS scope VARCHAR(20) NOT NULL DEFAULT 'product';
+UPDATE offers SET scope = 'brand' WHERE brand_id IS NOT NULL AND scope = 'product';
+
+ALTER TABLE offers DROP CONSTRAINT IF EXISTS offers_target_check;
+ALTER TABLE offers ADD CONSTRAINT offers_target_check CHECK (
+    CASE scope
+        WHEN 'product' THEN product_id IS NOT NULL AND num_nonnulls(brand_id, category_id) = 0
+        WHEN 'brand' THEN brand_id IS NOT NULL AND num_nonnulls(product_id, category_id) = 0
+        WHEN 'category' THEN category_id IS NOT NULL AND num_nonnulls(product_id, brand_id) = 0
+        WHEN 'products' THEN num_nonnulls(product_id, brand_id, category_id) = 0
+        WHEN 'store' THEN num_nonnulls(product_id, brand_id, category_id) = 0
+        ELSE false
+    END
+);
+CREATE INDEX IF NOT EXISTS idx_offers_live ON offers (start_date, end_date);
+
+CREATE TABLE IF NOT EXISTS offer_products (
+    offer_id INT NOT NULL REFERENCES offers(id) ON DELETE CASCADE,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    PRIMARY KEY (offer_id, product_id)
+);
+CREATE INDEX IF NOT EXISTS idx_offer_products_product ON offer_products (product_id);
+
+-- How to choose between several offers covering the same product:
+-- 'best_for_customer' takes the largest discount, 'most_specific' takes the
+-- narrowest scope (see ActiveOfferJoin). Always exactly one row.
+CREATE TABLE IF NOT EXISTS offer_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    precedence VARCHAR(20) NOT NULL DEFAULT 'best_for_customer'
+        CHECK (precedence IN ('best_for_customer', 'most_specific'))
+);
+INSERT INTO offer_settings (id) VALUES (TRUE) ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS otp_codes (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(100) NOT NULL,
+    purpose VARCHAR(30) NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    last_sent_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(email, purpose)
+);
+CREATE TABLE IF NOT EXISTS otp_send_log (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(100) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_otp_send_log_email ON otp_send_log (email, sent_at);
+CREATE INDEX IF NOT EXISTS idx_otp_send_log_ip ON otp_send_log (ip_address, sent_at);
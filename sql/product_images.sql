@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS product_images (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    original_key TEXT NOT NULL,
+    medium_key TEXT NOT NULL,
+    thumbnail_key TEXT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    sort_order INT NOT NULL DEFAULT 0,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_images_primary ON product_images (product_id) WHERE is_primary;
+CREATE TABLE IF NOT EXISTS file_deletions (
+    id SERIAL PRIMARY KEY,
+    file_key TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,28 @@
+-- Promotions are evaluated in priority order (highest first). conditions and
+-- action hold the rule's parameters as JSON; see models.Promotion.
+CREATE TABLE IF NOT EXISTS promotions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    priority INT NOT NULL DEFAULT 0,
+    exclusive BOOLEAN NOT NULL DEFAULT FALSE,
+    conditions JSONB NOT NULL DEFAULT '{}',
+    action_type VARCHAR(30) NOT NULL,
+    action JSONB NOT NULL DEFAULT '{}',
+    start_date TIMESTAMP NOT NULL,
+    end_date TIMESTAMP NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (end_date > start_date)
+);
+CREATE INDEX IF NOT EXISTS idx_promotions_live ON promotions (start_date, end_date) WHERE active;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS promotion_discount DECIMAL(10, 2) DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS order_promotions (
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    promotion_id INT NOT NULL REFERENCES promotions(id),
+    amount DECIMAL(10, 2) NOT NULL,
+    PRIMARY KEY (order_id, promotion_id)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS product_cooccurrence (
+    product_id INT NOT NULL REFERENCES products(id),
+    related_product_id INT NOT NULL REFERENCES products(id),
+    score INT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (product_id, related_product_id)
+);
+CREATE INDEX IF NOT EXISTS idx_product_cooccurrence_score ON product_cooccurrence (product_id, score DESC);
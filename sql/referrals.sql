@@ -0,0 +1,47 @@
+-- Every customer gets a referral code when their account is created.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS referral_code VARCHAR(12) UNIQUE
+    DEFAULT ('R' || UPPER(SUBSTR(MD5(RANDOM()::TEXT || CLOCK_TIMESTAMP()::TEXT), 1, 8)));
+
+-- Reward amounts credited to the wallets of the referrer and the new
+-- customer once the new customer's first order is delivered. Always exactly
+-- one row.
+CREATE TABLE IF NOT EXISTS referral_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    referrer_reward DECIMAL(10, 2) NOT NULL DEFAULT 100 CHECK (referrer_reward >= 0),
+    referee_reward DECIMAL(10, 2) NOT NULL DEFAULT 50 CHECK (referee_reward >= 0),
+    active BOOLEAN NOT NULL DEFAULT TRUE
+);
+INSERT INTO referral_settings (id) VALUES (TRUE) ON CONFLICT (id) DO NOTHING;
+
+-- Referrals that look like abuse are kept as Rejected with the reason, for
+-- reporting, and never pay out.
+CREATE TABLE IF NOT EXISTS referrals (
+    id SERIAL PRIMARY KEY,
+    referrer_id INT NOT NULL REFERENCES users(id),
+    referee_id INT NOT NULL UNIQUE REFERENCES users(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'Pending',
+    rejection_reason VARCHAR(30),
+    order_id INT REFERENCES orders(id),
+    referrer_reward DECIMAL(10, 2),
+    referee_reward DECIMAL(10, 2),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    rewarded_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_referrals_referrer ON referrals (referrer_id);
+
+-- A reward is taken back, and the referral marked Reversed, when the order
+-- that earned it is returned.
+ALTER TABLE referrals ADD COLUMN IF NOT EXISTS reversed_at TIMESTAMP;
+ALTER TABLE referrals DROP CONSTRAINT IF EXISTS referrals_status_check;
+ALTER TABLE referrals ADD CONSTRAINT referrals_status_check
+    CHECK (status IN ('Pending', 'Rewarded', 'Rejected', 'Reversed'));
+
+-- Devices customers have signed up or logged in from, as reported by the
+-- client in the X-Device-ID header.
+CREATE TABLE IF NOT EXISTS user_devices (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id VARCHAR(100) NOT NULL,
+    first_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, device_id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_devices_device ON user_devices (device_id);
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS product_reviews (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id),
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating INT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    title VARCHAR(150),
+    body TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'Pending',
+    helpful_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (product_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_product_reviews_product ON product_reviews (product_id, status);
+
+CREATE TABLE IF NOT EXISTS review_photos (
+    id SERIAL PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES product_reviews(id) ON DELETE CASCADE,
+    image_key TEXT NOT NULL,
+    thumbnail_key TEXT NOT NULL,
+    sort_order INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS review_votes (
+    review_id INT NOT NULL REFERENCES product_reviews(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (review_id, user_id)
+);
@@ -0,0 +1,75 @@
+CREATE TABLE IF NOT EXISTS warehouses (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    address_line TEXT,
+    city VARCHAR(100),
+    zip_code VARCHAR(10) NOT NULL DEFAULT '',
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_warehouses_default ON warehouses (is_default) WHERE is_default;
+
+INSERT INTO warehouses (name, is_default)
+SELECT 'Main Warehouse', true
+WHERE NOT EXISTS (SELECT 1 FROM warehouses);
+
+-- products.stock is kept as the total across warehouses so that storefront
+-- queries keep reading a single column.
+CREATE TABLE IF NOT EXISTS warehouse_stock (
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    product_id INT NOT NULL REFERENCES products(id),
+    quantity INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (warehouse_id, product_id)
+);
+CREATE INDEX IF NOT EXISTS idx_warehouse_stock_product ON warehouse_stock (product_id);
+
+-- Stock that predates warehouses lives in the default one.
+INSERT INTO warehouse_stock (warehouse_id, product_id, quantity)
+SELECT w.id, p.id, p.stock
+FROM products p, warehouses w
+WHERE w.is_default AND NOT EXISTS (SELECT 1 FROM warehouse_stock s WHERE s.product_id = p.id);
+
+CREATE TABLE IF NOT EXISTS stock_adjustments (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id),
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    delta INT NOT NULL,
+    reason VARCHAR(30) NOT NULL,
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_stock_adjustments_product ON stock_adjustments (product_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS stock_transfers (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id),
+    from_warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    to_warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'In Transit',
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP,
+    CHECK (from_warehouse_id <> to_warehouse_id)
+);
+
+-- Each order line is filled from one or more warehouses.
+CREATE TABLE IF NOT EXISTS order_item_allocations (
+    id SERIAL PRIMARY KEY,
+    order_item_id INT NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    warehouse_id INT NOT NULL REFERENCES warehouses(id),
+    quantity INT NOT NULL CHECK (quantity > 0)
+);
+CREATE INDEX IF NOT EXISTS idx_order_item_allocations_item ON order_item_allocations (order_item_id);
+
+-- Sales, cancellations and returns name the order they belong to, so an
+-- order gives back exactly the stock it took.
+ALTER TABLE stock_adjustments ADD COLUMN IF NOT EXISTS order_id INT REFERENCES orders(id);
+CREATE INDEX IF NOT EXISTS idx_stock_adjustments_order ON stock_adjustments (order_id) WHERE order_id IS NOT NULL;
+UPDATE stock_adjustments sa
+SET order_id = substring(sa.note FROM '^Order (\d+)')::INT
+WHERE sa.order_id IS NULL AND sa.reason IN ('sale', 'return') AND sa.note ~ '^Order \d+'
+  AND EXISTS (SELECT 1 FROM orders o WHERE o.id = substring(sa.note FROM '^Order (\d+)')::INT);
@@ -22,6 +22,110 @@ var AdminViewProductsQuery = `
 			p.price, 
 			p.category_id,
 			p.stock,
+			p.brand_id,
 			p.deleted
 		FROM products p;
 	`
+
+// CategorySubtreeQuery returns the ids of a category and all of its descendants.
+var CategorySubtreeQuery = `
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+		)
+		SELECT id FROM subtree
+	`
+
+// CategoryPathQuery returns a category and its ancestors, root first.
+var CategoryPathQuery = `
+		WITH RECURSIVE path AS (
+			SELECT id, name, slug, parent_id, 0 AS depth FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.name, c.slug, c.parent_id, p.depth + 1
+			FROM categories c JOIN path p ON c.id = p.parent_id
+		)
+		SELECT id, name, slug FROM path ORDER BY depth DESC
+	`
+
+// CategoryAttributesQuery returns the attribute definitions that apply to a
+// category: its own and those inherited from its ancestors.
+var CategoryAttributesQuery = `
+		WITH RECURSIVE path AS (
+			SELECT id, parent_id FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.parent_id FROM categories c JOIN path p ON c.id = p.parent_id
+		)
+		SELECT a.id, a.category_id, a.name, a.code, a.data_type, COALESCE(a.unit, '') AS unit,
+		       a.allowed_values, a.filterable, a.sort_order
+		FROM attribute_definitions a
+		WHERE a.category_id IN (SELECT id FROM path)
+		ORDER BY a.sort_order, a.name
+	`
+
+// ProductSpecsQuery returns a product's attribute values for the attributes
+// that apply to its current category.
+var ProductSpecsQuery = `
+		WITH RECURSIVE path AS (
+			SELECT c.id, c.parent_id FROM categories c JOIN products p ON p.category_id = c.id WHERE p.id = $1
+			UNION ALL
+			SELECT c.id, c.parent_id FROM categories c JOIN path p ON c.id = p.parent_id
+		)
+		SELECT a.name, a.code, v.value, COALESCE(a.unit, '') AS unit
+		FROM product_attribute_values v
+		JOIN attribute_definitions a ON a.id = v.attribute_id
+		WHERE v.product_id = $1 AND a.category_id IN (SELECT id FROM path)
+		ORDER BY a.sort_order, a.name
+	`
+
+// ActiveOfferJoin attaches to each product p the offer running now that
+// wins for it, among offers on the product itself, on a product set that
+// includes it, on its category or any ancestor category, on its brand, and
+// storewide. With the 'best_for_customer' precedence the largest discount
+// wins; with 'most_specific' the narrowest scope wins (product, product set,
+// nearest category, brand, store) and discount breaks ties. Products without
+// an offer get NULL columns.
+var ActiveOfferJoin = `
+		LEFT JOIN LATERAL (
+			WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id, 0 AS depth FROM categories WHERE id = p.category_id
+				UNION ALL
+				SELECT c.id, c.parent_id, a.depth + 1 FROM categories c JOIN ancestors a ON c.id = a.parent_id
+			)
+			SELECT
+				o.id AS offer_id,
+				o.discount_percentage,
+				o.start_date,
+				o.end_date,
+				o.scope
+			FROM offers o
+			LEFT JOIN ancestors oc ON oc.id = o.category_id
+			WHERE o.start_date <= NOW() AND o.end_date >= NOW()
+			  AND CASE o.scope
+				WHEN 'product' THEN o.product_id = p.id
+				WHEN 'products' THEN EXISTS (SELECT 1 FROM offer_products op WHERE op.offer_id = o.id AND op.product_id = p.id)
+				WHEN 'category' THEN oc.id IS NOT NULL
+				WHEN 'brand' THEN o.brand_id = p.brand_id
+				ELSE o.scope = 'store'
+			  END
+			  AND NOT EXISTS (SELECT 1 FROM brands ob WHERE ob.id = o.brand_id AND ob.deleted)
+			ORDER BY
+				CASE WHEN (SELECT precedence FROM offer_settings) = 'most_specific' THEN
+					CASE o.scope
+						WHEN 'product' THEN 1000
+						WHEN 'products' THEN 900
+						WHEN 'category' THEN 500 - oc.depth
+						WHEN 'brand' THEN 100
+						ELSE 0
+					END
+				END DESC NULLS LAST,
+				o.discount_percentage DESC
+			LIMIT 1
+		) o ON true`
+
+// OrderInFlightCondition matches orders o still on their way to the
+// customer. Online orders that were never paid for will not ship, and are
+// cancelled once abandoned, so they do not count.
+var OrderInFlightCondition = `
+		o.status NOT IN ('Delivered', 'Cancelled', 'Returned')
+		AND (o.payment_method = 'cod' OR o.payment_status IN ('Paid', 'Completed'))`
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// couponCodeAlphabet leaves out characters that are easy to misread.
+const couponCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// GenerateCouponCode returns prefix followed by length random characters.
+func GenerateCouponCode(prefix string, length int) (string, error) {
+	var code strings.Builder
+	code.WriteString(prefix)
+	max := big.NewInt(int64(len(couponCodeAlphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(couponCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
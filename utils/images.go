@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	MaxImageSize = 5 << 20
+	// MaxImagePixels caps the decoded size of an upload, since a small file
+	// can declare dimensions that take gigabytes to decode.
+	MaxImagePixels     = 40_000_000
+	mediumImageSize    = 800
+	thumbnailImageSize = 200
+)
+
+var (
+	ErrImageTooLarge    = errors.New("image exceeds the 5 MB limit")
+	ErrImageDimensions  = errors.New("image exceeds the 40 megapixel limit")
+	ErrUnsupportedImage = errors.New("only JPEG, PNG and WebP images are supported")
+)
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// ImageRenditions holds an uploaded image and the resized copies generated
+// from it. Renditions are PNG for PNG uploads and JPEG otherwise.
+type ImageRenditions struct {
+	Original      []byte
+	OriginalExt   string
+	Medium        []byte
+	Thumbnail     []byte
+	RenditionExt  string
+	Width, Height int
+}
+
+// ProcessImage validates an upload by its content rather than its file name,
+// checks its dimensions before decoding it and generates the medium and
+// thumbnail renditions.
+func ProcessImage(data []byte) (ImageRenditions, error) {
+	if len(data) > MaxImageSize {
+		return ImageRenditions{}, ErrImageTooLarge
+	}
+
+	ext, ok := imageExtensions[http.DetectContentType(data)]
+	if !ok {
+		return ImageRenditions{}, ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ImageRenditions{}, ErrUnsupportedImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > MaxImagePixels/config.Height {
+		return ImageRenditions{}, ErrImageDimensions
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ImageRenditions{}, ErrUnsupportedImage
+	}
+
+	renditions := ImageRenditions{
+		Original:     data,
+		OriginalExt:  ext,
+		RenditionExt: ".jpg",
+		Width:        src.Bounds().Dx(),
+		Height:       src.Bounds().Dy(),
+	}
+	if ext == ".png" {
+		renditions.RenditionExt = ".png"
+	}
+
+	if renditions.Medium, err = encodeImage(resizeToFit(src, mediumImageSize), renditions.RenditionExt); err != nil {
+		return ImageRenditions{}, err
+	}
+	if renditions.Thumbnail, err = encodeImage(resizeToFit(src, thumbnailImageSize), renditions.RenditionExt); err != nil {
+		return ImageRenditions{}, err
+	}
+
+	return renditions, nil
+}
+
+// resizeToFit scales src down so neither side exceeds max, keeping the aspect
+// ratio. Images already small enough are returned unchanged.
+func resizeToFit(src image.Image, max int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= max && height <= max {
+		return src
+	}
+
+	if width >= height {
+		height = height * max / width
+		width = max
+	} else {
+		width = width * max / height
+		height = max
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
+
+func encodeImage(img image.Image, ext string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if ext == ".png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	}
+	return buf.Bytes(), err
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// pngDeclaring returns a small PNG whose header claims the given dimensions.
+func pngDeclaring(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// The IHDR chunk follows the 8-byte signature: length, type, then width
+	// and height, with its CRC after the 13 bytes of data.
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestProcessImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"small image", pngDeclaring(t, 4, 4), nil},
+		{"dimensions over the limit", pngDeclaring(t, 50000, 50000), ErrImageDimensions},
+		{"one very long side", pngDeclaring(t, 1, MaxImagePixels+1), ErrImageDimensions},
+		{"not an image", []byte("plain text, not an image"), ErrUnsupportedImage},
+		{"over the file size limit", make([]byte, MaxImageSize+1), ErrImageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renditions, err := ProcessImage(tt.data)
+			if err != tt.wantErr {
+				t.Fatalf("ProcessImage() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (renditions.Width != 4 || len(renditions.Thumbnail) == 0) {
+				t.Errorf("ProcessImage() = %dx%d with %d byte thumbnail", renditions.Width, renditions.Height, len(renditions.Thumbnail))
+			}
+		})
+	}
+}
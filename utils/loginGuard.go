@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"database/sql"
+	"horizon/config"
+	"math"
+	"sort"
+	"time"
+)
+
+// LockoutPolicy describes how failed attempts against one key are throttled.
+// After FreeAttempts failures each further failure doubles the wait before the
+// next attempt, and reaching MaxFailures locks the key for LockoutDuration.
+type LockoutPolicy struct {
+	Kind            string
+	FreeAttempts    int
+	MaxFailures     int
+	MaxBackoff      time.Duration
+	LockoutDuration time.Duration
+}
+
+var (
+	AccountLockoutPolicy = LockoutPolicy{
+		Kind:            "account",
+		FreeAttempts:    3,
+		MaxFailures:     10,
+		MaxBackoff:      5 * time.Minute,
+		LockoutDuration: 30 * time.Minute,
+	}
+	IPLockoutPolicy = LockoutPolicy{
+		Kind:            "ip",
+		FreeAttempts:    20,
+		MaxFailures:     100,
+		MaxBackoff:      5 * time.Minute,
+		LockoutDuration: 30 * time.Minute,
+	}
+)
+
+func (p LockoutPolicy) delay(failures int) time.Duration {
+	if failures >= p.MaxFailures {
+		return p.LockoutDuration
+	}
+	if failures < p.FreeAttempts {
+		return 0
+	}
+	backoff := time.Duration(math.Pow(2, float64(failures-p.FreeAttempts))) * time.Second
+	if backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
+
+// LoginKey is one counter an attempt is throttled by.
+type LoginKey struct {
+	Key    string
+	Policy LockoutPolicy
+}
+
+// ReserveLoginAttempt counts an attempt as a failure against every key
+// before it is made, so that parallel attempts cannot all get past the check
+// before any of them has failed. While a key is backing off nothing is
+// counted and it returns how long to wait. Otherwise it returns each key's
+// failures including this attempt; an attempt that turns out not to fail is
+// given back with ReleaseLoginAttempt.
+func ReserveLoginAttempt(keys ...LoginKey) (time.Duration, []int, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	// Keys are locked in a fixed order so that concurrent reservations
+	// cannot deadlock.
+	ordered := append([]LoginKey(nil), keys...)
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].Key < ordered[j].Key })
+
+	counts := map[string]int{}
+	var wait time.Duration
+	for _, key := range ordered {
+		_, err := tx.Exec(`INSERT INTO login_lockouts (lock_key, kind) VALUES ($1, $2) ON CONFLICT (lock_key) DO NOTHING`,
+			key.Key, key.Policy.Kind)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		var failures int
+		var seconds float64
+		query := `
+			SELECT CASE WHEN last_failure_at < NOW() - INTERVAL '1 day' THEN 0 ELSE failures END,
+			       COALESCE(EXTRACT(EPOCH FROM locked_until - NOW()), 0)
+			FROM login_lockouts
+			WHERE lock_key = $1
+			FOR UPDATE`
+		if err := tx.QueryRow(query, key.Key).Scan(&failures, &seconds); err != nil {
+			return 0, nil, err
+		}
+		if remaining := time.Duration(seconds * float64(time.Second)); remaining > wait {
+			wait = remaining
+		}
+		counts[key.Key] = failures + 1
+	}
+	if wait > 0 {
+		return wait, nil, nil
+	}
+
+	for _, key := range ordered {
+		if err := setLoginFailures(tx, key, counts[key.Key]); err != nil {
+			return 0, nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	failures := make([]int, len(keys))
+	for i, key := range keys {
+		failures[i] = counts[key.Key]
+	}
+	return 0, failures, nil
+}
+
+// ReleaseLoginAttempt gives back an attempt reserved against key that did
+// not fail, lifting a backoff the remaining failures do not earn.
+func ReleaseLoginAttempt(key LoginKey) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var failures int
+	err = tx.QueryRow(`SELECT failures FROM login_lockouts WHERE lock_key = $1 FOR UPDATE`, key.Key).Scan(&failures)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if failures <= 1 {
+		if _, err := tx.Exec(`DELETE FROM login_lockouts WHERE lock_key = $1`, key.Key); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	failures--
+	query := `UPDATE login_lockouts SET failures = $2, locked_until = CASE WHEN $3 THEN locked_until END WHERE lock_key = $1`
+	if _, err := tx.Exec(query, key.Key, failures, key.Policy.delay(failures) > 0); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setLoginFailures counts a new failure for key and starts the backoff the
+// policy gives its failures.
+func setLoginFailures(tx *sql.Tx, key LoginKey, failures int) error {
+	query := `
+		UPDATE login_lockouts
+		SET failures = $2, last_failure_at = NOW(),
+		    locked_until = CASE WHEN $3::float8 > 0 THEN NOW() + make_interval(secs => $3::float8) END
+		WHERE lock_key = $1`
+	_, err := tx.Exec(query, key.Key, failures, key.Policy.delay(failures).Seconds())
+	return err
+}
+
+// ResetLoginFailures clears the counter for key after a successful attempt.
+func ResetLoginFailures(key string) error {
+	_, err := config.DB.Exec(`DELETE FROM login_lockouts WHERE lock_key = $1`, key)
+	return err
+}
@@ -1,44 +1,143 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"math/big"
 	"net/smtp"
 	"os"
-	"sync"
 	"time"
-
-	"golang.org/x/exp/rand"
 )
 
 const (
 	otpLength   = 6
 	otpValidity = 5 * time.Minute
 	resendDelay = 30 * time.Second
+
+	maxOTPAttempts = 5
+	otpLockout     = 15 * time.Minute
+
+	sendWindow       = time.Hour
+	maxSendsPerEmail = 5
+	maxSendsPerIP    = 20
+)
+
+// OTPPurpose scopes a code so that one issued for signup cannot be used to log in.
+type OTPPurpose string
+
+const (
+	OTPPurposeSignup      OTPPurpose = "signup"
+	OTPPurposeLogin       OTPPurpose = "login"
+	OTPPurposeEmailChange OTPPurpose = "email_change"
+	OTPPurposeMagicLink   OTPPurpose = "magic_link"
+)
+
+var (
+	ErrOTPInvalid     = errors.New("invalid or expired OTP")
+	ErrOTPLocked      = errors.New("too many incorrect attempts, try again later")
+	ErrOTPRateLimited = errors.New("too many OTP requests, try again later")
 )
 
-var otpStore = sync.Map{}
+var otpStore OTPStore = PostgresOTPStore{}
+
+func SetOTPStore(store OTPStore) {
+	otpStore = store
+}
+
+func GenerateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpLength, n.Int64()), nil
+}
+
+func hashOTP(email string, purpose OTPPurpose, otp string) string {
+	secret := os.Getenv("OTP_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(email + ":" + string(purpose) + ":" + otp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IssueOTP generates a new code for the email and purpose, replacing any
+// pending one, and returns it so the caller can deliver it.
+func IssueOTP(email string, purpose OTPPurpose, ip string) (string, error) {
+	now := time.Now().UTC()
+
+	existing, err := otpStore.Find(email, purpose)
+	if err != nil && err != errOTPNotFound {
+		return "", err
+	}
+	if err == nil {
+		if existing.LockedUntil != nil && now.Before(*existing.LockedUntil) {
+			return "", ErrOTPLocked
+		}
+		if now.Sub(existing.LastSentAt) < resendDelay {
+			return "", fmt.Errorf("you can only resend otp after %d seconds", resendDelay/time.Second)
+		}
+	}
+
+	byEmail, byIP, err := otpStore.CountSends(email, ip, sendWindow)
+	if err != nil {
+		return "", err
+	}
+	if byEmail >= maxSendsPerEmail || byIP >= maxSendsPerIP {
+		return "", ErrOTPRateLimited
+	}
+
+	otp, err := GenerateOTP()
+	if err != nil {
+		return "", err
+	}
+
+	if err := saveOTP(email, purpose, otp, now); err != nil {
+		return "", err
+	}
+	if err := otpStore.LogSend(email, ip); err != nil {
+		return "", err
+	}
 
-type OTPData struct {
-	OTP          string
-	Expiration   time.Time
-	LastSentTime time.Time
+	return otp, nil
 }
 
-func GenerateOTP() string {
-	return fmt.Sprintf("%06d", rand.Intn(1000000))
+// IssueMagicLinkToken stores a long random token for passwordless login. It is
+// sent in the same email as the login OTP, so it does not count as a separate
+// send and must only be called after IssueOTP succeeded.
+func IssueMagicLinkToken(email string) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := saveOTP(email, OTPPurposeMagicLink, token, time.Now().UTC()); err != nil {
+		return "", err
+	}
+	return token, nil
 }
 
-func StoreOTP(email, otp string) {
-	otpData := OTPData{
-		OTP:          otp,
-		Expiration:   time.Now().Add(otpValidity),
-		LastSentTime: time.Now(),
+// RandomToken returns n cryptographically random bytes, hex encoded.
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
 	}
-	otpStore.Store(email, otpData)
+	return hex.EncodeToString(buf), nil
+}
 
-	time.AfterFunc(otpValidity, func() {
-		otpStore.Delete(email)
+func saveOTP(email string, purpose OTPPurpose, secret string, now time.Time) error {
+	return otpStore.Save(OTPRecord{
+		Email:      email,
+		Purpose:    purpose,
+		CodeHash:   hashOTP(email, purpose, secret),
+		ExpiresAt:  now.Add(otpValidity),
+		LastSentAt: now,
 	})
 }
 
@@ -62,54 +161,71 @@ func SendEmail(to, subject, body string) error {
 	return nil
 }
 
-func ResendOTP(email string) error {
-	value, exists := otpStore.Load(email)
-	var otpData OTPData
-
-	if exists {
-		otpData = value.(OTPData)
+func ResendOTP(email string, purpose OTPPurpose, ip string) error {
+	otp, err := IssueOTP(email, purpose, ip)
+	if err != nil {
+		return err
+	}
 
-		if time.Since(otpData.LastSentTime) < resendDelay {
-			return fmt.Errorf("you can only resend otp after %d seconds", resendDelay/time.Second)
-		}
+	body := fmt.Sprintf("Your OTP is: %s. It is valid for %d minutes.", otp, otpValidity/time.Minute)
+	if err := SendEmail(email, "Resend OTP", body); err != nil {
+		return fmt.Errorf("failed to resend OTP")
+	}
 
-		otpData.LastSentTime = time.Now()
-		otpStore.Store(email, otpData)
-	} else {
+	return nil
+}
 
-		newOTP := GenerateOTP()
-		StoreOTP(email, newOTP)
+// ValidateOTP checks a code and consumes it on success. Every guess is
+// counted before the code is compared, atomically in the store, so parallel
+// guesses cannot get past maxOTPAttempts; the guess that reaches it locks the
+// record.
+func ValidateOTP(email string, purpose OTPPurpose, otp string) error {
+	now := time.Now().UTC()
 
-		otpData = OTPData{
-			OTP:          newOTP,
-			Expiration:   time.Now().Add(otpValidity),
-			LastSentTime: time.Now(),
-		}
+	record, err := otpStore.Find(email, purpose)
+	if err == errOTPNotFound {
+		return ErrOTPInvalid
 	}
-
-	body := fmt.Sprintf("Your OTP is: %s. It is valid for 5 minutes.", otpData.OTP)
-	err := SendEmail(email, "Resend OTP", body)
 	if err != nil {
-		log.Printf("Failed to resend OTP: %v", err)
-		return fmt.Errorf("failed to resend OTP")
+		return err
 	}
 
-	return nil
-}
+	if record.LockedUntil != nil && now.Before(*record.LockedUntil) {
+		return ErrOTPLocked
+	}
 
-func ValidateOTP(email, otp string) bool {
-	value, exists := otpStore.Load(email)
-	if !exists {
-		return false
+	if now.After(record.ExpiresAt) {
+		return ErrOTPInvalid
 	}
 
-	otpData := value.(OTPData)
+	attempts, ok, err := otpStore.CountAttempt(email, purpose, maxOTPAttempts, now.Add(otpLockout))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrOTPLocked
+	}
 
-	if otpData.OTP == otp && time.Now().Before(otpData.Expiration) {
+	if !hmac.Equal([]byte(record.CodeHash), []byte(hashOTP(email, purpose, otp))) {
+		if attempts >= maxOTPAttempts {
+			return ErrOTPLocked
+		}
+		return ErrOTPInvalid
+	}
 
-		otpStore.Delete(email)
-		return true
+	// A code resent since the record was read no longer matches, and the
+	// guess was for the old one.
+	consumed, err := otpStore.Consume(email, purpose, record.CodeHash)
+	if err != nil {
+		return err
 	}
+	if !consumed {
+		return ErrOTPInvalid
+	}
+	return nil
+}
 
-	return false
+// DiscardOTP removes a pending code without verifying it.
+func DiscardOTP(email string, purpose OTPPurpose) error {
+	return otpStore.Delete(email, purpose)
 }
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"horizon/config"
+	"time"
+)
+
+// OTPRecord is a pending one-time password. Only the hash of the code is kept.
+type OTPRecord struct {
+	Email       string
+	Purpose     OTPPurpose
+	CodeHash    string
+	Attempts    int
+	ExpiresAt   time.Time
+	LastSentAt  time.Time
+	LockedUntil *time.Time
+}
+
+// OTPStore persists OTP records and the send log used for rate limiting.
+type OTPStore interface {
+	Save(record OTPRecord) error
+	Find(email string, purpose OTPPurpose) (OTPRecord, error)
+	// CountAttempt atomically adds an attempt to a record that is not
+	// locked, locking it until lockUntil once maxAttempts is reached, and
+	// returns the new count. A lock that has expired starts the count over.
+	// ok is false when the record is missing or locked.
+	CountAttempt(email string, purpose OTPPurpose, maxAttempts int, lockUntil time.Time) (attempts int, ok bool, err error)
+	// Consume deletes the record if it still holds codeHash, and reports
+	// whether it did.
+	Consume(email string, purpose OTPPurpose, codeHash string) (bool, error)
+	Delete(email string, purpose OTPPurpose) error
+	LogSend(email, ip string) error
+	CountSends(email, ip string, window time.Duration) (int, int, error)
+}
+
+var errOTPNotFound = errors.New("otp not found")
+
+// PostgresOTPStore keeps OTPs in the otp_codes table so they survive restarts
+// and are shared between instances.
+type PostgresOTPStore struct{}
+
+func (PostgresOTPStore) Save(record OTPRecord) error {
+	query := `
+		INSERT INTO otp_codes (email, purpose, code_hash, attempts, expires_at, last_sent_at, locked_until)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (email, purpose)
+		DO UPDATE SET code_hash = $3, attempts = $4, expires_at = $5, last_sent_at = $6, locked_until = $7`
+	_, err := config.DB.Exec(query, record.Email, record.Purpose, record.CodeHash, record.Attempts, record.ExpiresAt, record.LastSentAt, record.LockedUntil)
+	return err
+}
+
+func (PostgresOTPStore) Find(email string, purpose OTPPurpose) (OTPRecord, error) {
+	record := OTPRecord{Email: email, Purpose: purpose}
+	query := `
+		SELECT code_hash, attempts, expires_at, last_sent_at, locked_until
+		FROM otp_codes
+		WHERE email = $1 AND purpose = $2`
+	err := config.DB.QueryRow(query, email, purpose).Scan(&record.CodeHash, &record.Attempts, &record.ExpiresAt, &record.LastSentAt, &record.LockedUntil)
+	if err == sql.ErrNoRows {
+		return record, errOTPNotFound
+	}
+	return record, err
+}
+
+func (PostgresOTPStore) CountAttempt(email string, purpose OTPPurpose, maxAttempts int, lockUntil time.Time) (int, bool, error) {
+	var attempts int
+	query := `
+		UPDATE otp_codes
+		SET attempts = CASE WHEN locked_until IS NOT NULL AND locked_until <= $5 THEN 1 ELSE attempts + 1 END,
+		    locked_until = CASE
+		        WHEN (CASE WHEN locked_until IS NOT NULL AND locked_until <= $5 THEN 1 ELSE attempts + 1 END) >= $3 THEN $4
+		    END
+		WHERE email = $1 AND purpose = $2 AND (locked_until IS NULL OR locked_until <= $5)
+		RETURNING attempts`
+	err := config.DB.QueryRow(query, email, purpose, maxAttempts, lockUntil, time.Now().UTC()).Scan(&attempts)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return attempts, err == nil, err
+}
+
+func (PostgresOTPStore) Consume(email string, purpose OTPPurpose, codeHash string) (bool, error) {
+	result, err := config.DB.Exec(`DELETE FROM otp_codes WHERE email = $1 AND purpose = $2 AND code_hash = $3`, email, purpose, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (PostgresOTPStore) Delete(email string, purpose OTPPurpose) error {
+	_, err := config.DB.Exec(`DELETE FROM otp_codes WHERE email = $1 AND purpose = $2`, email, purpose)
+	return err
+}
+
+func (PostgresOTPStore) LogSend(email, ip string) error {
+	if _, err := config.DB.Exec(`INSERT INTO otp_send_log (email, ip_address) VALUES ($1, $2)`, email, ip); err != nil {
+		return err
+	}
+	_, err := config.DB.Exec(`DELETE FROM otp_send_log WHERE sent_at < NOW() - INTERVAL '1 day'`)
+	return err
+}
+
+func (PostgresOTPStore) CountSends(email, ip string, window time.Duration) (int, int, error) {
+	var byEmail, byIP int
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE email = $1),
+			COUNT(*) FILTER (WHERE ip_address = $2)
+		FROM otp_send_log
+		WHERE sent_at >= NOW() - make_interval(secs => $3) AND (email = $1 OR ip_address = $2)`
+	err := config.DB.QueryRow(query, email, ip, window.Seconds()).Scan(&byEmail, &byIP)
+	return byEmail, byIP, err
+}
@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryOTPStore is an OTPStore for tests. Like the Postgres store, it counts
+// attempts and consumes codes under one lock.
+type memoryOTPStore struct {
+	mu      sync.Mutex
+	records map[string]OTPRecord
+}
+
+func newMemoryOTPStore() *memoryOTPStore {
+	return &memoryOTPStore{records: map[string]OTPRecord{}}
+}
+
+func otpKey(email string, purpose OTPPurpose) string {
+	return email + ":" + string(purpose)
+}
+
+func (s *memoryOTPStore) Save(record OTPRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[otpKey(record.Email, record.Purpose)] = record
+	return nil
+}
+
+func (s *memoryOTPStore) Find(email string, purpose OTPPurpose) (OTPRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[otpKey(email, purpose)]
+	if !ok {
+		return OTPRecord{Email: email, Purpose: purpose}, errOTPNotFound
+	}
+	return record, nil
+}
+
+func (s *memoryOTPStore) CountAttempt(email string, purpose OTPPurpose, maxAttempts int, lockUntil time.Time) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := otpKey(email, purpose)
+	record, ok := s.records[key]
+	now := time.Now().UTC()
+	if !ok || (record.LockedUntil != nil && record.LockedUntil.After(now)) {
+		return 0, false, nil
+	}
+	if record.LockedUntil != nil {
+		record.Attempts = 0
+	}
+	record.Attempts++
+	record.LockedUntil = nil
+	if record.Attempts >= maxAttempts {
+		record.LockedUntil = &lockUntil
+	}
+	s.records[key] = record
+	return record.Attempts, true, nil
+}
+
+func (s *memoryOTPStore) Consume(email string, purpose OTPPurpose, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := otpKey(email, purpose)
+	if record, ok := s.records[key]; !ok || record.CodeHash != codeHash {
+		return false, nil
+	}
+	delete(s.records, key)
+	return true, nil
+}
+
+func (s *memoryOTPStore) Delete(email string, purpose OTPPurpose) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, otpKey(email, purpose))
+	return nil
+}
+
+func (s *memoryOTPStore) LogSend(email, ip string) error { return nil }
+
+func (s *memoryOTPStore) CountSends(email, ip string, window time.Duration) (int, int, error) {
+	return 0, 0, nil
+}
+
+const (
+	testEmail = "shopper@example.com"
+	testCode  = "123456"
+)
+
+// useMemoryOTPStore swaps in a fresh memory store holding a pending login
+// code for testEmail, after the given number of wrong guesses.
+func useMemoryOTPStore(t *testing.T, attempts int) *memoryOTPStore {
+	t.Helper()
+	t.Setenv("OTP_SECRET", "test-secret")
+	store := newMemoryOTPStore()
+	previous := otpStore
+	SetOTPStore(store)
+	t.Cleanup(func() { SetOTPStore(previous) })
+
+	if err := saveOTP(testEmail, OTPPurposeLogin, testCode, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < attempts; i++ {
+		if _, _, err := store.CountAttempt(testEmail, OTPPurposeLogin, maxOTPAttempts, time.Now().UTC().Add(otpLockout)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestValidateOTP(t *testing.T) {
+	tests := []struct {
+		name         string
+		priorMisses  int
+		purpose      OTPPurpose
+		code         string
+		want         error
+		wantConsumed bool
+	}{
+		{"correct code", 0, OTPPurposeLogin, testCode, nil, true},
+		{"correct code after misses", maxOTPAttempts - 2, OTPPurposeLogin, testCode, nil, true},
+		{"wrong code", 0, OTPPurposeLogin, "000000", ErrOTPInvalid, false},
+		{"wrong code reaching the limit", maxOTPAttempts - 1, OTPPurposeLogin, "000000", ErrOTPLocked, false},
+		{"correct code on its last attempt", maxOTPAttempts - 1, OTPPurposeLogin, testCode, nil, true},
+		{"correct code once locked", maxOTPAttempts, OTPPurposeLogin, testCode, ErrOTPLocked, false},
+		{"code for another purpose", 0, OTPPurposeSignup, testCode, ErrOTPInvalid, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := useMemoryOTPStore(t, tt.priorMisses)
+
+			if err := ValidateOTP(testEmail, tt.purpose, tt.code); err != tt.want {
+				t.Fatalf("ValidateOTP() = %v, want %v", err, tt.want)
+			}
+			_, err := store.Find(testEmail, OTPPurposeLogin)
+			if consumed := err == errOTPNotFound; consumed != tt.wantConsumed {
+				t.Errorf("code consumed = %v, want %v", consumed, tt.wantConsumed)
+			}
+		})
+	}
+}
+
+func TestValidateOTPExpired(t *testing.T) {
+	store := useMemoryOTPStore(t, 0)
+	record, _ := store.Find(testEmail, OTPPurposeLogin)
+	record.ExpiresAt = time.Now().UTC().Add(-time.Second)
+	store.Save(record)
+
+	if err := ValidateOTP(testEmail, OTPPurposeLogin, testCode); err != ErrOTPInvalid {
+		t.Fatalf("ValidateOTP() = %v, want %v", err, ErrOTPInvalid)
+	}
+}
+
+func TestValidateOTPAfterLockExpires(t *testing.T) {
+	store := useMemoryOTPStore(t, maxOTPAttempts)
+	record, _ := store.Find(testEmail, OTPPurposeLogin)
+	expired := time.Now().UTC().Add(-time.Second)
+	record.LockedUntil = &expired
+	store.Save(record)
+
+	if err := ValidateOTP(testEmail, OTPPurposeLogin, "000000"); err != ErrOTPInvalid {
+		t.Fatalf("first wrong guess after the lock = %v, want %v", err, ErrOTPInvalid)
+	}
+	record, _ = store.Find(testEmail, OTPPurposeLogin)
+	if record.Attempts != 1 || record.LockedUntil != nil {
+		t.Errorf("attempts = %d, locked = %v, want a fresh count", record.Attempts, record.LockedUntil != nil)
+	}
+	if err := ValidateOTP(testEmail, OTPPurposeLogin, testCode); err != nil {
+		t.Errorf("correct code after the lock = %v, want nil", err)
+	}
+}
+
+func TestValidateOTPConsumedCode(t *testing.T) {
+	useMemoryOTPStore(t, 0)
+	if err := ValidateOTP(testEmail, OTPPurposeLogin, testCode); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateOTP(testEmail, OTPPurposeLogin, testCode); err != ErrOTPInvalid {
+		t.Fatalf("reusing a consumed code = %v, want %v", err, ErrOTPInvalid)
+	}
+}
+
+func TestValidateOTPParallelGuesses(t *testing.T) {
+	store := useMemoryOTPStore(t, 0)
+
+	const guesses = 50
+	var wg sync.WaitGroup
+	results := make(chan error, guesses)
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- ValidateOTP(testEmail, OTPPurposeLogin, "000000")
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	invalid := 0
+	for err := range results {
+		switch err {
+		case ErrOTPInvalid:
+			invalid++
+		case ErrOTPLocked:
+		default:
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if invalid != maxOTPAttempts-1 {
+		t.Errorf("%d guesses were compared before the lock, want %d", invalid, maxOTPAttempts-1)
+	}
+
+	record, err := store.Find(testEmail, OTPPurposeLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Attempts != maxOTPAttempts {
+		t.Errorf("attempts = %d, want %d", record.Attempts, maxOTPAttempts)
+	}
+	if err := ValidateOTP(testEmail, OTPPurposeLogin, testCode); err != ErrOTPLocked {
+		t.Errorf("correct code after the lock = %v, want %v", err, ErrOTPLocked)
+	}
+}
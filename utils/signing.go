@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSignature = errors.New("invalid or expired signed value")
+
+func signingSecret() []byte {
+	secret := os.Getenv("COOKIE_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	return []byte(secret)
+}
+
+func signPayload(payload string) string {
+	mac := hmac.New(sha256.New, signingSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignValue returns a tamper-proof, expiring encoding of value that is safe to
+// place in cookies and URLs.
+func SignValue(value string, ttl time.Duration) string {
+	expiry := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value)) + "." + expiry
+	return payload + "." + signPayload(payload)
+}
+
+// VerifySignedValue returns the value encoded by SignValue if the signature
+// matches and it has not expired.
+func VerifySignedValue(signed string) (string, error) {
+	parts := strings.Split(signed, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidSignature
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(signPayload(payload))) {
+		return "", ErrInvalidSignature
+	}
+
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return "", ErrInvalidSignature
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	return string(value), nil
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"fmt"
+	"horizon/config"
+	"log"
+	"os"
+
+	"github.com/lib/pq"
+)
+
+// StockChanged reacts to a change in stock for the given products: it raises
+// low-stock alerts for the admins, resolves alerts for restocked products and
+// emails customers waiting for a product to come back. It is meant to run
+// after the change has been committed, usually in its own goroutine.
+func StockChanged(productIDs ...int) {
+	if len(productIDs) == 0 {
+		return
+	}
+	if err := raiseLowStockAlerts(productIDs); err != nil {
+		log.Printf("Failed to raise low-stock alerts: %v", err)
+	}
+	if err := notifyBackInStock(productIDs); err != nil {
+		log.Printf("Failed to send back-in-stock notifications: %v", err)
+	}
+}
+
+func raiseLowStockAlerts(productIDs []int) error {
+	resolveQuery := `
+		UPDATE stock_alerts a SET resolved_at = NOW()
+		FROM products p
+		WHERE a.product_id = p.id AND a.resolved_at IS NULL
+		AND p.id = ANY($1) AND p.stock >= p.reorder_threshold`
+	if _, err := config.DB.Exec(resolveQuery, pq.Array(productIDs)); err != nil {
+		return err
+	}
+
+	raiseQuery := `
+		WITH raised AS (
+			INSERT INTO stock_alerts (product_id, stock, threshold)
+			SELECT id, stock, reorder_threshold FROM products
+			WHERE id = ANY($1) AND deleted = false AND stock < reorder_threshold
+			ON CONFLICT (product_id) WHERE resolved_at IS NULL DO NOTHING
+			RETURNING product_id, stock, threshold
+		)
+		SELECT p.name, r.stock, r.threshold
+		FROM raised r JOIN products p ON p.id = r.product_id`
+	rows, err := config.DB.Query(raiseQuery, pq.Array(productIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var name string
+		var stock, threshold int
+		if err := rows.Scan(&name, &stock, &threshold); err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d left (reorder threshold %d)", name, stock, threshold))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	to := os.Getenv("ADMIN_ALERT_EMAIL")
+	if to == "" {
+		return nil
+	}
+	body := "The following products have dropped below their reorder threshold:\n\n"
+	for _, line := range lines {
+		body += line + "\n"
+	}
+	return SendEmail(to, "Horizon low-stock alert", body)
+}
+
+// notifyBackInStock claims the pending subscriptions of products that are in
+// stock again before emailing, so a subscriber is only notified once.
+func notifyBackInStock(productIDs []int) error {
+	query := `
+		UPDATE stock_subscriptions s SET notified_at = NOW()
+		FROM products p, users u
+		WHERE s.product_id = p.id AND s.user_id = u.id AND s.notified_at IS NULL
+		AND p.id = ANY($1) AND p.deleted = false AND p.stock > 0
+		RETURNING u.email, p.id, p.name`
+	rows, err := config.DB.Query(query, pq.Array(productIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var email, name string
+		var productID int
+		if err := rows.Scan(&email, &productID, &name); err != nil {
+			return err
+		}
+		body := fmt.Sprintf("Good news! %s is back in stock. Order soon, as quantities are limited.\n\n%s/products/%d",
+			name, config.AppBaseURL(), productID)
+		if err := SendEmail(email, name+" is back in stock", body); err != nil {
+			log.Printf("Failed to send back-in-stock email: %v", err)
+		}
+	}
+	return rows.Err()
+}
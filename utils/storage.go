@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStorage stores uploaded files under slash-separated keys. LocalStorage
+// is the only backend today; an S3-compatible one can satisfy the same interface.
+type FileStorage interface {
+	Save(key string, data []byte) error
+	Read(key string) ([]byte, error)
+	Delete(key string) error
+	URL(key string) string
+}
+
+// LocalStorage keeps files on the local filesystem under Root and serves them
+// from BaseURL, which main mounts as a static route.
+type LocalStorage struct {
+	Root    string
+	BaseURL string
+}
+
+func (s LocalStorage) path(key string) string {
+	return filepath.Join(s.Root, filepath.FromSlash(filepath.Clean("/"+key)))
+}
+
+func (s LocalStorage) Save(key string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (s LocalStorage) Read(key string) ([]byte, error) {
+	return os.ReadFile(s.path(key))
+}
+
+func (s LocalStorage) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s LocalStorage) URL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + strings.TrimPrefix(key, "/")
+}
+
+var storage FileStorage = NewLocalStorage()
+
+// NewLocalStorage reads UPLOAD_DIR and UPLOAD_BASE_URL, defaulting to
+// ./uploads served at /uploads.
+func NewLocalStorage() LocalStorage {
+	root := os.Getenv("UPLOAD_DIR")
+	if root == "" {
+		root = "./uploads"
+	}
+	baseURL := os.Getenv("UPLOAD_BASE_URL")
+	if baseURL == "" {
+		baseURL = "/uploads"
+	}
+	return LocalStorage{Root: root, BaseURL: baseURL}
+}
+
+func SetStorage(s FileStorage) {
+	storage = s
+}
+
+func Storage() FileStorage {
+	return storage
+}